@@ -0,0 +1,184 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apollotracing
+
+import (
+	"time"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/query"
+	"github.com/housecanary/gq/schema"
+)
+
+// A Trace is the tracing entry of the extensions of a response.  Offsets and
+// durations are in nanoseconds.
+type Trace struct {
+	Version    int            `json:"version"`
+	StartTime  time.Time      `json:"startTime"`
+	EndTime    time.Time      `json:"endTime"`
+	Duration   int64          `json:"duration"`
+	Parsing    Timing         `json:"parsing"`
+	Validation Timing         `json:"validation"`
+	Execution  ExecutionTrace `json:"execution"`
+}
+
+// A Timing is the time spent on a step, relative to the start of the trace
+type Timing struct {
+	StartOffset int64 `json:"startOffset"`
+	Duration    int64 `json:"duration"`
+}
+
+// An ExecutionTrace lists the fields that were resolved
+type ExecutionTrace struct {
+	Resolvers []*ResolverTrace `json:"resolvers"`
+}
+
+// A ResolverTrace is the time spent resolving a field.  For fields resolved
+// asynchronously, this includes the time until the value was awaited.
+type ResolverTrace struct {
+	Path        []interface{} `json:"path"`
+	ParentType  string        `json:"parentType"`
+	FieldName   string        `json:"fieldName"`
+	ReturnType  string        `json:"returnType"`
+	StartOffset int64         `json:"startOffset"`
+	Duration    int64         `json:"duration"`
+}
+
+// A Tracer is a query.ExecutionListener that records when each field is resolved,
+// and reports the trace in the tracing entry of the extensions of the response.
+//
+// A Tracer traces a single execution of a query.  Notifications are also passed to
+// the listener it wraps, if any, and the extensions of that listener are reported
+// along with the trace.
+type Tracer struct {
+	listener   query.ExecutionListener
+	start      time.Time
+	parsing    Timing
+	validation Timing
+	resolvers  []*ResolverTrace
+}
+
+var _ query.FieldExecutionListener = &Tracer{}
+var _ query.ExtensionsListener = &Tracer{}
+
+// New creates a Tracer for an execution that began at start, wrapping listener.
+// start is usually the time the request was received, so that the trace covers
+// preparing the query.  If start is zero, the trace begins now.
+func New(start time.Time, listener query.ExecutionListener) *Tracer {
+	if start.IsZero() {
+		start = time.Now()
+	}
+	return &Tracer{listener: listener, start: start, resolvers: []*ResolverTrace{}}
+}
+
+// TracePrepare records the time spent parsing and validating q.  Nothing is
+// recorded if q was prepared before the trace began, for instance if it was taken
+// from a cache.
+func (t *Tracer) TracePrepare(q *query.PreparedQuery) {
+	timings := q.PrepareTimings()
+	if timings.Start.Before(t.start) {
+		return
+	}
+	t.parsing = Timing{t.offset(timings.Start), int64(timings.Parsing)}
+	t.validation = Timing{t.offset(timings.Start.Add(timings.Parsing)), int64(timings.Validation)}
+}
+
+func (t *Tracer) offset(tm time.Time) int64 {
+	return int64(tm.Sub(t.start))
+}
+
+// NotifyResolve passes the notification to the wrapped listener.  Fields are
+// traced by NotifyResolveField, which is called in its place during execution.
+func (t *Tracer) NotifyResolve(queryField *ast.Field, schemaField *schema.FieldDescriptor) (query.ResolveCompleteCallback, error) {
+	if t.listener == nil {
+		return nil, nil
+	}
+	return t.listener.NotifyResolve(queryField, schemaField)
+}
+
+// NotifyResolveField records the start of resolving a field, and returns a
+// callback that records its end
+func (t *Tracer) NotifyResolveField(info *query.FieldInfo) (query.ResolveCompleteCallback, error) {
+	var cb query.ResolveCompleteCallback
+	var err error
+	if fl, ok := t.listener.(query.FieldExecutionListener); ok {
+		cb, err = fl.NotifyResolveField(info)
+	} else if t.listener != nil {
+		cb, err = t.listener.NotifyResolve(info.QueryField, info.SchemaField)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	rt := &ResolverTrace{
+		Path:        info.Path,
+		FieldName:   info.SchemaField.Name(),
+		ReturnType:  schema.Signature(info.SchemaField.Type()),
+		StartOffset: t.offset(start),
+	}
+	if info.ParentType != nil {
+		rt.ParentType = info.ParentType.Name()
+	}
+	t.resolvers = append(t.resolvers, rt)
+	return func(v interface{}, err error) error {
+		rt.Duration = int64(time.Since(start))
+		if cb != nil {
+			return cb(v, err)
+		}
+		return err
+	}, nil
+}
+
+// NotifyIdle passes the notification to the wrapped listener
+func (t *Tracer) NotifyIdle() {
+	if t.listener != nil {
+		t.listener.NotifyIdle()
+	}
+}
+
+// NotifyError passes the notification to the wrapped listener
+func (t *Tracer) NotifyError(err error) {
+	if t.listener != nil {
+		t.listener.NotifyError(err)
+	}
+}
+
+// ResponseExtensions returns the extensions of the wrapped listener, and the trace
+// as the tracing entry.  The trace ends when this is called.
+func (t *Tracer) ResponseExtensions() map[string]interface{} {
+	extensions := make(map[string]interface{})
+	if el, ok := t.listener.(query.ExtensionsListener); ok {
+		for k, v := range el.ResponseExtensions() {
+			extensions[k] = v
+		}
+	}
+	extensions["tracing"] = t.Trace()
+	return extensions
+}
+
+// Trace returns the trace recorded so far, ending now
+func (t *Tracer) Trace() *Trace {
+	end := time.Now()
+	return &Trace{
+		Version:    1,
+		StartTime:  t.start,
+		EndTime:    end,
+		Duration:   t.offset(end),
+		Parsing:    t.parsing,
+		Validation: t.validation,
+		Execution:  ExecutionTrace{t.resolvers},
+	}
+}
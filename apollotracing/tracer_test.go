@@ -0,0 +1,129 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apollotracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/internal/pkg/testschema"
+	"github.com/housecanary/gq/query"
+	"github.com/housecanary/gq/schema"
+	"github.com/housecanary/gq/types"
+)
+
+// slowName resolves the name of an item a millisecond after it is awaited
+func slowName() schema.Resolver {
+	return schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return schema.AsyncValueFunc(func(ctx context.Context) (interface{}, error) {
+			time.Sleep(time.Millisecond)
+			return types.NewString(v.(string)), nil
+		}), nil
+	})
+}
+
+type extensionsListener struct {
+	query.BaseExecutionListener
+	resolved []string
+}
+
+func (l *extensionsListener) NotifyResolve(queryField *ast.Field, schemaField *schema.FieldDescriptor) (query.ResolveCompleteCallback, error) {
+	l.resolved = append(l.resolved, queryField.Alias)
+	return nil, nil
+}
+
+func (l *extensionsListener) ResponseExtensions() map[string]interface{} {
+	return map[string]interface{}{"other": 1}
+}
+
+func TestTracer(t *testing.T) {
+	start := time.Now()
+	q, err := query.PrepareQuery(`{items {name}}`, "", testschema.New(slowName()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener := &extensionsListener{}
+	tracer := New(start, listener)
+	tracer.TracePrepare(q)
+	var response struct {
+		Data       json.RawMessage
+		Extensions struct {
+			Other   int
+			Tracing *Trace
+		}
+	}
+	if err := json.Unmarshal(q.Execute(context.Background(), struct{}{}, nil, tracer), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(response.Data) != `{"items":[{"name":"a"},{"name":"b"}]}` {
+		t.Errorf("Unexpected data %s", response.Data)
+	}
+	if response.Extensions.Other != 1 {
+		t.Errorf("Expected the extensions of the wrapped listener to be reported")
+	}
+	if fmt.Sprint(listener.resolved) != "[items name name]" {
+		t.Errorf("Expected the wrapped listener to be notified, got %v", listener.resolved)
+	}
+
+	trace := response.Extensions.Tracing
+	if trace.Version != 1 || trace.Duration <= 0 || !trace.EndTime.After(trace.StartTime) {
+		t.Errorf("Unexpected trace %+v", trace)
+	}
+	if trace.Parsing.Duration <= 0 || trace.Validation.StartOffset < trace.Parsing.StartOffset+trace.Parsing.Duration {
+		t.Errorf("Unexpected prepare timings %+v %+v", trace.Parsing, trace.Validation)
+	}
+
+	var resolvers []string
+	for _, r := range trace.Execution.Resolvers {
+		resolvers = append(resolvers, fmt.Sprintf("%v %s.%s: %s", r.Path, r.ParentType, r.FieldName, r.ReturnType))
+		if r.StartOffset < trace.Validation.StartOffset || r.StartOffset+r.Duration > trace.Duration {
+			t.Errorf("Resolver %v is outside of the trace", r.Path)
+		}
+	}
+	expected := "[items] Query.items: [Item]; [items 0 name] Item.name: String!; [items 1 name] Item.name: String!"
+	if actual := strings.Join(resolvers, "; "); actual != expected {
+		t.Errorf("Expected resolvers %s, got %s", expected, actual)
+	}
+	for _, r := range trace.Execution.Resolvers[1:] {
+		if r.Duration < int64(time.Millisecond) {
+			t.Errorf("Expected the duration of %v to include awaiting its value, got %d", r.Path, r.Duration)
+		}
+	}
+}
+
+func TestTracerCachedQuery(t *testing.T) {
+	q, err := query.PrepareQuery(`{items {name}}`, "", testschema.New(slowName()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracer := New(time.Time{}, nil)
+	tracer.TracePrepare(q)
+	result := q.ExecuteToValue(context.Background(), struct{}{}, nil, tracer)
+	trace := result.Extensions["tracing"].(*Trace)
+	if trace.Parsing != (Timing{}) || trace.Validation != (Timing{}) {
+		t.Errorf("Expected no prepare timings for a query prepared before the trace, got %+v %+v", trace.Parsing, trace.Validation)
+	}
+	if len(trace.Execution.Resolvers) != 3 {
+		t.Errorf("Expected 3 resolvers, got %d", len(trace.Execution.Resolvers))
+	}
+}
@@ -58,6 +58,8 @@ func (v Arguments) ByName(name string) (argument *Argument, found bool) {
 type Argument struct {
 	Name  string
 	Value Value
+	Row   int
+	Col   int
 }
 
 func (v *Argument) MarshalGraphQL(w io.Writer) error {
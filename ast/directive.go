@@ -43,6 +43,8 @@ func (v Directives) ByName(name string) (directive *Directive, found bool) {
 type Directive struct {
 	Name      string
 	Arguments Arguments
+	Row       int
+	Col       int
 }
 
 func (v *Directive) MarshalGraphQL(w io.Writer) error {
@@ -21,18 +21,16 @@ import (
 type Document struct {
 	OperationDefinitions []*OperationDefinition
 	FragmentDefinitions  []*FragmentDefinition
-	queryOpsByName       map[string]*OperationDefinition
+	opsByName            map[string]*OperationDefinition
 	fragmentDefsByName   map[string]*FragmentDefinition
 }
 
 func (d *Document) AddOperationDefinition(op *OperationDefinition) {
 	d.OperationDefinitions = append(d.OperationDefinitions, op)
-	if d.queryOpsByName == nil {
-		d.queryOpsByName = make(map[string]*OperationDefinition)
-	}
-	if op.OperationType == OperationTypeQuery {
-		d.queryOpsByName[op.Name] = op
+	if d.opsByName == nil {
+		d.opsByName = make(map[string]*OperationDefinition)
 	}
+	d.opsByName[op.Name] = op
 }
 
 func (d *Document) AddFragmentDefinition(frag *FragmentDefinition) {
@@ -43,15 +41,15 @@ func (d *Document) AddFragmentDefinition(frag *FragmentDefinition) {
 	d.fragmentDefsByName[frag.Name] = frag
 }
 
-func (d *Document) LookupQueryOperation(name string) *OperationDefinition {
-	v, ok := d.queryOpsByName[name]
+func (d *Document) LookupOperation(name string) *OperationDefinition {
+	v, ok := d.opsByName[name]
 
 	if ok {
 		return v
 	}
 
-	if len(d.queryOpsByName) == 1 && name == "" {
-		for _, v := range d.queryOpsByName {
+	if len(d.opsByName) == 1 && name == "" {
+		for _, v := range d.opsByName {
 			return v
 		}
 	}
@@ -59,6 +57,14 @@ func (d *Document) LookupQueryOperation(name string) *OperationDefinition {
 	return nil
 }
 
+func (d *Document) LookupQueryOperation(name string) *OperationDefinition {
+	v := d.LookupOperation(name)
+	if v == nil || v.OperationType != OperationTypeQuery {
+		return nil
+	}
+	return v
+}
+
 func (d *Document) LookupFragmentDefinition(name string) *FragmentDefinition {
 	v, ok := d.fragmentDefsByName[name]
 
@@ -69,11 +75,8 @@ func (d *Document) LookupFragmentDefinition(name string) *FragmentDefinition {
 	return nil
 }
 
+// MarshalGraphQL pretty prints the document, see Print
 func (d *Document) MarshalGraphQL(w io.Writer) error {
-	for _, op := range d.OperationDefinitions {
-		if err := op.MarshalGraphQL(w); err != nil {
-			return err
-		}
-	}
-	return nil
+	_, err := io.WriteString(w, Print(d, PrintOptions{}))
+	return err
 }
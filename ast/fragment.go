@@ -14,9 +14,28 @@
 
 package ast
 
+import "io"
+
 type FragmentDefinition struct {
 	Name         string
 	OnType       string
 	Directives   Directives
 	SelectionSet SelectionSet
+	Row          int
+	Col          int
+}
+
+func (v *FragmentDefinition) MarshalGraphQL(w io.Writer) error {
+	if _, err := w.Write([]byte("fragment " + v.Name + " on " + v.OnType)); err != nil {
+		return err
+	}
+
+	if err := v.Directives.MarshalGraphQL(w); err != nil {
+		return err
+	}
+
+	if err := v.SelectionSet.MarshalGraphQL(w); err != nil {
+		return err
+	}
+	return nil
 }
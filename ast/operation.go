@@ -33,6 +33,8 @@ type OperationDefinition struct {
 	VariableDefinitions VariableDefinitions
 	Directives          Directives
 	SelectionSet        SelectionSet
+	Row                 int
+	Col                 int
 }
 
 func (o *OperationDefinition) MarshalGraphQL(w io.Writer) error {
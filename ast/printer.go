@@ -0,0 +1,256 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast
+
+import (
+	"sort"
+	"strings"
+)
+
+// PrintOptions configures how Print formats a document
+type PrintOptions struct {
+	// Canonical prints the document without insignificant whitespace, with the
+	// arguments of each field and directive, and the fragment definitions, sorted
+	// by name.  Documents that differ only in formatting, comments and the order of
+	// arguments print the same, so the output can be used as a cache key or hashed.
+	Canonical bool
+
+	// HideLiterals replaces literal values with placeholders: numbers with 0,
+	// strings with "", lists with [] and input objects with {}.  Booleans, enum
+	// values, null and variables are kept.  This is useful to group queries that
+	// differ only in their inline arguments, e.g. for logging.
+	HideLiterals bool
+}
+
+// Print formats a document, including all of its operation and fragment
+// definitions.  By default the document is pretty printed with an indentation
+// of two spaces.
+func Print(doc *Document, options PrintOptions) string {
+	p := &printer{options: options}
+	p.document(doc)
+	return p.b.String()
+}
+
+type printer struct {
+	b       strings.Builder
+	options PrintOptions
+	depth   int
+}
+
+// choose returns pretty when pretty printing, and canonical otherwise
+func (p *printer) choose(pretty string, canonical string) string {
+	if p.options.Canonical {
+		return canonical
+	}
+	return pretty
+}
+
+func (p *printer) document(doc *Document) {
+	fragments := doc.FragmentDefinitions
+	if p.options.Canonical {
+		fragments = append([]*FragmentDefinition(nil), fragments...)
+		sort.SliceStable(fragments, func(i, j int) bool {
+			return fragments[i].Name < fragments[j].Name
+		})
+	}
+
+	separator := p.choose("\n\n", " ")
+	for i, op := range doc.OperationDefinitions {
+		if i > 0 {
+			p.b.WriteString(separator)
+		}
+		p.operation(op)
+	}
+	for i, frag := range fragments {
+		if i > 0 || len(doc.OperationDefinitions) > 0 {
+			p.b.WriteString(separator)
+		}
+		p.fragment(frag)
+	}
+}
+
+func (p *printer) operation(op *OperationDefinition) {
+	p.b.WriteString(string(op.OperationType))
+	if op.Name != "" {
+		p.b.WriteString(" ")
+		p.b.WriteString(op.Name)
+	}
+	if len(op.VariableDefinitions) > 0 {
+		p.b.WriteString("(")
+		for i, def := range op.VariableDefinitions {
+			if i > 0 {
+				p.b.WriteString(p.choose(", ", " "))
+			}
+			p.b.WriteString("$")
+			p.b.WriteString(def.VariableName)
+			p.b.WriteString(p.choose(": ", ":"))
+			p.b.WriteString(def.Type.Signature())
+			if def.DefaultValue != nil {
+				p.b.WriteString(p.choose(" = ", "="))
+				p.value(def.DefaultValue)
+			}
+			p.directives(def.Directives)
+		}
+		p.b.WriteString(")")
+	}
+	p.directives(op.Directives)
+	p.selectionSet(op.SelectionSet)
+}
+
+func (p *printer) fragment(frag *FragmentDefinition) {
+	p.b.WriteString("fragment ")
+	p.b.WriteString(frag.Name)
+	p.b.WriteString(" on ")
+	p.b.WriteString(frag.OnType)
+	p.directives(frag.Directives)
+	p.selectionSet(frag.SelectionSet)
+}
+
+func (p *printer) selectionSet(selections SelectionSet) {
+	p.b.WriteString(p.choose(" {", "{"))
+	p.depth++
+	for i, sel := range selections {
+		if p.options.Canonical {
+			if i > 0 {
+				p.b.WriteString(" ")
+			}
+		} else {
+			p.newline()
+		}
+		p.selection(sel)
+	}
+	p.depth--
+	if !p.options.Canonical {
+		p.newline()
+	}
+	p.b.WriteString("}")
+}
+
+func (p *printer) newline() {
+	p.b.WriteString("\n")
+	for i := 0; i < p.depth; i++ {
+		p.b.WriteString("  ")
+	}
+}
+
+func (p *printer) selection(sel Selection) {
+	switch s := sel.(type) {
+	case *FieldSelection:
+		f := &s.Field
+		if f.Alias != "" && f.Alias != f.Name {
+			p.b.WriteString(f.Alias)
+			p.b.WriteString(p.choose(": ", ":"))
+		}
+		p.b.WriteString(f.Name)
+		p.arguments(f.Arguments)
+		p.directives(f.Directives)
+		if len(f.SelectionSet) > 0 {
+			p.selectionSet(f.SelectionSet)
+		}
+	case *FragmentSpreadSelection:
+		p.b.WriteString("...")
+		p.b.WriteString(s.FragmentName)
+		p.directives(s.Directives)
+	case *InlineFragmentSelection:
+		p.b.WriteString("...")
+		if s.OnType != "" {
+			p.b.WriteString(" on ")
+			p.b.WriteString(s.OnType)
+		}
+		p.directives(s.Directives)
+		p.selectionSet(s.SelectionSet)
+	}
+}
+
+func (p *printer) directives(directives Directives) {
+	for _, d := range directives {
+		p.b.WriteString(p.choose(" @", "@"))
+		p.b.WriteString(d.Name)
+		p.arguments(d.Arguments)
+	}
+}
+
+func (p *printer) arguments(args Arguments) {
+	if len(args) == 0 {
+		return
+	}
+	if p.options.Canonical {
+		args = append(Arguments(nil), args...)
+		sort.SliceStable(args, func(i, j int) bool {
+			return args[i].Name < args[j].Name
+		})
+	}
+	p.b.WriteString("(")
+	for i, arg := range args {
+		if i > 0 {
+			p.b.WriteString(p.choose(", ", " "))
+		}
+		p.b.WriteString(arg.Name)
+		p.b.WriteString(p.choose(": ", ":"))
+		p.value(arg.Value)
+	}
+	p.b.WriteString(")")
+}
+
+func (p *printer) value(val Value) {
+	switch v := val.(type) {
+	case IntValue, FloatValue:
+		if p.options.HideLiterals {
+			p.b.WriteString("0")
+			return
+		}
+	case StringValue:
+		if p.options.HideLiterals {
+			p.b.WriteString(`""`)
+			return
+		}
+	case ArrayValue:
+		if p.options.HideLiterals {
+			p.b.WriteString("[]")
+			return
+		}
+		p.b.WriteString("[")
+		for i, e := range v.V {
+			if i > 0 {
+				p.b.WriteString(p.choose(", ", " "))
+			}
+			p.value(e)
+		}
+		p.b.WriteString("]")
+		return
+	case ObjectValue:
+		if p.options.HideLiterals {
+			p.b.WriteString("{}")
+			return
+		}
+		keys := make([]string, 0, len(v.V))
+		for k := range v.V {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		p.b.WriteString("{")
+		for i, k := range keys {
+			if i > 0 {
+				p.b.WriteString(p.choose(", ", " "))
+			}
+			p.b.WriteString(k)
+			p.b.WriteString(p.choose(": ", ":"))
+			p.value(v.V[k])
+		}
+		p.b.WriteString("}")
+		return
+	}
+	p.b.WriteString(val.Representation())
+}
@@ -60,6 +60,8 @@ func (v *FieldSelection) MarshalGraphQL(w io.Writer) error {
 type FragmentSpreadSelection struct {
 	FragmentName string
 	Directives   Directives
+	Row          int
+	Col          int
 }
 
 func (v *FragmentSpreadSelection) MarshalGraphQL(w io.Writer) error {
@@ -81,14 +83,22 @@ type InlineFragmentSelection struct {
 	OnType       string
 	Directives   Directives
 	SelectionSet SelectionSet
+	Row          int
+	Col          int
 }
 
 func (v *InlineFragmentSelection) MarshalGraphQL(w io.Writer) error {
-	if _, err := w.Write([]byte("... on ")); err != nil {
+	if _, err := w.Write([]byte("...")); err != nil {
 		return err
 	}
 
-	if _, err := w.Write([]byte(v.OnType)); err != nil {
+	if v.OnType != "" {
+		if _, err := w.Write([]byte(" on " + v.OnType)); err != nil {
+			return err
+		}
+	}
+
+	if err := v.Directives.MarshalGraphQL(w); err != nil {
 		return err
 	}
 
@@ -16,6 +16,7 @@ package ast
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -169,15 +170,18 @@ func (ObjectValue) isValue() {}
 func (v ObjectValue) Representation() string {
 	var s strings.Builder
 	s.WriteString("{")
-	var i = 0
-	for k, v := range v.V {
+	keys := make([]string, 0, len(v.V))
+	for k := range v.V {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
 		if i > 0 {
 			s.WriteString(", ")
 		}
-		i++
 		s.WriteString(k)
 		s.WriteString(": ")
-		s.WriteString(v.Representation())
+		s.WriteString(v.V[k].Representation())
 	}
 	s.WriteString("}")
 	return s.String()
@@ -51,6 +51,8 @@ type VariableDefinition struct {
 	Type         Type
 	DefaultValue Value
 	Directives   Directives
+	Row          int
+	Col          int
 }
 
 func (v *VariableDefinition) MarshalGraphQL(w io.Writer) error {
@@ -111,6 +111,7 @@ func (v *BaseASTBuilderVisitor) VisitDirective(ctx *gen.DirectiveContext) interf
 	if c := ctx.Arguments(); c != nil {
 		directive.Arguments = c.Accept(v).(ast.Arguments)
 	}
+	directive.Row, directive.Col = location(ctx)
 	return &directive
 }
 
@@ -126,6 +127,7 @@ func (v *BaseASTBuilderVisitor) VisitArgument(ctx *gen.ArgumentContext) interfac
 	var argument ast.Argument
 	argument.Name = ctx.Name().Accept(v).(string)
 	argument.Value = ctx.ValueWithVariable().Accept(v).(ast.Value)
+	argument.Row, argument.Col = location(ctx)
 	return &argument
 }
 
@@ -60,3 +60,8 @@ func safeParse(input string, cb func(*gen.GraphqlParser)) (err ParseError) {
 	cb(p)
 	return
 }
+
+// location returns the 1 based row and column of the start of a parse tree node
+func location(ctx antlr.ParserRuleContext) (row, col int) {
+	return ctx.GetStart().GetLine(), ctx.GetStart().GetColumn() + 1
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"testing"
+
+	"github.com/housecanary/gq/ast"
+)
+
+const printTestQuery = `# Find users
+query Users($first: Int = 10, $show: Boolean!) {
+  all: users(first: $first, filter: {name: "a", age: 3}) @include(if: $show) {
+    ...UserFields
+    ... @skip(if: false) { id }
+  }
+}
+
+fragment UserFields on User {
+  name(format: UPPER, length: 20)
+  ... on Admin { level }
+}
+
+query Other { node(id: "x") { id } }
+`
+
+func TestPrintPretty(t *testing.T) {
+	doc, err := ParseQuery(printTestQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `query Users($first: Int = 10, $show: Boolean!) {
+  all: users(first: $first, filter: {age: 3, name: "a"}) @include(if: $show) {
+    ...UserFields
+    ... @skip(if: false) {
+      id
+    }
+  }
+}
+
+query Other {
+  node(id: "x") {
+    id
+  }
+}
+
+fragment UserFields on User {
+  name(format: UPPER, length: 20)
+  ... on Admin {
+    level
+  }
+}`
+	if s := ast.Print(doc, ast.PrintOptions{}); s != expected {
+		t.Errorf("Got:\n%s\nexpected:\n%s", s, expected)
+	}
+
+	// A pretty printed document parses back to the same document
+	reparsed, err := ParseQuery(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := ast.Print(reparsed, ast.PrintOptions{}); s != expected {
+		t.Errorf("Got:\n%s\nexpected:\n%s", s, expected)
+	}
+}
+
+func TestPrintCanonical(t *testing.T) {
+	expected := `query Users($first:Int=10 $show:Boolean!){all:users(filter:{age:3 name:"a"} first:$first)@include(if:$show){...UserFields ...@skip(if:false){id}}} ` +
+		`query Other{node(id:"x"){id}} fragment UserFields on User{name(format:UPPER length:20) ... on Admin{level}}`
+	for _, text := range []string{
+		printTestQuery,
+		`query Users($first:Int=10,$show:Boolean!){all:users(filter:{age:3,name:"a"},first:$first)@include(if:$show){...UserFields,...@skip(if:false){id}}}
+		fragment UserFields on User{name(length:20,format:UPPER),...on Admin{level}}
+		query Other{node(id:"x"){id}}`,
+	} {
+		doc, err := ParseQuery(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := ast.Print(doc, ast.PrintOptions{Canonical: true}); s != expected {
+			t.Errorf("Got:\n%s\nexpected:\n%s", s, expected)
+		}
+	}
+
+	if _, err := ParseQuery(expected); err != nil {
+		t.Errorf("Canonical document does not parse: %v", err)
+	}
+}
+
+func TestPrintHideLiterals(t *testing.T) {
+	doc, err := ParseQuery(`query ($n: Int = 5) { users(first: $n, name: "bob", tags: ["a"], filter: {age: 3}, active: true, sort: NAME, after: null) { id(scale: 1.5) } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `query($n:Int=0){users(active:true after:null filter:{} first:$n name:"" sort:NAME tags:[]){id(scale:0)}}`
+	if s := ast.Print(doc, ast.PrintOptions{Canonical: true, HideLiterals: true}); s != expected {
+		t.Errorf("Got:\n%s\nexpected:\n%s", s, expected)
+	}
+}
@@ -49,6 +49,7 @@ func (v *queryDocumentVisitor) VisitOperationDefinition(ctx *gen.OperationDefini
 	}
 
 	op.SelectionSet = ctx.SelectionSet().Accept(v).(ast.SelectionSet)
+	op.Row, op.Col = location(ctx)
 
 	return &op
 }
@@ -71,6 +72,7 @@ func (v *queryDocumentVisitor) VisitVariableDefinition(ctx *gen.VariableDefiniti
 	if c := ctx.Directives(); c != nil {
 		def.Directives = c.Accept(v).(ast.Directives)
 	}
+	def.Row, def.Col = location(ctx)
 	return &def
 }
 
@@ -115,8 +117,7 @@ func (v *queryDocumentVisitor) VisitField(ctx *gen.FieldContext) interface{} {
 	if c := ctx.SelectionSet(); c != nil {
 		f.SelectionSet = c.Accept(v).(ast.SelectionSet)
 	}
-	f.Row = ctx.GetStart().GetLine() + 1
-	f.Col = ctx.GetStart().GetColumn() + 1
+	f.Row, f.Col = location(ctx)
 	return &ast.FieldSelection{Field: f}
 }
 
@@ -130,6 +131,7 @@ func (v *queryDocumentVisitor) VisitFragmentSpread(ctx *gen.FragmentSpreadContex
 	if c := ctx.Directives(); c != nil {
 		f.Directives = c.Accept(v).(ast.Directives)
 	}
+	f.Row, f.Col = location(ctx)
 	return &f
 }
 
@@ -142,6 +144,7 @@ func (v *queryDocumentVisitor) VisitInlineFragment(ctx *gen.InlineFragmentContex
 		f.Directives = c.Accept(v).(ast.Directives)
 	}
 	f.SelectionSet = ctx.SelectionSet().Accept(v).(ast.SelectionSet)
+	f.Row, f.Col = location(ctx)
 	return &f
 }
 
@@ -153,6 +156,7 @@ func (v *queryDocumentVisitor) VisitFragmentDefinition(ctx *gen.FragmentDefiniti
 		f.Directives = c.Accept(v).(ast.Directives)
 	}
 	f.SelectionSet = ctx.SelectionSet().Accept(v).(ast.SelectionSet)
+	f.Row, f.Col = location(ctx)
 	return &f
 }
 
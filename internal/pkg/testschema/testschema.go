@@ -0,0 +1,75 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testschema builds the schema shared by the tests of the packages that
+// serve and trace queries.
+package testschema
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+	"github.com/housecanary/gq/types"
+)
+
+// New builds a schema whose Query type has the fields:
+//
+//	hello(name: String = "World"): String   greets name
+//	fail: String                            fails with the error "Failed"
+//	list: [String]                          is ["a", "b"]
+//	items: [Item]                           has two items, keyed "a" and "b"
+//
+// The name field of Item, of type String!, is resolved by itemName from the key
+// of the item, or is the key if itemName is nil.  Incremental delivery is enabled.
+func New(itemName schema.Resolver) *schema.Schema {
+	if itemName == nil {
+		itemName = schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+			return types.NewString(v.(string)), nil
+		})
+	}
+
+	builder := schema.NewBuilder()
+	builder.AddScalarType("String", schema.EncodeScalarMarshaler, func(ctx context.Context, in schema.LiteralValue) (interface{}, error) {
+		if in == nil {
+			return types.NilString(), nil
+		}
+		return types.NewString(string(in.(schema.LiteralString))), nil
+	}, nil)
+	builder.AddScalarType("Int", schema.EncodeScalarMarshaler, nil, nil)
+	builder.AddScalarType("Boolean", schema.EncodeScalarMarshaler, nil, nil)
+	item := builder.AddObjectType("Item")
+	item.AddField("name", &ast.NotNilType{Of: &ast.SimpleType{Name: "String"}}, itemName)
+	qt := builder.AddObjectType("Query")
+	hello := qt.AddField("hello", &ast.SimpleType{Name: "String"}, schema.FullResolver(func(ctx schema.ResolverContext, v interface{}) (interface{}, error) {
+		name, err := ctx.GetArgumentValue("name")
+		if err != nil {
+			return nil, err
+		}
+		return types.NewString(fmt.Sprintf("Hello %v", name.(types.String).String())), nil
+	}))
+	hello.AddArgument("name", &ast.SimpleType{Name: "String"}, ast.StringValue{V: "World"})
+	qt.AddField("fail", &ast.SimpleType{Name: "String"}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("Failed")
+	}))
+	qt.AddField("list", &ast.ListType{Of: &ast.SimpleType{Name: "String"}}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return schema.ListOf(types.NewString("a"), types.NewString("b")), nil
+	}))
+	qt.AddField("items", &ast.ListType{Of: &ast.SimpleType{Name: "Item"}}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return schema.ListOf("a", "b"), nil
+	}))
+	builder.EnableIncrementalDelivery()
+	return builder.MustBuild("Query")
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"sync"
+
+	"github.com/housecanary/gq/schema"
+)
+
+// An awaitPool awaits async values concurrently on a bounded number of goroutines.
+// Workers are started as values are submitted, and exit once there is nothing left
+// to await, so an idle pool holds no goroutines.
+type awaitPool struct {
+	mu      sync.Mutex
+	queue   []func()
+	workers int
+	max     int
+}
+
+// An awaitResult is the result of awaiting an async value
+type awaitResult struct {
+	value interface{}
+	err   error
+}
+
+func newAwaitPool(max int) *awaitPool {
+	return &awaitPool{max: max}
+}
+
+// await starts awaiting value, and returns a channel that receives the result
+func (p *awaitPool) await(ctx exeContext, value schema.AsyncValue) <-chan awaitResult {
+	result := make(chan awaitResult, 1)
+	p.submit(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- awaitResult{nil, newPanicError(r)}
+			}
+		}()
+		v, err := value.Await(ctx)
+		result <- awaitResult{v, err}
+	})
+	return result
+}
+
+func (p *awaitPool) submit(task func()) {
+	p.mu.Lock()
+	p.queue = append(p.queue, task)
+	if p.workers < p.max {
+		p.workers++
+		p.mu.Unlock()
+		go p.work()
+		return
+	}
+	p.mu.Unlock()
+}
+
+func (p *awaitPool) work() {
+	for {
+		p.mu.Lock()
+		if len(p.queue) == 0 {
+			p.workers--
+			p.mu.Unlock()
+			return
+		}
+		task := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		p.mu.Unlock()
+		task()
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/housecanary/gq/schema"
+	"github.com/housecanary/gq/types"
+)
+
+// concurrencyTracker records the maximum number of values awaited at once
+type concurrencyTracker struct {
+	current int32
+	max     int32
+}
+
+// A trackedItem is an item of the items field, whose fields are awaited by the
+// tracker passed as the root value of the query
+type trackedItem struct {
+	tracker *concurrencyTracker
+	n       int
+}
+
+// trackedResolver resolves a field of a trackedItem, recording the number of
+// values awaited at once in the tracker of the item
+func trackedResolver(value string) schema.Resolver {
+	return schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		item := v.(trackedItem)
+		c := item.tracker
+		return schema.AsyncValueFunc(func(ctx context.Context) (interface{}, error) {
+			n := atomic.AddInt32(&c.current, 1)
+			for {
+				max := atomic.LoadInt32(&c.max)
+				if n <= max || atomic.CompareAndSwapInt32(&c.max, max, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&c.current, -1)
+			return types.NewString(fmt.Sprintf("%s %v", value, item.n)), nil
+		}), nil
+	})
+}
+
+func TestConcurrentAwaits(t *testing.T) {
+	expected := `{"data":{"items":[{"a":"a 1","b":"b 1"},{"a":"a 2","b":"b 2"},{"a":"a 3","b":"b 3"}],"panic":null},` +
+		`"errors":[{"message":"Await failed","path":["panic"],"locations":[{"line":1,"column":14}]}]}`
+	for _, c := range []struct {
+		opts        []ExecutionOption
+		concurrency int32
+	}{
+		{nil, 1},
+		{[]ExecutionOption{WithConcurrentAwaits(4)}, 4},
+		{[]ExecutionOption{WithConcurrentAwaits(100)}, 6},
+	} {
+		tracker := &concurrencyTracker{}
+		q, err := PrepareQuery(`{items {a b} panic}`, "", buildTestSchema())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := string(q.Execute(context.Background(), tracker, nil, nil, c.opts...))
+		if result != expected {
+			t.Errorf("Expected result\n%s\ngot\n%s", expected, result)
+		}
+		if tracker.max != c.concurrency {
+			t.Errorf("Expected %d values to be awaited at once, got %d", c.concurrency, tracker.max)
+		}
+	}
+}
+
+func TestConcurrentAwaitsBatch(t *testing.T) {
+	for _, c := range []struct {
+		opts        []ExecutionOption
+		concurrency int32
+		idleCount   int
+	}{
+		{nil, 1, 1},
+		{[]ExecutionOption{WithConcurrentAwaits(5)}, 5, 1},
+	} {
+		tracker := &concurrencyTracker{}
+		s := buildTestSchema()
+		var batch Batch
+		for i := 0; i < 3; i++ {
+			q, err := PrepareQuery(`{items {a}}`, "", s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			batch.Add(q, tracker, nil)
+		}
+
+		listener := &idleCountExecutionListener{}
+		results := batch.Execute(context.Background(), listener, c.opts...)
+		for _, result := range results {
+			if string(result) != `{"data":{"items":[{"a":"a 1"},{"a":"a 2"},{"a":"a 3"}]}}` {
+				t.Errorf("Unexpected result %s", result)
+			}
+		}
+		if tracker.max != c.concurrency {
+			t.Errorf("Expected %d values to be awaited at once, got %d", c.concurrency, tracker.max)
+		}
+		// The values of all queries are awaited and selected in the same round
+		if listener.idleCount != c.idleCount {
+			t.Errorf("Expected idle count %d, got %d", c.idleCount, listener.idleCount)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"strconv"
+
+	"github.com/housecanary/gq/schema"
+)
+
+// A CacheScope says who may cache a result
+type CacheScope string
+
+const (
+	// CacheScopePublic allows a result to be cached by shared caches, such as a
+	// CDN, and served to any client
+	CacheScopePublic CacheScope = "PUBLIC"
+
+	// CacheScopePrivate allows a result to be cached only by the client that
+	// requested it
+	CacheScopePrivate CacheScope = "PRIVATE"
+)
+
+// A CachePolicy says how long, and by whom, the result of a query may be cached.
+// See WithCachePolicy.
+type CachePolicy struct {
+	// MaxAge is the number of seconds the result may be cached for.  The result
+	// must not be cached if it is zero.
+	MaxAge int
+
+	// Scope says who may cache the result
+	Scope CacheScope
+}
+
+// Cacheable returns whether a result with this policy may be cached at all
+func (p CachePolicy) Cacheable() bool {
+	return p.MaxAge > 0
+}
+
+// Restrict returns the policy of a response made of results with policies p and
+// other: the smaller maxAge of the two, and the private scope if either is private.
+func (p CachePolicy) Restrict(other CachePolicy) CachePolicy {
+	if other.MaxAge < p.MaxAge {
+		p.MaxAge = other.MaxAge
+	}
+	if other.Scope == CacheScopePrivate {
+		p.Scope = CacheScopePrivate
+	}
+	return p
+}
+
+// Header returns the value of the HTTP Cache-Control header matching this policy
+func (p CachePolicy) Header() string {
+	if !p.Cacheable() {
+		return "no-store"
+	}
+	scope := "public"
+	if p.Scope == CacheScopePrivate {
+		scope = "private"
+	}
+	return "max-age=" + strconv.Itoa(p.MaxAge) + ", " + scope
+}
+
+// A cacheHint is the @cacheControl hint of a query field, compiled from the
+// directives of the schema field and the type it returns
+type cacheHint struct {
+	// MaxAge is the maxAge given by a directive, or -1 if none was given
+	MaxAge int
+
+	// Inherit is set for fields that do not restrict the maxAge of the result:
+	// fields returning scalars and enums with no maxAge of their own, whose values
+	// are cached along with the objects they belong to
+	Inherit bool
+
+	Private bool
+}
+
+// buildCacheHint builds the cache hint of field.  A maxAge on the field takes
+// precedence over one on the type it returns.  Root fields and fields returning
+// composite types use the default maxAge if they have no hint.
+func buildCacheHint(field *schema.FieldDescriptor, root bool) cacheHint {
+	hint := cacheHint{MaxAge: -1}
+	typ := field.Type()
+	for {
+		if t, ok := typ.(interface{ Unwrap() schema.Type }); ok {
+			typ = t.Unwrap()
+			continue
+		}
+		break
+	}
+
+	composite := false
+	switch t := typ.(type) {
+	case *schema.ObjectType:
+		composite = true
+		hint.apply(t.GetDirective(schema.CacheControlDirective.Name()))
+	case *schema.InterfaceType:
+		composite = true
+		hint.apply(t.GetDirective(schema.CacheControlDirective.Name()))
+	case *schema.UnionType:
+		composite = true
+		hint.apply(t.GetDirective(schema.CacheControlDirective.Name()))
+	}
+	hint.apply(field.GetDirective(schema.CacheControlDirective.Name()))
+
+	hint.Inherit = hint.MaxAge < 0 && !composite && !root
+	return hint
+}
+
+// apply applies the arguments of a @cacheControl directive to the hint
+func (h *cacheHint) apply(d *schema.Directive) {
+	if d == nil {
+		return
+	}
+	if arg := d.Argument("maxAge"); arg != nil {
+		if v, ok := arg.Value().(schema.LiteralNumber); ok && v >= 0 {
+			h.MaxAge = int(v)
+		}
+	}
+	if arg := d.Argument("scope"); arg != nil {
+		if v, ok := arg.Value().(schema.LiteralString); ok && CacheScope(v) == CacheScopePrivate {
+			h.Private = true
+		}
+	}
+}
+
+// A cachePolicyTracker computes the cache policy of a result from the hints of
+// the fields resolved while executing a query
+type cachePolicyTracker struct {
+	defaultMaxAge int
+	maxAge        int
+	restricted    bool
+	private       bool
+
+	// hints lists the hints of the resolved fields for the cacheControl
+	// extension, if it is enabled
+	extension bool
+	hints     []interface{}
+}
+
+func newCachePolicyTracker(options *executionOptions) *cachePolicyTracker {
+	if options.cachePolicy == nil && !options.cacheControlExtension {
+		return nil
+	}
+	return &cachePolicyTracker{defaultMaxAge: options.defaultMaxAge, extension: options.cacheControlExtension}
+}
+
+// add records the hint of a field resolved in ctx
+func (t *cachePolicyTracker) add(ctx exeContext, hint cacheHint) {
+	if hint.Inherit && !hint.Private {
+		return
+	}
+	maxAge := hint.MaxAge
+	if maxAge < 0 {
+		maxAge = t.defaultMaxAge
+	}
+	if !hint.Inherit && (!t.restricted || maxAge < t.maxAge) {
+		t.maxAge = maxAge
+		t.restricted = true
+	}
+	if hint.Private {
+		t.private = true
+	}
+
+	if t.extension {
+		entry := map[string]interface{}{"path": ctx.path.slice()}
+		if !hint.Inherit {
+			entry["maxAge"] = maxAge
+		}
+		if hint.Private {
+			entry["scope"] = CacheScopePrivate
+		}
+		t.hints = append(t.hints, entry)
+	}
+}
+
+// policy returns the cache policy of the result.  A result with errors, or one
+// that no field restricted, is not cacheable.
+func (t *cachePolicyTracker) policy(hasErrors bool) CachePolicy {
+	p := CachePolicy{Scope: CacheScopePublic}
+	if t.private {
+		p.Scope = CacheScopePrivate
+	}
+	if t.restricted && !hasErrors {
+		p.MaxAge = t.maxAge
+	}
+	return p
+}
+
+// extensionValue returns the value of the cacheControl response extension, in the
+// format used by Apollo Server
+func (t *cachePolicyTracker) extensionValue() map[string]interface{} {
+	hints := t.hints
+	if hints == nil {
+		hints = []interface{}{}
+	}
+	return map[string]interface{}{"version": 1, "hints": hints}
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/housecanary/gq/schema"
+)
+
+func TestCachePolicy(t *testing.T) {
+	s := buildTestSchema()
+	for _, c := range []struct {
+		query         string
+		vars          Variables
+		defaultMaxAge int
+		expected      CachePolicy
+	}{
+		{`{post {title}}`, nil, 0, CachePolicy{30, CacheScopePublic}},
+		{`{post {title} user {name}}`, nil, 0, CachePolicy{30, CacheScopePublic}},
+		{`{user {name email}}`, nil, 0, CachePolicy{60, CacheScopePrivate}},
+		{`{post {author {name}}}`, nil, 0, CachePolicy{0, CacheScopePublic}},
+		{`{post {author {name}}}`, nil, 300, CachePolicy{30, CacheScopePublic}},
+		{`{version}`, nil, 0, CachePolicy{0, CacheScopePublic}},
+		{`{version}`, nil, 10, CachePolicy{10, CacheScopePublic}},
+		{`{fail}`, nil, 0, CachePolicy{0, CacheScopePublic}},
+		{`query ($s: Boolean!) {post {title} version @include(if: $s)}`, Variables{"s": schema.LiteralBool(false)}, 0, CachePolicy{30, CacheScopePublic}},
+		{`query ($s: Boolean!) {post {title} version @include(if: $s)}`, nil, 0, CachePolicy{0, CacheScopePublic}},
+	} {
+		q, err := PrepareQuery(c.query, "", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var policies []CachePolicy
+		opts := []ExecutionOption{
+			WithCachePolicy(func(p CachePolicy) { policies = append(policies, p) }),
+			WithDefaultMaxAge(c.defaultMaxAge),
+		}
+		q.Execute(context.Background(), struct{}{}, c.vars, nil, opts...)
+		q.ExecuteTo(context.Background(), io.Discard, struct{}{}, c.vars, nil, opts...)
+		q.ExecuteToValue(context.Background(), struct{}{}, c.vars, nil, opts...)
+		var batch Batch
+		batch.Add(q, struct{}{}, c.vars)
+		batch.Execute(context.Background(), nil, opts...)
+
+		expected := []CachePolicy{c.expected, c.expected, c.expected, c.expected}
+		if !reflect.DeepEqual(policies, expected) {
+			t.Errorf("Expected policies %v for %s, got %v", expected, c.query, policies)
+		}
+	}
+}
+
+func TestCachePolicyHeader(t *testing.T) {
+	for _, c := range []struct {
+		policy   CachePolicy
+		expected string
+	}{
+		{CachePolicy{60, CacheScopePublic}, "max-age=60, public"},
+		{CachePolicy{30, CacheScopePrivate}, "max-age=30, private"},
+		{CachePolicy{0, CacheScopePublic}, "no-store"},
+		{CachePolicy{60, CacheScopePublic}.Restrict(CachePolicy{90, CacheScopePrivate}), "max-age=60, private"},
+	} {
+		if h := c.policy.Header(); h != c.expected {
+			t.Errorf("Expected header %s for %v, got %s", c.expected, c.policy, h)
+		}
+	}
+}
+
+func TestCacheControlExtension(t *testing.T) {
+	q, err := PrepareQuery(`{user {name email} post {title}}`, "", buildTestSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := q.Execute(context.Background(), struct{}{}, nil, nil, WithCacheControlExtension())
+	expected := `{"data":{"user":{"name":"user","email":"user@example.com"},"post":{"title":"post"}},"extensions":{"cacheControl":{"hints":[{"maxAge":60,"path":["user"]},{"path":["user","email"],"scope":"PRIVATE"},{"maxAge":30,"path":["post"]}],"version":1}}}`
+	if string(result) != expected {
+		t.Errorf("Expected result\n%s\ngot\n%s", expected, result)
+	}
+
+	value := q.ExecuteToValue(context.Background(), struct{}{}, nil, nil, WithCacheControlExtension())
+	b, err := json.Marshal(value.Extensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"cacheControl":{"hints":[{"maxAge":60,"path":["user"]},{"path":["user","email"],"scope":"PRIVATE"},{"maxAge":30,"path":["post"]}],"version":1}}`; string(b) != expected {
+		t.Errorf("Expected extensions %s, got %s", expected, b)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExecutionDeadline(t *testing.T) {
+	s := buildTestSchema()
+	for _, c := range []struct {
+		query    string
+		expected string
+	}{
+		// sleep is not awaited once wait has timed out
+		{`{foo wait sleep {name}}`, `{"data":{"foo":"bar","wait":null,"sleep":null},"errors":[` +
+			`{"message":"Execution timed out","path":["wait"],"locations":[{"line":1,"column":6}],"extensions":{"code":"TIMEOUT"}},` +
+			`{"message":"Execution timed out","path":["sleep"],"locations":[{"line":1,"column":11}],"extensions":{"code":"TIMEOUT"}}]}`},
+		// The fields of sleep are not resolved if it resolves after the deadline
+		{`{foo sleep {name}}`, `{"data":{"foo":"bar","sleep":{"name":null}},"errors":[` +
+			`{"message":"Execution timed out","path":["sleep","name"],"locations":[{"line":1,"column":13}],"extensions":{"code":"TIMEOUT"}}]}`},
+	} {
+		q, err := PrepareQuery(c.query, "", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		result := string(q.Execute(ctx, &Query{}, nil, nil))
+		cancel()
+		if result != c.expected {
+			t.Errorf("Expected result\n%s\ngot\n%s", c.expected, result)
+		}
+	}
+}
+
+func TestExecutionCancelled(t *testing.T) {
+	q, err := PrepareQuery(`{foo required}`, "", buildTestSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := q.ExecuteToValue(ctx, &Query{}, nil, nil)
+	if result.Data != nil {
+		t.Errorf("Expected no data, got %v", result.Data)
+	}
+	if len(result.Errors) != 2 {
+		t.Fatalf("Expected 2 errors, got %v", result.Errors)
+	}
+	var ce *CodedError
+	if !errors.As(result.Errors[1], &ce) || ce.Code != ErrorCodeCancelled || !errors.Is(ce, context.Canceled) {
+		t.Errorf("Expected a cancelled error, got %v", result.Errors[1])
+	}
+}
+
+func TestExecutionWithoutContext(t *testing.T) {
+	q, err := PrepareQuery(`{foo}`, "", buildTestSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := string(q.Execute(nil, &Query{}, nil, nil)); result != `{"data":{"foo":"bar"}}` {
+		t.Errorf("Unexpected result %s", result)
+	}
+}
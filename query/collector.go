@@ -19,6 +19,8 @@ import (
 	"sync"
 
 	jsonstream "github.com/json-iterator/go"
+
+	"github.com/housecanary/gq/ast"
 )
 
 // MaxPooledArrayCollectorSize sets the threshold for reusing an array collector
@@ -30,20 +32,20 @@ var MaxPooledObjectCollectorSize = 100
 // A collector is responsible for collecting the results of a field in the selection tree
 // It can have sub collectors, or errors reported to it
 //
-// The only collector implementation currently is a collector that serializes to
-// JSON.  Since there's no client support for other serializations of the GraphQL
-// model this is sufficient, but the collector interface allows us to add further
-// serializations in the future if needed.
+// There are two collector implementations: one that serializes to JSON, and one
+// that builds Go values for in process callers (see ExecuteToValue).  The collector
+// interface allows us to add further serializations in the future if needed.
 //
-// In addition, the collector model is not tied to a one time serialization, and could
-// be used to implement subscriptions or streaming results in the future.
+// In addition, the collector model is not tied to a one time serialization.  Subscriptions
+// use a fresh collector for each event, and it could be used to implement streaming results
+// in the future.
 type collector interface {
 	Int(v int64)
 	Float(v float64)
 	Bool(v bool)
 	String(v string)
-	Error(err error, row, col int)
-	Required(row, col int)
+	Error(err error, field *ast.Field)
+	Required(field *ast.Field)
 	Object(sizeHint int) objectCollector
 	Array(sizeHint int) arrayCollector
 }
@@ -67,24 +69,59 @@ var streamPool = jsonstream.NewStream(
 	}.Froze(), nil, 0,
 ).Pool()
 
+// sortedJSON serializes extensions with sorted map keys, so that responses do not
+// depend on the iteration order of maps
+var sortedJSON = jsonstream.Config{
+	EscapeHTML:  true,
+	SortMapKeys: true,
+}.Froze()
+
+// writeSortedVal writes v to stream, sorting the keys of any maps it contains
+func writeSortedVal(stream *jsonstream.Stream, v interface{}) {
+	sorted := sortedJSON.BorrowStream(nil)
+	sorted.WriteVal(v)
+	// Append directly rather than using stream.Write, which flushes on every call
+	// when the stream has a writer
+	stream.SetBuffer(append(stream.Buffer(), sorted.Buffer()...))
+	if sorted.Error != nil && stream.Error == nil {
+		stream.Error = sorted.Error
+	}
+	sortedJSON.ReturnStream(sorted)
+}
+
 type gqlError struct {
 	error
-	path []interface{}
-	row  int
-	col  int
+	path  []interface{}
+	field *ast.Field
 }
 
 // constructs a gqlError with an empty path that will be filled
 // as the error bubbles up the call stack
-func pe(err error, depth int, row, col int) gqlError {
-	return gqlError{err, make([]interface{}, depth), row, col}
+func pe(err error, depth int, field *ast.Field) gqlError {
+	return gqlError{err, make([]interface{}, depth), field}
 }
 
+// A jsonCollector is serialized in two passes.  First settle gathers the errors of
+// the collected values and applies null propagation, returning false if a required
+// value is missing.  Then writeJSON writes the settled values; since every failed
+// value has been replaced by null, nothing written ever needs to be retracted, and
+// output can be flushed while writing.
 type jsonCollector interface {
-	serializeJSON(stream *jsonstream.Stream, depth int) ([]gqlError, bool)
+	settle(depth int) ([]gqlError, bool)
+	writeJSON(stream *jsonstream.Stream)
 	release()
 }
 
+// jsonFlushThreshold is the amount of buffered output at which a stream writing to
+// an io.Writer is flushed
+const jsonFlushThreshold = 32 * 1024
+
+func flushIfFull(stream *jsonstream.Stream) {
+	if stream.Buffered() >= jsonFlushThreshold {
+		stream.Flush()
+	}
+}
+
 var _ collector = &vJSONCollector{}
 
 // Pool so we can reuse array collectors. Avoids allocating the items arrays over and over.
@@ -133,44 +170,43 @@ type vJSONCollector struct {
 
 // edat stores an error and location information
 type edat struct {
-	err error
-	row int
-	col int
+	err   error
+	field *ast.Field
 }
 
+// serializeJSON settles this value and writes it to stream.  If a required value
+// is missing, nothing is written and false is returned.
 func (c *vJSONCollector) serializeJSON(stream *jsonstream.Stream, depth int) ([]gqlError, bool) {
-	if c.kind == vKindError {
-		e := c.dat.(edat)
-		errs := []gqlError{pe(e.err, depth, e.row, e.col)}
-		if c.required {
-			return errs, false
-		}
-		stream.WriteNil()
-		return errs, true
-	}
-
-	if c.kind == vKindNil && c.required {
-		e := c.dat.(edat)
-		return []gqlError{pe(errUnexpectedNil, depth, e.row, e.col)}, false
+	errs, ok := c.settle(depth)
+	if ok {
+		c.writeJSON(stream)
 	}
+	return errs, ok
+}
 
+func (c *vJSONCollector) settle(depth int) ([]gqlError, bool) {
 	switch c.kind {
+	case vKindError:
+		e := c.dat.(edat)
+		c.kind = vKindNil
+		c.dat = nil
+		return []gqlError{pe(e.err, depth, e.field)}, !c.required
 	case vKindNil:
-		stream.WriteNil()
-	case vKindSerialized:
-		stream.Write(c.dat.([]byte))
+		if c.required {
+			e := c.dat.(edat)
+			return []gqlError{pe(errUnexpectedNil, depth, e.field)}, false
+		}
 	case vKindSub:
 		sub := c.dat.(jsonCollector)
-		allErrors, ok := sub.serializeJSON(stream, depth)
+		allErrors, ok := sub.settle(depth)
 		if !ok {
-			// Error bubbled up from child.  Discard any content
-			// written by the child, and either bubble the error
-			// or write nil as our value depending if we are required
-			if c.required {
-				return allErrors, false
-			}
-			stream.WriteNil()
-			return allErrors, true
+			// Error bubbled up from child.  Discard the child, and
+			// either bubble the error or use nil as our value depending
+			// if we are required
+			sub.release()
+			c.kind = vKindNil
+			c.dat = nil
+			return allErrors, !c.required
 		}
 		return allErrors, true
 	}
@@ -178,6 +214,49 @@ func (c *vJSONCollector) serializeJSON(stream *jsonstream.Stream, depth int) ([]
 	return nil, true
 }
 
+// nullAt returns whether the value at path, relative to this value, is null.  It
+// is meant to be called once the value is settled, to find the values that were
+// nulled by errors.
+func (c *vJSONCollector) nullAt(path []interface{}) bool {
+	for _, key := range path {
+		if c.kind != vKindSub {
+			return true
+		}
+		var next *vJSONCollector
+		switch sub := c.dat.(type) {
+		case *oJSONCollector:
+			for i := range sub.fields {
+				if sub.fields[i].name == key {
+					next = &sub.fields[i].c
+					break
+				}
+			}
+		case *aJSONCollector:
+			if i, ok := key.(int); ok && i < len(sub.values) {
+				next = &sub.values[i]
+			}
+		}
+		if next == nil {
+			return false
+		}
+		c = next
+	}
+	return c.kind == vKindNil
+}
+
+func (c *vJSONCollector) writeJSON(stream *jsonstream.Stream) {
+	switch c.kind {
+	case vKindSerialized:
+		// Append directly rather than using stream.Write, which flushes on
+		// every call when the stream has a writer
+		stream.SetBuffer(append(stream.Buffer(), c.dat.([]byte)...))
+	case vKindSub:
+		c.dat.(jsonCollector).writeJSON(stream)
+	default:
+		stream.WriteNil()
+	}
+}
+
 func (c *vJSONCollector) Int(v int64) {
 	if c.kind != vKindNil {
 		panic("Set value on already set collector")
@@ -250,19 +329,19 @@ func (c *vJSONCollector) Array(sizeHint int) arrayCollector {
 	return a
 }
 
-func (c *vJSONCollector) Required(row, col int) {
+func (c *vJSONCollector) Required(field *ast.Field) {
 	if c.kind == vKindNil {
-		c.dat = edat{nil, row, col}
+		c.dat = edat{nil, field}
 	}
 	c.required = true
 }
 
-func (c *vJSONCollector) Error(err error, row, col int) {
+func (c *vJSONCollector) Error(err error, field *ast.Field) {
 	if c.kind == vKindSub { // We allow setting an error even after we set a value, but need to make sure to release if we're clobbering an existing sub-collector
 		c.dat.(jsonCollector).release()
 	}
 	c.kind = vKindError
-	c.dat = edat{err, row, col}
+	c.dat = edat{err, field}
 }
 
 func (c *vJSONCollector) release() {
@@ -292,30 +371,33 @@ func (c *oJSONCollector) Field(name string) collector {
 	return &c.fields[len(c.fields)-1].c
 }
 
-func (c *oJSONCollector) serializeJSON(stream *jsonstream.Stream, depth int) ([]gqlError, bool) {
-	mark := stream.Buffer()
+func (c *oJSONCollector) settle(depth int) ([]gqlError, bool) {
 	var allErrs []gqlError
 	allOk := true
+	for i := range c.fields {
+		f := &c.fields[i]
+		fieldErrors, ok := f.c.settle(depth + 1)
+		for _, fe := range fieldErrors {
+			fe.path[depth] = f.name
+		}
+		allErrs = append(allErrs, fieldErrors...)
+		allOk = allOk && ok
+	}
+	return allErrs, allOk
+}
 
+func (c *oJSONCollector) writeJSON(stream *jsonstream.Stream) {
 	stream.WriteObjectStart()
-	for i, f := range c.fields {
+	for i := range c.fields {
 		if i != 0 {
 			stream.WriteMore()
 		}
+		f := &c.fields[i]
 		stream.WriteObjectField(f.name)
-		fieldErrors, ok := f.c.serializeJSON(stream, depth+1)
-		for _, fe := range fieldErrors {
-			fe.path[depth] = f.name
-		}
-		allErrs = append(allErrs, fieldErrors...)
-		allOk = allOk && ok
+		f.c.writeJSON(stream)
+		flushIfFull(stream)
 	}
 	stream.WriteObjectEnd()
-	if !allOk {
-		stream.SetBuffer(mark)
-		return allErrs, false
-	}
-	return allErrs, true
 }
 
 func (c *oJSONCollector) release() {
@@ -340,29 +422,30 @@ func (c *aJSONCollector) Item() collector {
 	return &c.values[len(c.values)-1]
 }
 
-func (c *aJSONCollector) serializeJSON(stream *jsonstream.Stream, depth int) ([]gqlError, bool) {
-	mark := stream.Buffer()
+func (c *aJSONCollector) settle(depth int) ([]gqlError, bool) {
 	var allErrs []gqlError
 	allOk := true
+	for i := range c.values {
+		itemErrors, ok := c.values[i].settle(depth + 1)
+		for _, fe := range itemErrors {
+			fe.path[depth] = i
+		}
+		allErrs = append(allErrs, itemErrors...)
+		allOk = allOk && ok
+	}
+	return allErrs, allOk
+}
 
+func (c *aJSONCollector) writeJSON(stream *jsonstream.Stream) {
 	stream.WriteArrayStart()
-	for i, v := range c.values {
+	for i := range c.values {
 		if i != 0 {
 			stream.WriteMore()
 		}
-		fieldErrors, ok := v.serializeJSON(stream, depth+1)
-		for _, fe := range fieldErrors {
-			fe.path[depth] = i
-		}
-		allErrs = append(allErrs, fieldErrors...)
-		allOk = allOk && ok
+		c.values[i].writeJSON(stream)
+		flushIfFull(stream)
 	}
 	stream.WriteArrayEnd()
-	if !allOk {
-		stream.SetBuffer(mark)
-		return allErrs, false
-	}
-	return allErrs, true
 }
 
 func (c *aJSONCollector) release() {
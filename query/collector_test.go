@@ -15,6 +15,7 @@
 package query
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 )
@@ -37,7 +38,7 @@ func reportObject(c objectCollector, depth int) {
 	for i := 0; i < depth; i++ {
 		reportObject(a.Item().Object(7), 1)
 	}
-	c.Field("eField").Error(err, 0, 0)
+	c.Field("eField").Error(err, nil)
 }
 
 func BenchmarkCollector(b *testing.B) {
@@ -46,9 +47,59 @@ func BenchmarkCollector(b *testing.B) {
 		root := &oJSONCollector{cc: cc}
 		reportObject(root, 10)
 		stream := streamPool.BorrowStream(nil)
-		root.serializeJSON(stream, 0)
+		root.settle(0)
+		root.writeJSON(stream)
 		streamPool.ReturnStream(stream)
 		root.release()
 		cc.release()
 	}
 }
+
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestCollectorStreaming(t *testing.T) {
+	collect := func() *vJSONCollector {
+		c := &vJSONCollector{cc: acquireJSONCollectorContext()}
+		o := c.Object(2)
+		a := o.Field("items").Array(0)
+		for i := 0; i < 5000; i++ {
+			reportObject(a.Item().Object(7), 1)
+		}
+		// A missing required value nulls out its parent object
+		o.Field("partial").Object(1).Field("required").Required(nil)
+		return c
+	}
+
+	buffered := collect()
+	stream := streamPool.BorrowStream(nil)
+	errs, ok := buffered.serializeJSON(stream, 0)
+	expected := string(stream.Buffer())
+	streamPool.ReturnStream(stream)
+	if !ok || len(errs) != 5001 {
+		t.Fatalf("Unexpected result %v with %v errors", ok, len(errs))
+	}
+	if fmt.Sprint(errs[5000].path) != "[partial required]" {
+		t.Errorf("Unexpected path %v", errs[5000].path)
+	}
+
+	streamed := collect()
+	w := &countingWriter{}
+	stream = streamPool.BorrowStream(w)
+	streamed.serializeJSON(stream, 0)
+	stream.Flush()
+	streamPool.ReturnStream(stream)
+	if w.String() != expected {
+		t.Errorf("Streamed output differs from buffered output")
+	}
+	if w.writes < 2 {
+		t.Errorf("Expected output to be flushed in chunks, got %v writes", w.writes)
+	}
+}
@@ -27,48 +27,248 @@ import (
 type compileContext struct {
 	*schema.Schema
 	*ast.Document
-	row int
-	col int
+	variables map[string]bool
+	path      []string
+	field     *ast.Field
+	row       int
+	col       int
+	limits    *compileLimits
 }
 
 func (c *compileContext) withLocation(row, col int) *compileContext {
 	return &compileContext{
 		c.Schema,
 		c.Document,
+		c.variables,
+		c.path,
+		c.field,
 		row,
 		col,
+		c.limits,
 	}
 }
 
+// withField returns a context for compiling the selections of a field
+func (c *compileContext) withField(field ast.Field) *compileContext {
+	return &compileContext{
+		c.Schema,
+		c.Document,
+		c.variables,
+		append(c.path[:len(c.path):len(c.path)], field.Alias),
+		&field,
+		field.Row,
+		field.Col,
+		c.limits,
+	}
+}
+
+// errorf creates a QueryError located at the current position of the compilation
+func (c *compileContext) errorf(rule string, format string, args ...interface{}) *QueryError {
+	return &QueryError{
+		Message:   fmt.Sprintf(format, args...),
+		Locations: []ErrorLocation{{c.row, c.col}},
+		Path:      c.path,
+		Rule:      rule,
+	}
+}
+
+// checkVariableReferences verifies that all variables referenced by a value
+// are declared by the operation being compiled
+func (c *compileContext) checkVariableReferences(val ast.Value) error {
+	switch v := val.(type) {
+	case ast.ReferenceValue:
+		if !c.variables[v.Name] {
+			return c.errorf("NoUndefinedVariables", "Variable $%s is not defined", v.Name)
+		}
+	case ast.ArrayValue:
+		for _, e := range v.V {
+			if err := c.checkVariableReferences(e); err != nil {
+				return err
+			}
+		}
+	case ast.ObjectValue:
+		for _, e := range v.V {
+			if err := c.checkVariableReferences(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (c *compileContext) newDefaultSelector() defaultSelector {
-	return defaultSelector{c.row, c.col}
+	return defaultSelector{c.field}
+}
+
+// A conditionalField is a field of a selection set along with the @skip and
+// @include conditions that must be evaluated at execution time to determine
+// if the field is included, and the @defer directive of the fragment that
+// selected it, if any.
+type conditionalField struct {
+	Field      ast.Field
+	Conditions fieldConditions
+	Defer      *deferUsage
+}
+
+// A mergedField is a field of a selection set made by merging all the selections
+// of the set that share a response key.
+type mergedField struct {
+	Field      ast.Field
+	Conditions fieldConditionSet
+	Defer      *deferUsage
+}
+
+// mergeFields merges the fields of a flattened selection set that share a response key,
+// preserving the order in which the keys are first selected.  The sub-selections of the
+// merged field are the union of the sub-selections of each field.  Validation ensures
+// that the merged fields are the same field with the same arguments.
+//
+// Fields that are only selected under @skip or @include conditions keep their conditions:
+// their sub-selections are wrapped in a fragment with equivalent directives so that they
+// are only selected when the field they came from would have been.
+//
+// A merged field is deferred only if every selection of it is deferred, in which case it
+// is delivered with the first deferred fragment that selects it.  The sub-selections of
+// selections deferred by other fragments are wrapped in a fragment with an equivalent
+// @defer directive, so they are still delivered separately.
+//
+// See https://facebook.github.io/graphql/June2018/#CollectFields()
+func mergeFields(fields []conditionalField) []mergedField {
+	byKey := make(map[string][]conditionalField, len(fields))
+	keys := make([]string, 0, len(fields))
+	for _, f := range fields {
+		key := f.Field.Alias
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], f)
+	}
+
+	merged := make([]mergedField, len(keys))
+	for i, key := range keys {
+		group := byKey[key]
+		deferred := group[0].Defer
+		for _, f := range group {
+			if f.Defer == nil {
+				deferred = nil
+				break
+			}
+		}
+
+		if len(group) == 1 {
+			merged[i].Field = group[0].Field
+			merged[i].Defer = deferred
+			if len(group[0].Conditions) > 0 {
+				merged[i].Conditions = fieldConditionSet{group[0].Conditions}
+			}
+			continue
+		}
+
+		field := group[0].Field
+		field.SelectionSet = nil
+		always := false
+		var conds fieldConditionSet
+		for _, f := range group {
+			var directives ast.Directives
+			if len(f.Conditions) == 0 {
+				always = true
+			} else {
+				conds = append(conds, f.Conditions)
+				directives = f.Conditions.directives()
+			}
+			if f.Defer != deferred {
+				directives = append(directives, f.Defer.directive())
+			}
+
+			if len(directives) == 0 {
+				field.SelectionSet = append(field.SelectionSet, f.Field.SelectionSet...)
+			} else if len(f.Field.SelectionSet) > 0 {
+				field.SelectionSet = append(field.SelectionSet, &ast.InlineFragmentSelection{
+					Directives:   directives,
+					SelectionSet: f.Field.SelectionSet,
+					Row:          f.Field.Row,
+					Col:          f.Field.Col,
+				})
+			}
+		}
+		if always {
+			conds = nil
+		}
+		merged[i] = mergedField{field, conds, deferred}
+	}
+	return merged
 }
 
 // expandFragment recursively expands a fragment into a flattened set of fields for the given object type.
-func (c *compileContext) expandFragment(typeCondition string, selections ast.SelectionSet, typ *schema.ObjectType) ([]ast.Field, error) {
-	if typ.Name() != typeCondition && !typ.HasInterface(typeCondition) {
+// Fields of the fragment are deferred by deferred, unless a nested fragment is deferred itself.
+func (c *compileContext) expandFragment(typeCondition string, selections ast.SelectionSet, typ *schema.ObjectType, conds fieldConditions, deferred *deferUsage) ([]conditionalField, error) {
+	if !c.doesFragmentTypeApply(typ, typeCondition) {
 		return nil, nil
 	}
 
-	fields := make([]ast.Field, 0)
+	fields := make([]conditionalField, 0)
 	for _, sel := range selections {
 		switch v := sel.(type) {
 		case *ast.FieldSelection:
-			fields = append(fields, v.Field)
+			fc := c.withLocation(v.Field.Row, v.Field.Col)
+			if err := fc.countExpansion(); err != nil {
+				return nil, err
+			}
+			if err := fc.countDirectives(v.Field.Directives); err != nil {
+				return nil, err
+			}
+			fieldConds, ok, err := c.selectionConditions(v.Field.Directives, conds)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				fields = append(fields, conditionalField{v.Field, fieldConds, deferred})
+			}
 		case *ast.FragmentSpreadSelection:
 			fragDef := c.LookupFragmentDefinition(v.FragmentName)
 			if fragDef == nil {
-				// FUTURE: location info
-				return nil, fmt.Errorf("Invalid query - unknown fragment %s", v.FragmentName)
+				return nil, c.withLocation(v.Row, v.Col).errorf("KnownFragmentNames", "Unknown fragment %s", v.FragmentName)
 			}
-			fragFields, err := c.expandFragment(fragDef.OnType, fragDef.SelectionSet, typ)
+			if err := c.withLocation(v.Row, v.Col).countDirectives(v.Directives); err != nil {
+				return nil, err
+			}
+			fragConds, ok, err := c.selectionConditions(v.Directives, conds)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			fragDefer, err := c.fragmentDefer(v.Directives, deferred)
+			if err != nil {
+				return nil, err
+			}
+			fragFields, err := c.expandFragment(fragDef.OnType, fragDef.SelectionSet, typ, fragConds, fragDefer)
 			if err != nil {
 				return nil, err
 			}
 			fields = append(fields, fragFields...)
 
 		case *ast.InlineFragmentSelection:
-			fragFields, err := c.expandFragment(v.OnType, v.SelectionSet, typ)
+			if err := c.withLocation(v.Row, v.Col).countDirectives(v.Directives); err != nil {
+				return nil, err
+			}
+			fragConds, ok, err := c.selectionConditions(v.Directives, conds)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			fragDefer, err := c.fragmentDefer(v.Directives, deferred)
+			if err != nil {
+				return nil, err
+			}
+			onType := v.OnType
+			if onType == "" {
+				onType = typ.Name()
+			}
+			fragFields, err := c.expandFragment(onType, v.SelectionSet, typ, fragConds, fragDefer)
 			if err != nil {
 				return nil, err
 			}
@@ -78,6 +278,168 @@ func (c *compileContext) expandFragment(typeCondition string, selections ast.Sel
 	return fields, nil
 }
 
+// doesFragmentTypeApply checks whether a fragment with the given type condition applies
+// to values of an object type.
+//
+// See https://facebook.github.io/graphql/June2018/#DoesFragmentTypeApply()
+func (c *compileContext) doesFragmentTypeApply(objectType *schema.ObjectType, typeCondition string) bool {
+	if objectType.Name() == typeCondition {
+		return true
+	}
+
+	switch t := c.Schema.Type(typeCondition).(type) {
+	case *schema.ObjectType:
+		return t == objectType
+	case *schema.InterfaceType:
+		return objectType.HasInterface(t.Name())
+	case *schema.UnionType:
+		for _, member := range t.Members() {
+			if member == objectType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectionConditions evaluates the @skip and @include directives of a selection.  Conditions
+// that are literal values are evaluated immediately, if the selection is excluded by them ok
+// is false.  Conditions that reference variables are added to the inherited conditions
+// and returned.
+func (c *compileContext) selectionConditions(directives ast.Directives, inherited fieldConditions) (conds fieldConditions, ok bool, err error) {
+	conds = inherited
+	for _, d := range directives {
+		var include bool
+		switch d.Name {
+		case schema.SkipDirective.Name():
+			include = false
+		case schema.IncludeDirective.Name():
+			include = true
+		default:
+			continue
+		}
+
+		arg, found := d.Arguments.ByName("if")
+		if !found {
+			return nil, false, c.withLocation(d.Row, d.Col).errorf("ProvidedRequiredArguments", "Directive @%s requires argument if", d.Name)
+		}
+
+		switch v := arg.Value.(type) {
+		case ast.BooleanValue:
+			if v.V != include {
+				return nil, false, nil
+			}
+		case ast.ReferenceValue:
+			if err := c.checkVariableReferences(v); err != nil {
+				return nil, false, err
+			}
+			// Copy so that sibling selections do not share appended conditions
+			conds = append(conds[:len(conds):len(conds)], fieldCondition{v.Name, include})
+		default:
+			return nil, false, c.withLocation(d.Row, d.Col).errorf("ValuesOfCorrectType", "Argument if of directive @%s must be a Boolean", d.Name)
+		}
+	}
+	return conds, true, nil
+}
+
+// fragmentDefer evaluates the @defer directive of a fragment, returning how the fields of the
+// fragment are deferred.  If the fragment is not deferred, the inherited usage is returned.
+func (c *compileContext) fragmentDefer(directives ast.Directives, inherited *deferUsage) (*deferUsage, error) {
+	d, found := directives.ByName(schema.DeferDirective.Name())
+	if !found {
+		return inherited, nil
+	}
+
+	dc := c.withLocation(d.Row, d.Col)
+	usage := &deferUsage{}
+	label, err := dc.directiveLabel(d)
+	if err != nil {
+		return nil, err
+	}
+	usage.Label = label
+
+	if arg, found := d.Arguments.ByName("if"); found {
+		switch v := arg.Value.(type) {
+		case ast.BooleanValue:
+			if !v.V {
+				return inherited, nil
+			}
+		case ast.ReferenceValue:
+			if err := dc.checkVariableReferences(v); err != nil {
+				return nil, err
+			}
+			usage.Variable = v.Name
+		default:
+			return nil, dc.errorf("ValuesOfCorrectType", "Argument if of directive @%s must be a Boolean", d.Name)
+		}
+	}
+	return usage, nil
+}
+
+// fieldStream evaluates the @stream directive of a field, returning nil if the field is not
+// streamed
+func (c *compileContext) fieldStream(directives ast.Directives) (*streamUsage, error) {
+	d, found := directives.ByName(schema.StreamDirective.Name())
+	if !found {
+		return nil, nil
+	}
+
+	dc := c.withLocation(d.Row, d.Col)
+	usage := &streamUsage{}
+	label, err := dc.directiveLabel(d)
+	if err != nil {
+		return nil, err
+	}
+	usage.Label = label
+
+	if arg, found := d.Arguments.ByName("if"); found {
+		switch v := arg.Value.(type) {
+		case ast.BooleanValue:
+			if !v.V {
+				return nil, nil
+			}
+		case ast.ReferenceValue:
+			if err := dc.checkVariableReferences(v); err != nil {
+				return nil, err
+			}
+			usage.Variable = v.Name
+		default:
+			return nil, dc.errorf("ValuesOfCorrectType", "Argument if of directive @%s must be a Boolean", d.Name)
+		}
+	}
+
+	if arg, found := d.Arguments.ByName("initialCount"); found {
+		switch v := arg.Value.(type) {
+		case ast.IntValue:
+			if v.V < 0 {
+				return nil, dc.errorf("ValuesOfCorrectType", "Argument initialCount of directive @%s must not be negative", d.Name)
+			}
+			usage.InitialCount = int(v.V)
+		case ast.ReferenceValue:
+			if err := dc.checkVariableReferences(v); err != nil {
+				return nil, err
+			}
+			usage.InitialCountVariable = v.Name
+		default:
+			return nil, dc.errorf("ValuesOfCorrectType", "Argument initialCount of directive @%s must be an Int", d.Name)
+		}
+	}
+	return usage, nil
+}
+
+// directiveLabel returns the value of the label argument of a @defer or @stream directive
+func (c *compileContext) directiveLabel(d *ast.Directive) (string, error) {
+	arg, found := d.Arguments.ByName("label")
+	if !found {
+		return "", nil
+	}
+	label, ok := arg.Value.(ast.StringValue)
+	if !ok {
+		return "", c.errorf("ValuesOfCorrectType", "Argument label of directive @%s must be a String literal", d.Name)
+	}
+	return label.V, nil
+}
+
 // makeArgumentResolver creates a function that can translate a literal value into
 // the corresponding runtime object using the schema
 func (c *compileContext) makeArgumentResolver(typ schema.InputableType) (argumentResolver, error) {
@@ -0,0 +1,227 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"math"
+
+	"github.com/housecanary/gq/schema"
+)
+
+// A FieldCost is the cost of selecting a field.  The cost of a field is its Weight
+// plus the cost of its selections multiplied by its Multiplier.  Negative weights
+// and multipliers are treated as 0.
+type FieldCost struct {
+	Weight     int
+	Multiplier int
+}
+
+// A CostFunc computes the cost of selecting a field given the values of its
+// arguments.  If ok is false, the cost of the field is determined by its @cost
+// directive, or by the default costs.
+type CostFunc func(field *schema.FieldDescriptor, args map[string]schema.LiteralValue) (cost FieldCost, ok bool)
+
+// A CostOption configures how the cost of a query is computed
+type CostOption func(*costOptions)
+
+type costOptions struct {
+	costFunc        CostFunc
+	defaultListSize int
+}
+
+// WithCostFunc computes the costs of fields using f, instead of (or in addition to)
+// @cost directives in the schema
+func WithCostFunc(f CostFunc) CostOption {
+	return func(o *costOptions) {
+		o.costFunc = f
+	}
+}
+
+// WithDefaultListSize sets the number of items assumed to be returned by a list
+// field whose cost does not specify a multiplier.  The default is 1.
+func WithDefaultListSize(n int) CostOption {
+	return func(o *costOptions) {
+		o.defaultListSize = n
+	}
+}
+
+// Cost computes the static cost of running this query with the given variables.
+//
+// The cost of a query is the sum of the costs of the fields it selects.  By default
+// a field returning an object, interface or union costs 1, and any other field costs
+// nothing.  The cost of the selections of a list field is multiplied by the assumed
+// size of the list (see WithDefaultListSize), and for fields of an abstract type
+// the most expensive of the possible selections is counted.
+//
+// The default cost of a field may be replaced in the schema with a @cost directive
+// (see schema.Builder.EnableCostDirective):
+//
+//	users(first: Int): [User] @cost(weight: 5, multiplier: "first")
+//
+// The weight is the cost of the field itself, and multiplier names an argument
+// whose value replaces the assumed size of the list.  Costs may also be computed
+// in Go with WithCostFunc.
+//
+// An error is returned only if the variables are invalid.
+func (q *PreparedQuery) Cost(variables Variables, opts ...CostOption) (int, error) {
+	options := costOptions{defaultListSize: 1}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	coerced, errs := coerceVariables(context.Background(), q.variables, variables)
+	if errs != nil {
+		return 0, errs[0]
+	}
+	return options.selectorCost(q.root, coerced), nil
+}
+
+// selectorCost returns the cost of the selections of sel
+func (o *costOptions) selectorCost(sel selector, variables Variables) int {
+	switch t := unwrapCostSelector(sel).(type) {
+	case *objectSelector:
+		cost := 0
+		for _, f := range t.Fields {
+			if f.Conditions.included(variables) {
+				cost = addCost(cost, o.fieldCost(f, variables))
+			}
+		}
+		return cost
+	case interfaceSelector:
+		return o.maxElementCost(t.Elements, variables)
+	case unionSelector:
+		return o.maxElementCost(t.Elements, variables)
+	}
+	return 0
+}
+
+func (o *costOptions) maxElementCost(elements map[string]selector, variables Variables) int {
+	cost := 0
+	for _, e := range elements {
+		if c := o.selectorCost(e, variables); c > cost {
+			cost = c
+		}
+	}
+	return cost
+}
+
+// fieldCost returns the cost of selecting f, including its selections
+func (o *costOptions) fieldCost(f *objectSelectorField, variables Variables) int {
+	var cost FieldCost
+	ok := false
+	if o.costFunc != nil {
+		args := make(map[string]schema.LiteralValue, len(f.DefaultValues))
+		for name, v := range f.DefaultValues {
+			args[name] = v
+		}
+		for name, v := range f.ArgValues {
+			args[name] = astValueToLiteralValue(v, variables)
+		}
+		cost, ok = o.costFunc(f.Field, args)
+	}
+	if !ok {
+		cost = o.defaultFieldCost(f, variables)
+	}
+	if cost.Weight < 0 {
+		cost.Weight = 0
+	}
+	if cost.Multiplier < 0 {
+		cost.Multiplier = 0
+	}
+	return addCost(cost.Weight, mulCost(cost.Multiplier, o.selectorCost(f.Sel, variables)))
+}
+
+// defaultFieldCost returns the cost of f given by its @cost directive, or the
+// default cost of its type
+func (o *costOptions) defaultFieldCost(f *objectSelectorField, variables Variables) FieldCost {
+	var cost FieldCost
+	switch unwrapCostSelector(f.Sel).(type) {
+	case *objectSelector, interfaceSelector, unionSelector:
+		cost.Weight = 1
+	}
+
+	cost.Multiplier = 1
+	for sel := f.Sel; ; {
+		if t, ok := sel.(notNilSelector); ok {
+			sel = t.Delegate
+			continue
+		}
+		t, ok := sel.(listSelector)
+		if !ok {
+			break
+		}
+		cost.Multiplier = mulCost(cost.Multiplier, o.defaultListSize)
+		sel = t.ElementSelector
+	}
+
+	d := f.Field.GetDirective(schema.CostDirective.Name())
+	if d == nil {
+		return cost
+	}
+	if arg := d.Argument("weight"); arg != nil {
+		if v, ok := arg.Value().(schema.LiteralNumber); ok {
+			cost.Weight = int(v)
+		}
+	}
+	if arg := d.Argument("multiplier"); arg != nil {
+		if name, ok := arg.Value().(schema.LiteralString); ok {
+			var v schema.LiteralValue
+			if av, ok := f.ArgValues[string(name)]; ok {
+				v = astValueToLiteralValue(av, variables)
+			} else {
+				v = f.DefaultValues[string(name)]
+			}
+			if n, ok := v.(schema.LiteralNumber); ok {
+				cost.Multiplier = maxCost
+				if n < math.MaxInt32 {
+					cost.Multiplier = int(n)
+				}
+			}
+		}
+	}
+	return cost
+}
+
+// unwrapCostSelector returns the selector applied to the items of sel
+func unwrapCostSelector(sel selector) selector {
+	for {
+		switch t := sel.(type) {
+		case listSelector:
+			sel = t.ElementSelector
+		case notNilSelector:
+			sel = t.Delegate
+		default:
+			return sel
+		}
+	}
+}
+
+const maxCost = int(^uint(0) >> 1)
+
+// addCost and mulCost saturate rather than overflow, so that a query with huge
+// multipliers is reported as too expensive rather than cheap
+func addCost(a, b int) int {
+	if a > maxCost-b {
+		return maxCost
+	}
+	return a + b
+}
+
+func mulCost(a, b int) int {
+	if a != 0 && b > maxCost/a {
+		return maxCost
+	}
+	return a * b
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"testing"
+
+	"github.com/housecanary/gq/schema"
+)
+
+func TestCost(t *testing.T) {
+	s := buildTestSchema()
+	for _, c := range []struct {
+		query    string
+		vars     Variables
+		expected int
+	}{
+		{`{tags}`, nil, 0},
+		{`{user {name}}`, nil, 1},
+		{`{user {name pets {... on Dog {owner {name}}}}}`, nil, 3},
+		{`{user {friends {name}}}`, nil, 2},
+		{`{user {friends(first: 5) {name friends(first: 3) {name}}}}`, nil, 1 + (1 + 5*(1+3*0))},
+		{`{users {name}}`, nil, 2},
+		{`{users(first: 4) {user: friends(first: 2) {name}}}`, nil, 2 + 4*(1+2*0)},
+		{`query ($n: Int) {users(first: $n) {friends {name}}}`, Variables{"n": schema.LiteralNumber(3)}, 2 + 3*1},
+		{`query ($n: Int = 5) {users(first: $n) {friends {name}}}`, nil, 2 + 5*1},
+		{`query ($skip: Boolean!) {user {name} users(first: 100) @skip(if: $skip) {name}}`, Variables{"skip": schema.LiteralBool(true)}, 1},
+		{`{users(first: 1000000) {friends(first: 1000000) {friends(first: 1000000) {friends(first: 1000000) {friends(first: 1000000) {name}}}}}}`, nil, maxCost},
+	} {
+		q, err := PrepareQuery(c.query, "", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cost, err := q.Cost(c.vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cost != c.expected {
+			t.Errorf("Expected cost of %s to be %d, got %d", c.query, c.expected, cost)
+		}
+	}
+}
+
+func TestCostOptions(t *testing.T) {
+	s := buildTestSchema()
+	q, err := PrepareQuery(`{user {name} tags user2: user {pets {... on Cat {name}}}}`, "", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cost, err := q.Cost(nil, WithDefaultListSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost != 3 {
+		t.Errorf("Expected cost 3, got %d", cost)
+	}
+
+	cost, err = q.Cost(nil, WithCostFunc(func(field *schema.FieldDescriptor, args map[string]schema.LiteralValue) (FieldCost, bool) {
+		switch field.Name() {
+		case "name":
+			return FieldCost{Weight: 3}, true
+		case "pets":
+			return FieldCost{Weight: 1, Multiplier: 5}, true
+		}
+		return FieldCost{}, false
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (1 + 3) + 0 + (1 + (1 + 5*3)); cost != expected {
+		t.Errorf("Expected cost %d, got %d", expected, cost)
+	}
+
+	q, err = PrepareQuery(`query ($n: Int!) {users(first: $n) {name}}`, "", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Cost(nil); err == nil {
+		t.Error("Expected an error for a missing variable")
+	}
+}
+
+func TestCostNegativeWeight(t *testing.T) {
+	q, err := PrepareQuery(`{user {name friends {name}}}`, "", buildTestSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Negative costs count as 0, rather than overflowing to the maximum cost
+	cost, err := q.Cost(nil, WithCostFunc(func(field *schema.FieldDescriptor, args map[string]schema.LiteralValue) (FieldCost, bool) {
+		if field.Name() == "friends" {
+			return FieldCost{Weight: -5, Multiplier: 1}, true
+		}
+		return FieldCost{}, false
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost != 1 {
+		t.Errorf("Expected cost 1, got %d", cost)
+	}
+}
+
+func TestCostLimitError(t *testing.T) {
+	err := NewCostLimitError(20, 10)
+	ext := err.Extensions()
+	if ext["code"] != ErrorCodeTooExpensive || ext["cost"] != 20 || ext["maxCost"] != 10 {
+		t.Errorf("Unexpected extensions %v", ext)
+	}
+}
@@ -37,7 +37,7 @@ func (s enumSelector) apply(ctx exeContext, value interface{}, collector collect
 	lv, err := s.Type.Encode(ctx, value)
 	if err != nil {
 		ctx.listener.NotifyError(err)
-		collector.Error(err, s.row, s.col)
+		collector.Error(err, s.field)
 		return nil
 	}
 
@@ -50,7 +50,7 @@ func (s enumSelector) apply(ctx exeContext, value interface{}, collector collect
 	} else {
 		err := fmt.Errorf("Expected a string value for enum, but got %v", lv)
 		ctx.listener.NotifyError(err)
-		collector.Error(err, s.row, s.col)
+		collector.Error(err, s.field)
 	}
 
 	return nil
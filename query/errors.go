@@ -0,0 +1,265 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/housecanary/gq/internal/pkg/parser"
+	"github.com/housecanary/gq/query/validation"
+)
+
+// Rule codes of QueryErrors that are not caused by a validation rule
+const (
+	// RuleSyntax is the rule code of errors caused by invalid query text
+	RuleSyntax = "Syntax"
+
+	// RuleUnknownOperation is the rule code of errors caused by requesting an operation
+	// that the query does not define
+	RuleUnknownOperation = "UnknownOperation"
+)
+
+// Standard error codes, reported in the code entry of the extensions of errors in
+// responses
+const (
+	ErrorCodeParseFailed      = "GRAPHQL_PARSE_FAILED"
+	ErrorCodeValidationFailed = "GRAPHQL_VALIDATION_FAILED"
+	ErrorCodeBadUserInput     = "BAD_USER_INPUT"
+	ErrorCodeUnauthenticated  = "UNAUTHENTICATED"
+	ErrorCodeForbidden        = "FORBIDDEN"
+	ErrorCodeNotFound         = "NOT_FOUND"
+	ErrorCodeUnavailable      = "SERVICE_UNAVAILABLE"
+	ErrorCodeInternal         = "INTERNAL_SERVER_ERROR"
+	ErrorCodeTooExpensive     = "QUERY_TOO_EXPENSIVE"
+	ErrorCodeTimeout          = "TIMEOUT"
+	ErrorCodeCancelled        = "CANCELLED"
+)
+
+// An ExtendedError is an error that supplies additional information to clients.
+// If an error returned by a resolver (or an error it wraps) implements this interface,
+// the map returned by Extensions is written as the extensions entry of the error in
+// the response.  The values of the map must be serializable to JSON.
+type ExtendedError interface {
+	error
+	Extensions() map[string]interface{}
+}
+
+// errorExtensions returns the extensions of an error, or nil if it has none
+func errorExtensions(err error) map[string]interface{} {
+	var ee ExtendedError
+	if errors.As(err, &ee) {
+		return ee.Extensions()
+	}
+	return nil
+}
+
+// A CodedError is an error with a machine readable code.  Clients receive the code
+// in the extensions of the error, along with any additional values in Extra.
+type CodedError struct {
+	Code    string
+	Message string
+	Extra   map[string]interface{}
+
+	// Cause is the underlying error, if any.  It is not reported to clients.
+	Cause error
+}
+
+// NewCodedError creates a CodedError with the given code and message
+func NewCodedError(code string, message string) *CodedError {
+	return &CodedError{Code: code, Message: message}
+}
+
+// NewBadUserInputError creates an error reporting that an argument supplied by the client is invalid
+func NewBadUserInputError(format string, args ...interface{}) *CodedError {
+	return NewCodedError(ErrorCodeBadUserInput, fmt.Sprintf(format, args...))
+}
+
+// NewUnauthenticatedError creates an error reporting that the client must authenticate
+func NewUnauthenticatedError(format string, args ...interface{}) *CodedError {
+	return NewCodedError(ErrorCodeUnauthenticated, fmt.Sprintf(format, args...))
+}
+
+// NewForbiddenError creates an error reporting that the client is not allowed to access a value
+func NewForbiddenError(format string, args ...interface{}) *CodedError {
+	return NewCodedError(ErrorCodeForbidden, fmt.Sprintf(format, args...))
+}
+
+// NewNotFoundError creates an error reporting that a requested value does not exist
+func NewNotFoundError(format string, args ...interface{}) *CodedError {
+	return NewCodedError(ErrorCodeNotFound, fmt.Sprintf(format, args...))
+}
+
+// NewUnavailableError creates an error reporting that a value is temporarily unavailable.
+// If retryAfter is positive, it is reported to the client as a retryAfter extension
+// in seconds.
+func NewUnavailableError(retryAfter time.Duration, format string, args ...interface{}) *CodedError {
+	err := NewCodedError(ErrorCodeUnavailable, fmt.Sprintf(format, args...))
+	if retryAfter > 0 {
+		err.Extra = map[string]interface{}{"retryAfter": retryAfter.Seconds()}
+	}
+	return err
+}
+
+// NewInternalError creates an error that hides the details of an unexpected failure
+// from clients.  The cause is available through errors.Unwrap for logging.
+func NewInternalError(cause error) *CodedError {
+	return &CodedError{Code: ErrorCodeInternal, Message: "Internal server error", Cause: cause}
+}
+
+// NewCostLimitError creates an error reporting that the cost of a query (see
+// PreparedQuery.Cost) exceeds the maximum allowed.  Both are reported to the client
+// as the cost and maxCost extensions.
+func NewCostLimitError(cost int, maxCost int) *CodedError {
+	err := NewCodedError(ErrorCodeTooExpensive, fmt.Sprintf("Query cost %d exceeds the maximum cost of %d", cost, maxCost))
+	err.Extra = map[string]interface{}{"cost": cost, "maxCost": maxCost}
+	return err
+}
+
+// newContextError creates the error reported in place of a field that was not
+// resolved because the context of the execution is done.  The context error is
+// available through errors.Unwrap.
+func newContextError(err error) *CodedError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &CodedError{Code: ErrorCodeTimeout, Message: "Execution timed out", Cause: err}
+	}
+	return &CodedError{Code: ErrorCodeCancelled, Message: "Execution cancelled", Cause: err}
+}
+
+func (e *CodedError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the cause of the error
+func (e *CodedError) Unwrap() error {
+	return e.Cause
+}
+
+// Extensions returns the code of the error and any extra values
+func (e *CodedError) Extensions() map[string]interface{} {
+	ext := make(map[string]interface{}, len(e.Extra)+1)
+	for k, v := range e.Extra {
+		ext[k] = v
+	}
+	ext["code"] = e.Code
+	return ext
+}
+
+// A PanicError is reported in place of a value whose resolver panicked.  Value is
+// the value passed to panic.
+type PanicError struct {
+	Value interface{}
+}
+
+// newPanicError wraps a recovered panic value
+func newPanicError(r interface{}) *PanicError {
+	return &PanicError{r}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// An ErrorLocation identifies a position in the text of a query.  Lines and columns
+// start at 1.
+type ErrorLocation struct {
+	Line   int
+	Column int
+}
+
+// A QueryError describes a problem that prevented a query from being prepared
+type QueryError struct {
+	// Message is a human readable description of the problem
+	Message string
+
+	// Locations are the positions in the query text that the problem refers to
+	Locations []ErrorLocation
+
+	// Path is the path of response keys leading to the field the problem was found in,
+	// or nil if the problem is not specific to a field
+	Path []string
+
+	// Rule is a machine readable code for the kind of problem.  For queries that fail
+	// validation this is the name of the violated rule (see package validation).
+	Rule string
+}
+
+func (e *QueryError) Error() string {
+	return e.Message
+}
+
+// Extensions reports the kind of problem to clients
+func (e *QueryError) Extensions() map[string]interface{} {
+	code := ErrorCodeValidationFailed
+	if e.Rule == RuleSyntax {
+		code = ErrorCodeParseFailed
+	}
+	ext := map[string]interface{}{"code": code}
+	if e.Rule != "" {
+		ext["rule"] = e.Rule
+	}
+	return ext
+}
+
+// QueryErrors lists all problems found while preparing a query.  Errors returned by
+// PrepareQuery are always of this type.
+type QueryErrors []*QueryError
+
+func (e QueryErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Message
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// queryErrorsFrom converts an error found while preparing a query to QueryErrors
+func queryErrorsFrom(err error) QueryErrors {
+	switch e := err.(type) {
+	case QueryErrors:
+		return e
+	case *QueryError:
+		return QueryErrors{e}
+	case validation.Errors:
+		errs := make(QueryErrors, len(e))
+		for i, ve := range e {
+			locations := make([]ErrorLocation, len(ve.Locations))
+			for j, l := range ve.Locations {
+				locations[j] = ErrorLocation{l.Line, l.Column}
+			}
+			errs[i] = &QueryError{Message: ve.Message, Locations: locations, Rule: ve.Rule}
+		}
+		return errs
+	case parser.ParseError:
+		// Parse error columns start at 0
+		return QueryErrors{{
+			Message:   e.Error(),
+			Locations: []ErrorLocation{{e.GetLine(), e.GetColumn() + 1}},
+			Rule:      RuleSyntax,
+		}}
+	}
+	return QueryErrors{{Message: err.Error()}}
+}
@@ -0,0 +1,291 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+)
+
+// A Plan describes how a PreparedQuery is executed.  It mirrors the tree of
+// selectors the query was compiled to, so it shows which resolver runs for each
+// field, where the arguments of each field come from, and which selections apply
+// to each possible type of an abstract field.
+//
+// A Plan can be printed (see String), or serialized to JSON.
+type Plan struct {
+	Operation ast.OperationType `json:"operation"`
+	Root      *PlanNode         `json:"root"`
+}
+
+// Kinds of PlanNode
+const (
+	PlanObject    = "object"
+	PlanList      = "list"
+	PlanNotNil    = "notNil"
+	PlanInterface = "interface"
+	PlanUnion     = "union"
+	PlanScalar    = "scalar"
+	PlanEnum      = "enum"
+)
+
+// A PlanNode describes how a value is selected
+type PlanNode struct {
+	Kind string `json:"kind"`
+
+	// Type is the name of the type of the value, for all kinds but lists and
+	// non null values
+	Type string `json:"type,omitempty"`
+
+	// Fields are the fields selected from an object.  If Serial is set, each
+	// field is fully resolved before the next (as for the fields of a mutation).
+	Fields []*PlanField `json:"fields,omitempty"`
+	Serial bool         `json:"serial,omitempty"`
+
+	// Of selects the elements of a list, or the value of a non null value
+	Of *PlanNode `json:"of,omitempty"`
+
+	// Stream is the @stream directive of a list, if any
+	Stream string `json:"stream,omitempty"`
+
+	// Implementations select each object type that an interface or union value
+	// may have, ordered by name
+	Implementations []*PlanNode `json:"implementations,omitempty"`
+}
+
+// A PlanField describes a selected field
+type PlanField struct {
+	Alias string `json:"alias"`
+
+	// Field is the schema coordinate of the field (i.e. Query.user)
+	Field string `json:"field"`
+
+	// Type is the signature of the type of the field (i.e. [User!])
+	Type string `json:"type"`
+
+	Arguments []*PlanArgument `json:"arguments,omitempty"`
+
+	// Conditions are the @skip and @include directives that decide whether the
+	// field is selected when the query is run.  The field is selected if any of
+	// the conditions hold.
+	Conditions []string `json:"conditions,omitempty"`
+
+	// Defer is the @defer directive of the fragment that selected the field, if any
+	Defer string `json:"defer,omitempty"`
+
+	Selection *PlanNode `json:"selection"`
+}
+
+// Kinds of PlanArgument
+const (
+	ArgumentLiteral  = "literal"
+	ArgumentVariable = "variable"
+)
+
+// A PlanArgument describes an argument passed to a field.  An argument whose
+// value references variables is a variable argument, otherwise it is a literal
+// argument.
+type PlanArgument struct {
+	Name      string   `json:"name"`
+	Kind      string   `json:"kind"`
+	Value     string   `json:"value"`
+	Variables []string `json:"variables,omitempty"`
+}
+
+// Explain returns the execution plan of this query
+func (q *PreparedQuery) Explain() *Plan {
+	return &Plan{
+		Operation: q.operationType,
+		Root:      explainSelector(q.root),
+	}
+}
+
+func explainSelector(sel selector) *PlanNode {
+	switch t := sel.(type) {
+	case *objectSelector:
+		n := &PlanNode{Kind: PlanObject, Type: t.Type.Name(), Serial: t.Serial}
+		for _, f := range t.Fields {
+			n.Fields = append(n.Fields, explainField(t.Type, f))
+		}
+		return n
+	case listSelector:
+		n := &PlanNode{Kind: PlanList, Of: explainSelector(t.ElementSelector)}
+		if t.Stream != nil {
+			n.Stream = directiveString(t.Stream.directive())
+		}
+		return n
+	case notNilSelector:
+		return &PlanNode{Kind: PlanNotNil, Of: explainSelector(t.Delegate)}
+	case interfaceSelector:
+		return &PlanNode{Kind: PlanInterface, Type: t.Type.Name(), Implementations: explainElements(t.Elements)}
+	case unionSelector:
+		return &PlanNode{Kind: PlanUnion, Type: t.Type.Name(), Implementations: explainElements(t.Elements)}
+	case scalarSelector:
+		return &PlanNode{Kind: PlanScalar, Type: t.Type.Name()}
+	case enumSelector:
+		return &PlanNode{Kind: PlanEnum, Type: t.Type.Name()}
+	}
+	return &PlanNode{Kind: fmt.Sprintf("%T", sel)}
+}
+
+func explainElements(elements map[string]selector) []*PlanNode {
+	names := make([]string, 0, len(elements))
+	for name := range elements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	nodes := make([]*PlanNode, len(names))
+	for i, name := range names {
+		nodes[i] = explainSelector(elements[name])
+	}
+	return nodes
+}
+
+func explainField(typ *schema.ObjectType, f *objectSelectorField) *PlanField {
+	pf := &PlanField{
+		Alias:     f.AstField.Alias,
+		Field:     typ.Name() + "." + f.Field.Name(),
+		Type:      schema.Signature(f.Field.Type()),
+		Selection: explainSelector(f.Sel),
+	}
+	for _, arg := range f.AstField.Arguments {
+		pa := &PlanArgument{Name: arg.Name, Kind: ArgumentLiteral, Value: arg.Value.Representation()}
+		pa.Variables = valueVariables(arg.Value, nil)
+		if len(pa.Variables) > 0 {
+			pa.Kind = ArgumentVariable
+		}
+		pf.Arguments = append(pf.Arguments, pa)
+	}
+	for _, c := range f.Conditions {
+		pf.Conditions = append(pf.Conditions, directiveString(c.directives()...))
+	}
+	if f.Defer != nil {
+		pf.Defer = directiveString(f.Defer.directive())
+	}
+	return pf
+}
+
+// valueVariables appends the names of the variables referenced by val to names
+func valueVariables(val ast.Value, names []string) []string {
+	switch v := val.(type) {
+	case ast.ReferenceValue:
+		names = append(names, v.Name)
+	case ast.ArrayValue:
+		for _, e := range v.V {
+			names = valueVariables(e, names)
+		}
+	case ast.ObjectValue:
+		keys := make([]string, 0, len(v.V))
+		for k := range v.V {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			names = valueVariables(v.V[k], names)
+		}
+	}
+	return names
+}
+
+// directiveString formats directives as in a query
+func directiveString(directives ...*ast.Directive) string {
+	var b strings.Builder
+	ast.Directives(directives).MarshalGraphQL(&b)
+	return strings.TrimPrefix(b.String(), " ")
+}
+
+// String formats the plan as an indented tree, with a line for each selector
+// and each field:
+//
+//	query
+//	  object Query
+//	    user: Query.user(id: $id) User
+//	      object User
+//	        name: User.name String
+//	          scalar String
+func (p *Plan) String() string {
+	var b strings.Builder
+	b.WriteString(string(p.Operation))
+	b.WriteString("\n")
+	p.Root.write(&b, 1)
+	return b.String()
+}
+
+func (n *PlanNode) write(b *strings.Builder, depth int) {
+	writeIndent(b, depth)
+	b.WriteString(n.Kind)
+	if n.Type != "" {
+		b.WriteString(" ")
+		b.WriteString(n.Type)
+	}
+	if n.Serial {
+		b.WriteString(" (serial)")
+	}
+	if n.Stream != "" {
+		b.WriteString(" ")
+		b.WriteString(n.Stream)
+	}
+	b.WriteString("\n")
+	if n.Of != nil {
+		n.Of.write(b, depth+1)
+	}
+	for _, f := range n.Fields {
+		f.write(b, depth+1)
+	}
+	for _, impl := range n.Implementations {
+		impl.write(b, depth+1)
+	}
+}
+
+func (f *PlanField) write(b *strings.Builder, depth int) {
+	writeIndent(b, depth)
+	b.WriteString(f.Alias)
+	b.WriteString(": ")
+	b.WriteString(f.Field)
+	if len(f.Arguments) > 0 {
+		b.WriteString("(")
+		for i, arg := range f.Arguments {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(arg.Name)
+			b.WriteString(": ")
+			b.WriteString(arg.Value)
+		}
+		b.WriteString(")")
+	}
+	b.WriteString(" ")
+	b.WriteString(f.Type)
+	if len(f.Conditions) > 0 {
+		b.WriteString(" ")
+		b.WriteString(strings.Join(f.Conditions, " | "))
+	}
+	if f.Defer != "" {
+		b.WriteString(" ")
+		b.WriteString(f.Defer)
+	}
+	b.WriteString("\n")
+	f.Selection.write(b, depth+1)
+}
+
+func writeIndent(b *strings.Builder, depth int) {
+	for i := 0; i < depth; i++ {
+		b.WriteString("  ")
+	}
+}
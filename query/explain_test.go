@@ -0,0 +1,115 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+)
+
+func TestExplain(t *testing.T) {
+	q, err := PrepareQuery(`query Q($n: Int, $show: Boolean!) {
+  users(first: $n) {
+    name @include(if: $show)
+    pets { ... on Dog { name } }
+  }
+  user { friends(first: 2) { name } }
+}`, "", buildTestSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := q.Explain()
+	expected := strings.Join([]string{
+		"query",
+		"  object Query",
+		"    users: Query.users(first: $n) [User]",
+		"      list",
+		"        object User",
+		"          name: User.name String @include(if: $show)",
+		"            scalar String",
+		"          pets: User.pets [Pet]!",
+		"            notNil",
+		"              list",
+		"                union Pet",
+		"                  object Cat",
+		"                  object Dog",
+		"                    name: Dog.name String",
+		"                      scalar String",
+		"    user: Query.user User",
+		"      object User",
+		"        friends: User.friends(first: 2) [User]",
+		"          list",
+		"            object User",
+		"              name: User.name String",
+		"                scalar String",
+		"",
+	}, "\n")
+	if plan.String() != expected {
+		t.Errorf("Expected plan\n%s\ngot\n%s", expected, plan.String())
+	}
+
+	b, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Plan
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	users := decoded.Root.Fields[0]
+	if arg := users.Arguments[0]; arg.Kind != ArgumentVariable || arg.Value != "$n" || len(arg.Variables) != 1 || arg.Variables[0] != "n" {
+		t.Errorf("Unexpected argument %+v", arg)
+	}
+	friends := decoded.Root.Fields[1].Selection.Fields[0]
+	if arg := friends.Arguments[0]; arg.Kind != ArgumentLiteral || arg.Value != "2" || len(arg.Variables) != 0 {
+		t.Errorf("Unexpected argument %+v", arg)
+	}
+}
+
+func TestExplainIncremental(t *testing.T) {
+	q, err := PrepareQuery(`mutation { user { ... @defer(label: "late") { tags @stream(initialCount: 1) } } }`, "", buildExplainMutationSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"mutation",
+		"  object Mutation (serial)",
+		"    user: Mutation.user Query",
+		"      object Query",
+		`        tags: Query.tags [String] @defer(label: "late")`,
+		"          list @stream(initialCount: 1)",
+		"            scalar String",
+		"",
+	}, "\n")
+	if s := q.Explain().String(); s != expected {
+		t.Errorf("Expected plan\n%s\ngot\n%s", expected, s)
+	}
+}
+
+func buildExplainMutationSchema() *schema.Schema {
+	builder := schema.NewBuilder()
+	builder.AddScalarType("String", schema.EncodeScalarMarshaler, nil, nil)
+	builder.AddObjectType("Query").AddField("tags", &ast.ListType{Of: &ast.SimpleType{Name: "String"}}, nil)
+	builder.AddObjectType("Mutation").AddField("user", &ast.SimpleType{Name: "Query"}, nil)
+	builder.SetMutationType("Mutation")
+	builder.EnableIncrementalDelivery()
+	return builder.MustBuild("Query")
+}
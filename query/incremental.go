@@ -0,0 +1,464 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+
+	jsonstream "github.com/json-iterator/go"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+)
+
+// A deferUsage is a @defer directive applied to a fragment.  The fields selected by
+// the fragment are delivered in a separate payload.
+type deferUsage struct {
+	Label string
+
+	// If Variable is set, the fragment is only deferred if the variable is true
+	Variable string
+}
+
+// active returns whether the fragment should be deferred given the supplied
+// variables
+func (d *deferUsage) active(variables Variables) bool {
+	if d.Variable == "" {
+		return true
+	}
+	v, _ := variables[d.Variable].(schema.LiteralBool)
+	return bool(v)
+}
+
+// directive returns the @defer directive equivalent to this usage
+func (d *deferUsage) directive() *ast.Directive {
+	directive := &ast.Directive{Name: schema.DeferDirective.Name()}
+	if d.Label != "" {
+		directive.Arguments = append(directive.Arguments, &ast.Argument{Name: "label", Value: ast.StringValue{V: d.Label}})
+	}
+	if d.Variable != "" {
+		directive.Arguments = append(directive.Arguments, &ast.Argument{Name: "if", Value: ast.ReferenceValue{Name: d.Variable}})
+	}
+	return directive
+}
+
+// A streamUsage is a @stream directive applied to a list field.  Items of the list
+// after the first InitialCount are each delivered in a separate payload.
+type streamUsage struct {
+	Label        string
+	InitialCount int
+
+	// If Variable is set, the list is only streamed if the variable is true
+	Variable string
+
+	// If InitialCountVariable is set, it supplies the initial count
+	InitialCountVariable string
+}
+
+// directive returns the @stream directive equivalent to this usage
+func (s *streamUsage) directive() *ast.Directive {
+	directive := &ast.Directive{Name: schema.StreamDirective.Name()}
+	if s.Label != "" {
+		directive.Arguments = append(directive.Arguments, &ast.Argument{Name: "label", Value: ast.StringValue{V: s.Label}})
+	}
+	if s.InitialCountVariable != "" {
+		directive.Arguments = append(directive.Arguments, &ast.Argument{Name: "initialCount", Value: ast.ReferenceValue{Name: s.InitialCountVariable}})
+	} else {
+		directive.Arguments = append(directive.Arguments, &ast.Argument{Name: "initialCount", Value: ast.IntValue{V: int64(s.InitialCount)}})
+	}
+	if s.Variable != "" {
+		directive.Arguments = append(directive.Arguments, &ast.Argument{Name: "if", Value: ast.ReferenceValue{Name: s.Variable}})
+	}
+	return directive
+}
+
+// active returns whether the list should be streamed given the supplied variables
+func (s *streamUsage) active(variables Variables) bool {
+	if s.Variable == "" {
+		return true
+	}
+	v, _ := variables[s.Variable].(schema.LiteralBool)
+	return bool(v)
+}
+
+// initialCount returns the number of items to deliver with the list given the
+// supplied variables
+func (s *streamUsage) initialCount(variables Variables) int {
+	if s.InitialCountVariable == "" {
+		return s.InitialCount
+	}
+	v, _ := variables[s.InitialCountVariable].(schema.LiteralNumber)
+	if v < 0 {
+		return 0
+	}
+	return int(v)
+}
+
+// A responsePath is the path to a value in the result, stored as a linked list from
+// the value to the root
+type responsePath struct {
+	parent *responsePath
+	key    interface{}
+}
+
+func (p *responsePath) child(key interface{}) *responsePath {
+	return &responsePath{p, key}
+}
+
+// slice returns the keys of the path from the root
+func (p *responsePath) slice() []interface{} {
+	n := 0
+	for e := p; e != nil; e = e.parent {
+		n++
+	}
+	path := make([]interface{}, n)
+	for e := p; e != nil; e = e.parent {
+		n--
+		path[n] = e.key
+	}
+	return path
+}
+
+// An incrementalQueue collects the work deferred by @defer and @stream while
+// executing a query
+type incrementalQueue struct {
+	pending []*incrementalJob
+}
+
+// An incrementalContext schedules deferred work on a queue.  Work deferred while
+// performing a job is delivered after the payload of that job.
+type incrementalContext struct {
+	queue  *incrementalQueue
+	parent *incrementalJob
+}
+
+// An incrementalJob applies a selector to a value, producing a payload that
+// completes the value at path
+type incrementalJob struct {
+	ctx   exeContext
+	label string
+	path  []interface{}
+	sel   selector
+	value interface{}
+
+	// after is the job whose payload must be delivered before this one: the job
+	// that deferred this one, or the previous item of a stream
+	after *incrementalJob
+
+	// parent is the job whose payload holds the value this job completes, or nil
+	// for the initial payload.  children are the jobs whose parent is this job.
+	parent   *incrementalJob
+	children []*incrementalJob
+
+	// streamItem is set if this job delivers an item of a streamed list, which
+	// completes the list rather than the value at path
+	streamItem bool
+
+	cc        jsonCollectorContext
+	collector *vJSONCollector
+	cont      contFunc
+	sent      bool
+
+	// skipped is set if the value completed by this job was nulled, in which case
+	// its payload is not delivered
+	skipped bool
+}
+
+// add schedules sel to be applied to value as a separate payload.  The path of
+// the payload is the path of ctx.  If after is nil, the payload is delivered after
+// that of the job performing the current work, if any.
+func (ic *incrementalContext) add(ctx exeContext, label string, sel selector, value interface{}, after *incrementalJob) *incrementalJob {
+	if after == nil {
+		after = ic.parent
+	}
+	job := &incrementalJob{
+		ctx:    ctx,
+		label:  label,
+		path:   ctx.path.slice(),
+		sel:    sel,
+		value:  value,
+		after:  after,
+		parent: ic.parent,
+	}
+	if ic.parent != nil {
+		ic.parent.children = append(ic.parent.children, job)
+	}
+	ic.queue.pending = append(ic.queue.pending, job)
+	return job
+}
+
+// addStreamItem schedules sel to be applied to an item of a streamed list, like add
+func (ic *incrementalContext) addStreamItem(ctx exeContext, label string, sel selector, value interface{}, after *incrementalJob) *incrementalJob {
+	job := ic.add(ctx, label, sel, value, after)
+	job.streamItem = true
+	return job
+}
+
+// nulledIn returns whether the value completed by this job was nulled in the
+// settled payload of its parent, whose value at root was collected by collector
+func (j *incrementalJob) nulledIn(collector *vJSONCollector, root []interface{}) bool {
+	target := j.path
+	if j.streamItem {
+		target = target[:len(target)-1]
+	}
+	return collector.nullAt(target[len(root):])
+}
+
+func (j *incrementalJob) start() {
+	j.ctx.incremental = &incrementalContext{j.ctx.incremental.queue, j}
+	j.cc = acquireJSONCollectorContext()
+	j.collector = &vJSONCollector{cc: j.cc}
+	j.sel.prepareCollector(j.collector)
+	j.cont = j.sel.apply(j.ctx, j.value, j.collector)
+}
+
+// serialize writes the payload produced by this job, and releases its collector
+func (j *incrementalJob) serialize(hasNext bool) []byte {
+	stream := streamPool.BorrowStream(nil)
+	stream.WriteObjectStart()
+	stream.WriteObjectField("data")
+	errors, ok := j.collector.serializeJSON(stream, len(j.path))
+	if !ok {
+		stream.WriteNil()
+	}
+	for _, e := range errors {
+		copy(e.path, j.path)
+	}
+	stream.WriteMore()
+	stream.WriteObjectField("path")
+	writePath(stream, j.path)
+	if j.label != "" {
+		stream.WriteMore()
+		stream.WriteObjectField("label")
+		stream.WriteString(j.label)
+	}
+	serializeErrors(stream, j.ctx.options.presentErrors(j.ctx, errors))
+	if !hasNext {
+		writeExtensions(stream, listenerExtensions(j.ctx.listener))
+	}
+	writeHasNext(stream, hasNext)
+	stream.WriteObjectEnd()
+
+	for _, child := range j.children {
+		if child.nulledIn(j.collector, j.path) {
+			child.skipped = true
+		}
+	}
+	j.release()
+
+	buf := stream.Buffer()
+	content := make([]byte, len(buf))
+	copy(content, buf)
+	streamPool.ReturnStream(stream)
+	return content
+}
+
+// release releases the collector of a job that has been started
+func (j *incrementalJob) release() {
+	j.collector.release()
+	j.cc.release()
+}
+
+// run performs all deferred work, including work deferred by the deferred work,
+// calling emit with each payload as it completes.  Work is advanced together, so
+// that loads can be grouped by the listener at idle points.  If emit returns false,
+// run stops.
+//
+// The payloads of jobs whose value was nulled are not delivered.  If the last
+// delivered payload announced more payloads that were then skipped, a final
+// payload without data ends the response.
+func (q *incrementalQueue) run(listener ExecutionListener, emit func([]byte) bool) {
+	var active []*incrementalJob
+	hasNext := true
+	for {
+		for len(q.pending) > 0 {
+			started := q.pending
+			q.pending = nil
+			for _, job := range started {
+				job.start()
+			}
+			active = append(active, started...)
+		}
+
+		// Deliver completed jobs.  Delivering a job may allow the next item
+		// of its stream to be delivered, so repeat until nothing changes.
+		for progress := true; progress; {
+			progress = false
+			remaining := active[:0]
+			for i, job := range active {
+				if job.after != nil && !job.after.sent {
+					remaining = append(remaining, job)
+					continue
+				}
+				if job.skipped || (job.after != nil && job.after.skipped) || (job.parent != nil && job.parent.skipped) {
+					// The value completed by the job was nulled, drop its work
+					job.skipped = true
+					job.sent = true
+					progress = true
+					job.release()
+					continue
+				}
+				if job.cont != nil {
+					remaining = append(remaining, job)
+					continue
+				}
+				job.sent = true
+				progress = true
+				hasNext = len(remaining)+len(active)-i-1+len(q.pending) > 0
+				if !emit(job.serialize(hasNext)) {
+					// Release the collectors of the jobs that will not be
+					// delivered.  remaining reuses the start of active, so the
+					// jobs after i are still in place.
+					for _, j := range remaining {
+						j.release()
+					}
+					for _, j := range active[i+1:] {
+						j.release()
+					}
+					return
+				}
+			}
+			active = remaining
+		}
+
+		if len(active) == 0 && len(q.pending) == 0 {
+			if hasNext {
+				emit(serializeCompleted(listener))
+			}
+			return
+		}
+
+		// Advance the jobs together, in two passes if async values are awaited
+		// concurrently (see advanceRound)
+		listener.NotifyIdle()
+		for _, job := range active {
+			if job.cont != nil {
+				job.cont = job.cont()
+			}
+		}
+		for _, job := range active {
+			if job.cont != nil && job.ctx.awaits != nil {
+				job.cont = job.cont()
+			}
+		}
+	}
+}
+
+// serializeCompleted returns a payload that only reports that there are no more
+// payloads
+func serializeCompleted(listener ExecutionListener) []byte {
+	stream := streamPool.BorrowStream(nil)
+	stream.WriteObjectStart()
+	stream.WriteObjectField("hasNext")
+	stream.WriteBool(false)
+	writeExtensions(stream, listenerExtensions(listener))
+	stream.WriteObjectEnd()
+
+	buf := stream.Buffer()
+	content := make([]byte, len(buf))
+	copy(content, buf)
+	streamPool.ReturnStream(stream)
+	return content
+}
+
+func writeHasNext(stream *jsonstream.Stream, hasNext bool) {
+	stream.WriteMore()
+	stream.WriteObjectField("hasNext")
+	stream.WriteBool(hasNext)
+}
+
+// ExecuteIncremental runs this query like Execute, but delivers the results of
+// fragments marked with @defer, and of the items of lists marked with @stream,
+// separately from the rest of the results.  The schema must have been built with
+// incremental delivery enabled for queries to use these directives.
+//
+// The initial payload holds the results of all selections that were not deferred.
+// If any work was deferred, it has a hasNext entry of true, and patches receives a
+// payload for each deferred fragment or streamed item as its work completes.  Each
+// patch has the path of the value it completes, its data, errors, label, and
+// hasNext, which is false for the last patch.  No patch is delivered for a value
+// that was nulled by an error; if that leaves no patch to deliver after one that
+// announced more, a last patch holds only hasNext.  The channel is closed after the
+// last patch, or when ctx is done.  If no work was deferred, patches is nil.  The
+// extensions contributed by an ExtensionsListener are reported in the last payload.
+//
+// Deferred work runs on a separate goroutine, but the listener is never called
+// concurrently.
+func (q *PreparedQuery) ExecuteIncremental(ctx context.Context, rootValue interface{}, variables Variables, listener ExecutionListener, opts ...ExecutionOption) (initial []byte, patches <-chan []byte) {
+	if listener == nil {
+		listener = BaseExecutionListener{}
+	}
+	options := newExecutionOptions(opts)
+	coerced, errs := coerceVariables(ctx, q.variables, variables)
+	if errs != nil {
+		return serializeRequestErrors(ctx, listener, &options, errs), nil
+	}
+
+	queue := &incrementalQueue{}
+	exeCtx := newExeContext(ctx, listener, coerced, &options)
+	exeCtx.incremental = &incrementalContext{queue: queue}
+	// Results delivered incrementally have no cache policy
+	exeCtx.cache = nil
+	cc := acquireJSONCollectorContext()
+	collector := &vJSONCollector{cc: cc}
+	drainSelector(exeCtx, q.executionRoot(), rootValue, collector)
+
+	stream := streamPool.BorrowStream(nil)
+	stream.WriteObjectStart()
+	writeResultFields(exeCtx, stream, collector)
+	// Drop the work deferred within values that were nulled
+	pending := queue.pending[:0]
+	for _, job := range queue.pending {
+		if !job.nulledIn(collector, nil) {
+			pending = append(pending, job)
+		}
+	}
+	queue.pending = pending
+	if len(queue.pending) > 0 {
+		writeHasNext(stream, true)
+	} else {
+		writeExtensions(stream, listenerExtensions(listener))
+	}
+	stream.WriteObjectEnd()
+	collector.release()
+	cc.release()
+
+	buf := stream.Buffer()
+	initial = make([]byte, len(buf))
+	copy(initial, buf)
+	streamPool.ReturnStream(stream)
+
+	if len(queue.pending) == 0 {
+		return initial, nil
+	}
+
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	results := make(chan []byte)
+	go func() {
+		defer close(results)
+		queue.run(listener, func(patch []byte) bool {
+			select {
+			case results <- patch:
+				return true
+			case <-done:
+				return false
+			}
+		})
+	}()
+	return initial, results
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/housecanary/gq/schema"
+)
+
+func runIncrementalQuery(t *testing.T, query string, vars Variables, expected ...string) {
+	t.Helper()
+	q, err := PrepareQuery(query, "", buildTestSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initial, patches := q.ExecuteIncremental(context.Background(), &Query{}, vars, nil)
+	actual := []string{string(initial)}
+	if patches != nil {
+		for p := range patches {
+			actual = append(actual, string(p))
+		}
+	}
+	if fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Errorf("Expected payloads\n%v\ngot\n%v", expected, actual)
+	}
+}
+
+func TestDefer(t *testing.T) {
+	runIncrementalQuery(t, `{foo ... @defer(label: "slow") {slow}}`, nil,
+		`{"data":{"foo":"bar"},"hasNext":true}`,
+		`{"data":{"slow":"slow"},"path":[],"label":"slow","hasNext":false}`,
+	)
+}
+
+func TestDeferNested(t *testing.T) {
+	runIncrementalQuery(t, `{child {name ...f @defer}} fragment f on Child {slow}`, nil,
+		`{"data":{"child":{"name":"child"}},"hasNext":true}`,
+		`{"data":{"slow":"slow"},"path":["child"],"hasNext":false}`,
+	)
+	runIncrementalQuery(t, `{... @defer {child {name ... @defer {slow}}}}`, nil,
+		`{"data":{},"hasNext":true}`,
+		`{"data":{"child":{"name":"child"}},"path":[],"hasNext":true}`,
+		`{"data":{"slow":"slow"},"path":["child"],"hasNext":false}`,
+	)
+}
+
+func TestDeferMerged(t *testing.T) {
+	// child is selected without @defer, so only the deferred sub-selection is deferred
+	runIncrementalQuery(t, `{child {name} ... @defer {child {slow}}}`, nil,
+		`{"data":{"child":{"name":"child"}},"hasNext":true}`,
+		`{"data":{"slow":"slow"},"path":["child"],"hasNext":false}`,
+	)
+}
+
+func TestDeferCondition(t *testing.T) {
+	query := `query($d: Boolean!) {foo ... @defer(if: $d) {slow}}`
+	runIncrementalQuery(t, query, Variables{"d": schema.LiteralBool(false)},
+		`{"data":{"foo":"bar","slow":"slow"}}`,
+	)
+	runIncrementalQuery(t, query, Variables{"d": schema.LiteralBool(true)},
+		`{"data":{"foo":"bar"},"hasNext":true}`,
+		`{"data":{"slow":"slow"},"path":[],"hasNext":false}`,
+	)
+	runIncrementalQuery(t, `{foo ... @defer(if: false) {slow}}`, nil,
+		`{"data":{"foo":"bar","slow":"slow"}}`,
+	)
+}
+
+func TestDeferError(t *testing.T) {
+	runIncrementalQuery(t, `{child {name ... @defer {required}}}`, nil,
+		`{"data":{"child":{"name":"child"}},"hasNext":true}`,
+		`{"data":null,"path":["child"],"errors":[{"message":"Required failed","path":["child","required"],"locations":[{"line":1,"column":26}]}],"hasNext":false}`,
+	)
+}
+
+func TestDeferNulledParent(t *testing.T) {
+	runIncrementalQuery(t, `{foo child {required ... @defer {slow}}}`, nil,
+		`{"data":{"foo":"bar","child":null},"errors":[{"message":"Required failed","path":["child","required"],"locations":[{"line":1,"column":13}]}]}`,
+	)
+	runIncrementalQuery(t, `{foo child {required ... @defer {slow}} ... @defer {slow}}`, nil,
+		`{"data":{"foo":"bar","child":null},"errors":[{"message":"Required failed","path":["child","required"],"locations":[{"line":1,"column":13}]}],"hasNext":true}`,
+		`{"data":{"slow":"slow"},"path":[],"hasNext":false}`,
+	)
+	runIncrementalQuery(t, `{foo ... @defer {child {required ... @defer {slow}}}}`, nil,
+		`{"data":{"foo":"bar"},"hasNext":true}`,
+		`{"data":{"child":null},"path":[],"errors":[{"message":"Required failed","path":["child","required"],"locations":[{"line":1,"column":25}]}],"hasNext":true}`,
+		`{"hasNext":false}`,
+	)
+}
+
+func TestStream(t *testing.T) {
+	runIncrementalQuery(t, `{list @stream(initialCount: 1, label: "items")}`, nil,
+		`{"data":{"list":["a"]},"hasNext":true}`,
+		`{"data":"b","path":["list",1],"label":"items","hasNext":true}`,
+		`{"data":"c","path":["list",2],"label":"items","hasNext":false}`,
+	)
+	runIncrementalQuery(t, `{children @stream {slow ... @defer {name}}}`, nil,
+		`{"data":{"children":[]},"hasNext":true}`,
+		`{"data":{"slow":"slow"},"path":["children",0],"hasNext":true}`,
+		`{"data":{"slow":"slow"},"path":["children",1],"hasNext":true}`,
+		`{"data":{"name":"child"},"path":["children",0],"hasNext":true}`,
+		`{"data":{"name":"child"},"path":["children",1],"hasNext":false}`,
+	)
+}
+
+func TestIncrementalCancel(t *testing.T) {
+	q, err := PrepareQuery(`{children @stream {slow ... @defer {name}}}`, "", buildTestSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, patches := q.ExecuteIncremental(ctx, &Query{}, nil, nil)
+	<-patches
+	cancel()
+
+	// Delivery stops once the context is done, even though patches remain
+	time.Sleep(20 * time.Millisecond)
+	for p := range patches {
+		t.Errorf("Expected no patches after cancelling, got %s", p)
+	}
+}
+
+func TestIncrementalDirectivesIgnoredByExecute(t *testing.T) {
+	q, err := PrepareQuery(`{list @stream ... @defer {slow}}`, "", buildTestSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"data":{"list":["a","b","c"],"slow":"slow"}}`
+	result := string(q.Execute(context.Background(), &Query{}, nil, nil))
+	if result != expected {
+		t.Errorf("Expected result %v, got %v", expected, result)
+	}
+}
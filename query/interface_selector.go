@@ -36,7 +36,7 @@ func buildInterfaceSelector(cc *compileContext, typ *schema.InterfaceType, selec
 		switch v := sel.(type) {
 		case *ast.FieldSelection:
 			if !typ.HasField(v.Field.Name) {
-				return nil, fmt.Errorf("Field %s does not exist on interface %s", v.Field.Name, typ.Name())
+				return nil, cc.withField(v.Field).errorf("FieldsOnCorrectType", "Field %s does not exist on interface %s", v.Field.Name, typ.Name())
 			}
 		}
 	}
@@ -67,7 +67,7 @@ func (s interfaceSelector) apply(ctx exeContext, value interface{}, collector co
 	if !ok {
 		err := fmt.Errorf("Value %v does not conform to interface %s", value, s.Type.Name())
 		ctx.listener.NotifyError(err)
-		collector.Error(err, s.row, s.col)
+		collector.Error(err, s.field)
 		return nil
 	}
 
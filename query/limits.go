@@ -0,0 +1,195 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"github.com/housecanary/gq/ast"
+)
+
+// PrepareOptions limits the shape of the queries accepted by PrepareQueryWithOptions,
+// so that clients cannot submit queries that are expensive to compile and run.  A
+// limit of 0 disables that limit.  The limits are checked against the selections
+// written in the query document before it is validated, and again against the
+// compiled query.
+type PrepareOptions struct {
+	// MaxDepth is the maximum nesting depth of field selections.  The fields selected
+	// on the root type are at depth 1.
+	MaxDepth int
+
+	// MaxFields is the maximum number of fields in the compiled query, after fields
+	// with the same response key are merged, and the maximum number of field
+	// selections written in the query document.  Validation compares the distinct
+	// fields selected with the same response key pairwise, so this limit also bounds
+	// the time spent validating a query.
+	MaxFields int
+
+	// MaxAliases is the maximum number of fields selected with an alias that differs
+	// from the field name.
+	MaxAliases int
+
+	// MaxFragmentExpansion is the maximum number of field selections produced by
+	// expanding selection sets.  The fields of a fragment are counted each time the
+	// fragment is spread, which bounds queries that nest fragment spreads to build
+	// very large selection sets from a small query text.
+	MaxFragmentExpansion int
+
+	// MaxDirectives is the maximum number of directives applied to fields and
+	// fragments, counted each time the selection they are applied to is expanded.
+	MaxDirectives int
+}
+
+// Rule codes of QueryErrors reporting a query that exceeds the PrepareOptions
+const (
+	RuleMaxDepth             = "MaxDepth"
+	RuleMaxFields            = "MaxFields"
+	RuleMaxAliases           = "MaxAliases"
+	RuleMaxFragmentExpansion = "MaxFragmentExpansion"
+	RuleMaxDirectives        = "MaxDirectives"
+)
+
+// compileLimits tracks the size of a query being compiled against its PrepareOptions
+type compileLimits struct {
+	options    PrepareOptions
+	fields     int
+	aliases    int
+	expanded   int
+	directives int
+}
+
+// countField checks the limits on compiled fields for a field selected at the
+// current position
+func (c *compileContext) countField(field ast.Field) error {
+	l := c.limits
+	if l.options.MaxDepth > 0 && len(c.path) > l.options.MaxDepth {
+		return c.errorf(RuleMaxDepth, "Query exceeds the maximum depth of %d", l.options.MaxDepth)
+	}
+	l.fields++
+	if l.options.MaxFields > 0 && l.fields > l.options.MaxFields {
+		return c.errorf(RuleMaxFields, "Query exceeds the maximum of %d fields", l.options.MaxFields)
+	}
+	if field.Alias != field.Name {
+		l.aliases++
+		if l.options.MaxAliases > 0 && l.aliases > l.options.MaxAliases {
+			return c.errorf(RuleMaxAliases, "Query exceeds the maximum of %d aliases", l.options.MaxAliases)
+		}
+	}
+	return nil
+}
+
+// countExpansion checks the limit on expanded field selections for a field selection
+// at the current position
+func (c *compileContext) countExpansion() error {
+	l := c.limits
+	l.expanded++
+	if l.options.MaxFragmentExpansion > 0 && l.expanded > l.options.MaxFragmentExpansion {
+		return c.errorf(RuleMaxFragmentExpansion, "Query exceeds the maximum of %d field selections after expanding fragments", l.options.MaxFragmentExpansion)
+	}
+	return nil
+}
+
+// countDirectives checks the limit on directives for directives applied at the
+// current position
+func (c *compileContext) countDirectives(directives ast.Directives) error {
+	l := c.limits
+	l.directives += len(directives)
+	if l.options.MaxDirectives > 0 && l.directives > l.options.MaxDirectives {
+		return c.errorf(RuleMaxDirectives, "Query exceeds the maximum of %d directives", l.options.MaxDirectives)
+	}
+	return nil
+}
+
+// checkDocumentLimits checks the limits on depth, fields, aliases, field selections
+// and directives against the selections written in a query document, before it is
+// validated.  Validation compares the fields of each selection set pairwise, so a
+// query repeating a field many times has to be rejected before it is validated.
+// Fragment spreads are not expanded here: each selection is counted once where it
+// is written, and the limits are checked again when the query is compiled.
+func checkDocumentLimits(doc *ast.Document, options PrepareOptions) error {
+	if options == (PrepareOptions{}) {
+		return nil
+	}
+	c := &compileContext{Document: doc, limits: &compileLimits{options: options}}
+	for _, op := range doc.OperationDefinitions {
+		if err := c.withLocation(op.Row, op.Col).countDirectives(op.Directives); err != nil {
+			return err
+		}
+		if err := c.checkSelectionLimits(op.SelectionSet, 0, []string{}); err != nil {
+			return err
+		}
+	}
+	for _, frag := range doc.FragmentDefinitions {
+		if err := c.withLocation(frag.Row, frag.Col).countDirectives(frag.Directives); err != nil {
+			return err
+		}
+		if err := c.checkSelectionLimits(frag.SelectionSet, 0, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSelectionLimits counts the selections of a selection set written at the
+// given depth of field nesting and response path.  The path of selections in
+// fragment definitions is not known before the fragments are spread, and is nil.
+func (c *compileContext) checkSelectionLimits(selections ast.SelectionSet, depth int, path []string) error {
+	l := c.limits
+	for _, sel := range selections {
+		switch v := sel.(type) {
+		case *ast.FieldSelection:
+			fc := c.withLocation(v.Field.Row, v.Field.Col)
+			var fieldPath []string
+			if path != nil {
+				fieldPath = append(path[:len(path):len(path)], v.Field.Alias)
+			}
+			if l.options.MaxDepth > 0 && depth+1 > l.options.MaxDepth {
+				fc.path = fieldPath
+				return fc.errorf(RuleMaxDepth, "Query exceeds the maximum depth of %d", l.options.MaxDepth)
+			}
+			l.fields++
+			if l.options.MaxFields > 0 && l.fields > l.options.MaxFields {
+				fc.path = fieldPath
+				return fc.errorf(RuleMaxFields, "Query exceeds the maximum of %d fields", l.options.MaxFields)
+			}
+			if v.Field.Alias != v.Field.Name {
+				l.aliases++
+				if l.options.MaxAliases > 0 && l.aliases > l.options.MaxAliases {
+					fc.path = fieldPath
+					return fc.errorf(RuleMaxAliases, "Query exceeds the maximum of %d aliases", l.options.MaxAliases)
+				}
+			}
+			if err := fc.countExpansion(); err != nil {
+				return err
+			}
+			if err := fc.countDirectives(v.Field.Directives); err != nil {
+				return err
+			}
+			if err := c.checkSelectionLimits(v.Field.SelectionSet, depth+1, fieldPath); err != nil {
+				return err
+			}
+		case *ast.FragmentSpreadSelection:
+			if err := c.withLocation(v.Row, v.Col).countDirectives(v.Directives); err != nil {
+				return err
+			}
+		case *ast.InlineFragmentSelection:
+			if err := c.withLocation(v.Row, v.Col).countDirectives(v.Directives); err != nil {
+				return err
+			}
+			if err := c.checkSelectionLimits(v.SelectionSet, depth, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPrepareOptions(t *testing.T) {
+	s := buildTestSchema()
+	for _, c := range []struct {
+		query    string
+		options  PrepareOptions
+		expected string
+	}{
+		{`{user {friends {friends {name}}}}`, PrepareOptions{MaxDepth: 4}, ""},
+		{`{user {friends {friends {friends {name}}}}}`, PrepareOptions{MaxDepth: 4}, "MaxDepth: Query exceeds the maximum depth of 4 at 1:35 [user friends friends friends name]"},
+		{`{user {name friends {name}} tags}`, PrepareOptions{MaxFields: 5}, ""},
+		{`{user {name friends {name}} tags tags}`, PrepareOptions{MaxFields: 6}, ""},
+		{`{user {name friends {name}} tags tags}`, PrepareOptions{MaxFields: 5}, "MaxFields: Query exceeds the maximum of 5 fields at 1:34 [tags]"},
+		{`{user {name friends {name}} tags t: tags}`, PrepareOptions{MaxFields: 5}, "MaxFields: Query exceeds the maximum of 5 fields at 1:34 [t]"},
+		{`{a: tags b: tags user {name: name}}`, PrepareOptions{MaxAliases: 2}, ""},
+		{`{a: tags b: tags c: tags}`, PrepareOptions{MaxAliases: 2}, "MaxAliases: Query exceeds the maximum of 2 aliases at 1:18 [c]"},
+		{`{...a ...a} fragment a on Query {...b ...b} fragment b on Query {tags}`, PrepareOptions{MaxFragmentExpansion: 4}, ""},
+		{`{...a ...a} fragment a on Query {...b ...b ...b} fragment b on Query {tags}`, PrepareOptions{MaxFragmentExpansion: 4}, "MaxFragmentExpansion: Query exceeds the maximum of 4 field selections after expanding fragments at 1:71"},
+		{`{tags @include(if: true) ... @skip(if: false) {user {name}}}`, PrepareOptions{MaxDirectives: 2}, ""},
+		{`{tags @include(if: true) ... @skip(if: false) {user @include(if: true) {name}}}`, PrepareOptions{MaxDirectives: 2}, "MaxDirectives: Query exceeds the maximum of 2 directives at 1:48"},
+	} {
+		_, err := PrepareQueryWithOptions(c.query, "", s, c.options)
+		actual := ""
+		if err != nil {
+			qe := err.(QueryErrors)[0]
+			actual = fmt.Sprintf("%s: %s at %d:%d", qe.Rule, qe.Message, qe.Locations[0].Line, qe.Locations[0].Column)
+			if qe.Path != nil {
+				actual += fmt.Sprintf(" %v", qe.Path)
+			}
+		}
+		if actual != c.expected {
+			t.Errorf("Expected error for %s to be %q, got %q", c.query, c.expected, actual)
+		}
+	}
+}
+
+func TestPrepareOptionsBeforeValidation(t *testing.T) {
+	s := buildTestSchema()
+	for _, c := range []struct {
+		query    string
+		options  PrepareOptions
+		expected string
+	}{
+		{"{" + strings.Repeat("unknown ", 1000) + "}", PrepareOptions{MaxFragmentExpansion: 100}, "MaxFragmentExpansion: Query exceeds the maximum of 100 field selections after expanding fragments at 1:802"},
+		{"{" + strings.Repeat("a: unknown ", 1000) + "}", PrepareOptions{MaxAliases: 10}, "MaxAliases: Query exceeds the maximum of 10 aliases at 1:112 [a]"},
+		{`{...a} fragment a on Query {unknown {unknown {unknown}}}`, PrepareOptions{MaxDepth: 2}, "MaxDepth: Query exceeds the maximum depth of 2 at 1:47"},
+		{`{unknown @a @b @c}`, PrepareOptions{MaxDirectives: 2}, "MaxDirectives: Query exceeds the maximum of 2 directives at 1:2"},
+		{"{" + strings.Repeat("unknown ", 1000) + "}", PrepareOptions{MaxFields: 100}, "MaxFields: Query exceeds the maximum of 100 fields at 1:802 [unknown]"},
+		{`{...a} fragment a on Query {unknown unknown}`, PrepareOptions{MaxFields: 1}, "MaxFields: Query exceeds the maximum of 1 fields at 1:37"},
+	} {
+		_, err := PrepareQueryWithOptions(c.query, "", s, c.options)
+		actual := ""
+		if err != nil {
+			qe := err.(QueryErrors)[0]
+			actual = fmt.Sprintf("%s: %s at %d:%d", qe.Rule, qe.Message, qe.Locations[0].Line, qe.Locations[0].Column)
+			if qe.Path != nil {
+				actual += fmt.Sprintf(" %v", qe.Path)
+			}
+		}
+		if actual != c.expected {
+			t.Errorf("Expected error for %.40s to be %q, got %q", c.query, c.expected, actual)
+		}
+	}
+}
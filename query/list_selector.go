@@ -23,8 +23,12 @@ import (
 
 // A listSelector has a delegate selector that it uses to process each element of a
 // list of values.
+//
+// If Stream is set, elements after the initial count are delivered separately when
+// executing incrementally.
 type listSelector struct {
 	ElementSelector selector
+	Stream          *streamUsage
 	defaultSelector
 }
 
@@ -46,15 +50,28 @@ func (s listSelector) apply(ctx exeContext, value interface{}, collector collect
 	if !ok {
 		err := fmt.Errorf("Value %v is not a list value", value)
 		ctx.listener.NotifyError(err)
-		collector.Error(err, s.row, s.col)
+		collector.Error(err, s.field)
 		return nil
 	}
 
+	streamFrom := -1
+	if s.Stream != nil && ctx.incremental != nil && s.Stream.active(ctx.variables) {
+		streamFrom = s.Stream.initialCount(ctx.variables)
+	}
+
 	valueCollector := collector.Array(lv.Len())
+	var prev *incrementalJob
+	i := 0
 	lv.ForEachElement(func(item interface{}) {
-		elementCollector := valueCollector.Item()
-		s.ElementSelector.prepareCollector(elementCollector)
-		deferred.Add(s.ElementSelector.apply(ctx, item, elementCollector))
+		itemCtx := ctx.withPathKey(i)
+		if streamFrom >= 0 && i >= streamFrom {
+			prev = ctx.incremental.addStreamItem(itemCtx, s.Stream.Label, s.ElementSelector, item, prev)
+		} else {
+			elementCollector := valueCollector.Item()
+			s.ElementSelector.prepareCollector(elementCollector)
+			deferred.Add(s.ElementSelector.apply(itemCtx, item, elementCollector))
+		}
+		i++
 	})
 
 	if len(deferred) > 0 {
@@ -63,3 +80,17 @@ func (s listSelector) apply(ctx exeContext, value interface{}, collector collect
 
 	return nil
 }
+
+// withStream returns sel, which selects the values of a list field, with the
+// elements of the list streamed as described by stream
+func withStream(sel selector, stream *streamUsage) selector {
+	switch t := sel.(type) {
+	case notNilSelector:
+		t.Delegate = withStream(t.Delegate, stream)
+		return t
+	case listSelector:
+		t.Stream = stream
+		return t
+	}
+	return sel
+}
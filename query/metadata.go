@@ -0,0 +1,169 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+)
+
+// A VariableDefinition describes a variable declared by a query
+type VariableDefinition struct {
+	Name string
+	Type schema.Type
+
+	// DefaultValue is the value of the variable when none is supplied, if
+	// HasDefault is set
+	DefaultValue schema.LiteralValue
+	HasDefault   bool
+}
+
+// OperationType returns whether this is a query, mutation or subscription
+func (q *PreparedQuery) OperationType() ast.OperationType {
+	return q.operationType
+}
+
+// OperationName returns the name of the operation that was prepared, which is
+// empty for an anonymous operation
+func (q *PreparedQuery) OperationName() string {
+	return q.operation.Name
+}
+
+// FieldCount returns the number of fields of the compiled query, after fields with
+// the same response key are merged.  This is the count limited by
+// PrepareOptions.MaxFields.
+func (q *PreparedQuery) FieldCount() int {
+	return q.fieldCount
+}
+
+// VariableDefinitions returns the variables declared by the operation, in the
+// order they are declared
+func (q *PreparedQuery) VariableDefinitions() []VariableDefinition {
+	defs := make([]VariableDefinition, len(q.variables))
+	for i, v := range q.variables {
+		defs[i] = VariableDefinition{v.Name, v.Type, v.DefaultValue, v.HasDefault}
+	}
+	return defs
+}
+
+// RootFields returns the names of the fields selected on the root type of the
+// operation (i.e. the Query type), in the order they are selected.  Each field is
+// listed once, even if it is selected under several aliases.
+func (q *PreparedQuery) RootFields() []string {
+	root := q.root.(*objectSelector)
+	seen := make(map[string]bool, len(root.Fields))
+	var names []string
+	for _, f := range root.Fields {
+		name := f.Field.Name()
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// SchemaCoordinates returns the coordinates (i.e. User.name) of all the schema
+// fields this query may select, sorted.  Fields selected on an interface or union
+// are listed for each object type that may be selected, rather than for the
+// abstract type, so coordinates always name the type whose resolver runs.
+func (q *PreparedQuery) SchemaCoordinates() []string {
+	seen := make(map[string]bool)
+	collectCoordinates(q.root, seen)
+	coordinates := make([]string, 0, len(seen))
+	for c := range seen {
+		coordinates = append(coordinates, c)
+	}
+	sort.Strings(coordinates)
+	return coordinates
+}
+
+func collectCoordinates(sel selector, seen map[string]bool) {
+	switch t := sel.(type) {
+	case *objectSelector:
+		for _, f := range t.Fields {
+			seen[t.Type.Name()+"."+f.Field.Name()] = true
+			collectCoordinates(f.Sel, seen)
+		}
+	case listSelector:
+		collectCoordinates(t.ElementSelector, seen)
+	case notNilSelector:
+		collectCoordinates(t.Delegate, seen)
+	case interfaceSelector:
+		for _, e := range t.Elements {
+			collectCoordinates(e, seen)
+		}
+	case unionSelector:
+		for _, e := range t.Elements {
+			collectCoordinates(e, seen)
+		}
+	}
+}
+
+// Print formats the prepared operation, followed by the fragments it uses, sorted
+// by name.  Other operations of the document the query was prepared from are
+// omitted.  See ast.PrintOptions for the available formats.
+func (q *PreparedQuery) Print(options ast.PrintOptions) string {
+	used := make(map[string]bool)
+	usedFragments(q.document, q.operation.SelectionSet, used)
+	names := make([]string, 0, len(used))
+	for name := range used {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	doc := &ast.Document{}
+	doc.AddOperationDefinition(q.operation)
+	for _, name := range names {
+		doc.AddFragmentDefinition(q.document.LookupFragmentDefinition(name))
+	}
+	return ast.Print(doc, options)
+}
+
+// Hash returns a hash of the canonical text of the prepared operation (see Print),
+// as hex encoded SHA-256.  Whitespace, comments, the order of arguments, other
+// operations and fragments the operation does not use are ignored, so the hash
+// identifies the operation regardless of how the client formatted its document.
+func (q *PreparedQuery) Hash() string {
+	q.hashOnce.Do(func() {
+		sum := sha256.Sum256([]byte(q.Print(ast.PrintOptions{Canonical: true})))
+		q.hash = hex.EncodeToString(sum[:])
+	})
+	return q.hash
+}
+
+// usedFragments adds the names of the fragments spread in selections, directly or
+// through other fragments, to used
+func usedFragments(doc *ast.Document, selections ast.SelectionSet, used map[string]bool) {
+	for _, sel := range selections {
+		switch t := sel.(type) {
+		case *ast.FieldSelection:
+			usedFragments(doc, t.Field.SelectionSet, used)
+		case *ast.InlineFragmentSelection:
+			usedFragments(doc, t.SelectionSet, used)
+		case *ast.FragmentSpreadSelection:
+			def := doc.LookupFragmentDefinition(t.FragmentName)
+			if def == nil || used[t.FragmentName] {
+				continue
+			}
+			used[t.FragmentName] = true
+			usedFragments(doc, def.SelectionSet, used)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+)
+
+func TestQueryMetadata(t *testing.T) {
+	q, err := PrepareQuery(`query Users($n: Int = 5, $show: Boolean!) {
+  first: users(first: $n) { name @include(if: $show) ...Pets }
+  second: users { name }
+  user { friends { name } }
+}
+fragment Pets on User { pets { ... on Dog { owner { name } } } }`, "", buildTestSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.OperationType() != ast.OperationTypeQuery || q.OperationName() != "Users" {
+		t.Errorf("Unexpected operation %s %s", q.OperationType(), q.OperationName())
+	}
+
+	defs := q.VariableDefinitions()
+	if len(defs) != 2 {
+		t.Fatalf("Expected 2 variable definitions, got %v", defs)
+	}
+	if defs[0].Name != "n" || schema.Signature(defs[0].Type) != "Int" || !defs[0].HasDefault || defs[0].DefaultValue != schema.LiteralNumber(5) {
+		t.Errorf("Unexpected definition %+v", defs[0])
+	}
+	if defs[1].Name != "show" || schema.Signature(defs[1].Type) != "Boolean!" || defs[1].HasDefault {
+		t.Errorf("Unexpected definition %+v", defs[1])
+	}
+
+	if fields := q.RootFields(); !reflect.DeepEqual(fields, []string{"users", "user"}) {
+		t.Errorf("Unexpected root fields %v", fields)
+	}
+
+	// first, first.name, first.pets, first.pets.owner, first.pets.owner.name,
+	// second, second.name, user, user.friends and user.friends.name
+	if count := q.FieldCount(); count != 10 {
+		t.Errorf("Expected 10 fields, got %d", count)
+	}
+
+	expected := []string{"Dog.owner", "Query.user", "Query.users", "User.friends", "User.name", "User.pets"}
+	if coordinates := q.SchemaCoordinates(); !reflect.DeepEqual(coordinates, expected) {
+		t.Errorf("Expected coordinates %v, got %v", expected, coordinates)
+	}
+}
+
+func TestQueryHash(t *testing.T) {
+	s := buildTestSchema()
+	hash := func(text, operationName string) string {
+		q, err := PrepareQuery(text, operationName, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q.Hash()
+	}
+
+	h := hash(`query A { users(first: 2) { ...F } } fragment F on User { name }`, "")
+	if len(h) != 64 {
+		t.Errorf("Expected a hex encoded SHA-256 hash, got %s", h)
+	}
+	for _, same := range []string{
+		"# Users\nquery A {\n  users(first: 2) {\n    ...F\n  }\n}\n\nfragment F on User {\n  name\n}\n",
+		`query B { user { ...G } } query A { users(first: 2) { ...F } } fragment G on User { pets { __typename } } fragment F on User { name }`,
+	} {
+		if other := hash(same, "A"); other != h {
+			t.Errorf("Expected %q to hash to %s, got %s", same, h, other)
+		}
+	}
+	for _, different := range []string{
+		`query A { users(first: 3) { ...F } } fragment F on User { name }`,
+		`query B { users(first: 2) { ...F } } fragment F on User { name }`,
+		`query A { users(first: 2) { ...F } } fragment F on User { name friends { name } }`,
+	} {
+		if other := hash(different, ""); other == h {
+			t.Errorf("Expected %q to hash differently", different)
+		}
+	}
+}
+
+func TestQueryPrint(t *testing.T) {
+	q, err := PrepareQuery(`query B { user { ...G } }
+query A { users(first: 2) { ...F } }
+fragment G on User { pets { __typename } }
+fragment F on User { name ...H }
+fragment H on User { friends(first: 1) { name } }`, "A", buildTestSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `query A{users(first:0){...F}} fragment F on User{name ...H} fragment H on User{friends(first:0){name}}`
+	if s := q.Print(ast.PrintOptions{Canonical: true, HideLiterals: true}); s != expected {
+		t.Errorf("Expected %s, got %s", expected, s)
+	}
+}
@@ -36,7 +36,7 @@ func buildNotNilSelector(cc *compileContext, typ *schema.NotNilType, selections
 }
 
 func (s notNilSelector) prepareCollector(c collector) {
-	c.Required(s.row, s.col)
+	c.Required(s.field)
 }
 
 func (s notNilSelector) apply(ctx exeContext, value interface{}, collector collector) contFunc {
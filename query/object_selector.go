@@ -16,6 +16,7 @@ package query
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/housecanary/gq/ast"
@@ -25,9 +26,26 @@ import (
 // An objectSelector runs the resolver for each selected field, and then passes the
 // resolved value to the proper selector for that field to further select fields from
 // the resolved value.
+//
+// If Serial is set, each field (including all of its asynchronous sub selections)
+// is fully resolved before resolution of the next field begins.  This is used for the
+// top level fields of mutations.
+//
+// Fields selected by a fragment with a @defer directive are also selected by a
+// selector in Deferred, which is used instead of the field when the results of the
+// fragment are delivered separately.
 type objectSelector struct {
 	defaultSelector
-	Fields []*objectSelectorField
+	Type     *schema.ObjectType
+	Fields   []*objectSelectorField
+	Serial   bool
+	Deferred []deferredSelector
+}
+
+// A deferredSelector selects the fields of a deferred fragment
+type deferredSelector struct {
+	Usage *deferUsage
+	Sel   *objectSelector
 }
 
 type objectSelectorField struct {
@@ -37,65 +55,130 @@ type objectSelectorField struct {
 	ArgValues     map[string]ast.Value
 	ArgResolvers  map[string]argumentResolver
 	DefaultValues map[string]schema.LiteralValue
-	Row           int
-	Col           int
+	Conditions    fieldConditionSet
+	Defer         *deferUsage
+	CacheHint     cacheHint
 }
 
 type argumentResolver func(context.Context, schema.LiteralValue) (interface{}, error)
 
+// A fieldCondition is a @skip or @include directive whose argument is a variable,
+// and thus must be evaluated at execution time.
+type fieldCondition struct {
+	Variable string
+	Include  bool
+}
+
+type fieldConditions []fieldCondition
+
+// included returns whether a field with these conditions should be selected
+// given the supplied variables
+func (c fieldConditions) included(variables Variables) bool {
+	for _, cond := range c {
+		v, _ := variables[cond.Variable].(schema.LiteralBool)
+		if bool(v) != cond.Include {
+			return false
+		}
+	}
+	return true
+}
+
+// directives returns the @skip and @include directives equivalent to the conditions
+func (c fieldConditions) directives() ast.Directives {
+	directives := make(ast.Directives, len(c))
+	for i, cond := range c {
+		name := schema.SkipDirective.Name()
+		if cond.Include {
+			name = schema.IncludeDirective.Name()
+		}
+		directives[i] = &ast.Directive{
+			Name:      name,
+			Arguments: ast.Arguments{{Name: "if", Value: ast.ReferenceValue{Name: cond.Variable}}},
+		}
+	}
+	return directives
+}
+
+// A fieldConditionSet holds the conditions of each of the selections that were
+// merged into a field.  The field is selected if the conditions of any of
+// the selections hold.  An empty set always selects the field.
+type fieldConditionSet []fieldConditions
+
+// included returns whether a field with these conditions should be selected
+// given the supplied variables
+func (s fieldConditionSet) included(variables Variables) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for _, c := range s {
+		if c.included(variables) {
+			return true
+		}
+	}
+	return false
+}
+
 func buildObjectSelector(cc *compileContext, typ *schema.ObjectType, selections ast.SelectionSet) (selector, error) {
-	os := objectSelector{defaultSelector: cc.newDefaultSelector()}
-	for _, sel := range selections {
-		switch v := sel.(type) {
-		case *ast.FieldSelection:
-			if err := os.addField(cc, typ, v.Field); err != nil {
-				return nil, err
-			}
-		case *ast.FragmentSpreadSelection:
-			fragDef := cc.LookupFragmentDefinition(v.FragmentName)
-			if fragDef == nil {
-				// TODO locate error
-				return nil, fmt.Errorf("Unknown fragment %s", v.FragmentName)
-			}
+	os := objectSelector{defaultSelector: cc.newDefaultSelector(), Type: typ}
+	fields, err := cc.expandFragment(typ.Name(), selections, typ, nil, nil)
+	if err != nil {
+		return nil, err
+	}
 
-			fragFields, err := cc.expandFragment(fragDef.OnType, fragDef.SelectionSet, typ)
-			if err != nil {
-				return nil, err
-			}
-			for _, field := range fragFields {
-				if err := os.addField(cc, typ, field); err != nil {
-					return nil, err
-				}
-			}
+	for _, field := range mergeFields(fields) {
+		if err := os.addField(cc, typ, field.Field, field.Conditions, field.Defer); err != nil {
+			return nil, err
+		}
+	}
 
-		case *ast.InlineFragmentSelection:
-			fragFields, err := cc.expandFragment(v.OnType, v.SelectionSet, typ)
-			if err != nil {
-				return nil, err
-			}
-			for _, field := range fragFields {
-				if err := os.addField(cc, typ, field); err != nil {
-					return nil, err
-				}
+	for _, f := range os.Fields {
+		if f.Defer == nil {
+			continue
+		}
+		var ds *deferredSelector
+		for i := range os.Deferred {
+			if os.Deferred[i].Usage == f.Defer {
+				ds = &os.Deferred[i]
 			}
 		}
+		if ds == nil {
+			os.Deferred = append(os.Deferred, deferredSelector{f.Defer, &objectSelector{defaultSelector: os.defaultSelector, Type: typ}})
+			ds = &os.Deferred[len(os.Deferred)-1]
+		}
+		// Within the deferred selector the field is selected normally
+		df := *f
+		df.Defer = nil
+		ds.Sel.Fields = append(ds.Sel.Fields, &df)
 	}
 	return &os, nil
 }
 
-func (s *objectSelector) addField(cc *compileContext, typ *schema.ObjectType, astField ast.Field) error {
+func (s *objectSelector) addField(cc *compileContext, typ *schema.ObjectType, astField ast.Field, conds fieldConditionSet, deferred *deferUsage) error {
+	fc := cc.withField(astField)
 	schemaField := typ.Field(astField.Name)
 	if schemaField == nil {
-		// TODO located error
-		return fmt.Errorf("Unknown field %s", astField.Name)
+		return fc.errorf("FieldsOnCorrectType", "Unknown field %s", astField.Name)
+	}
+	if err := fc.countField(astField); err != nil {
+		return err
 	}
 	fieldType := schemaField.Type()
-	childSelector, err := buildSelector(cc.withLocation(astField.Row, astField.Col), fieldType, astField.SelectionSet)
+	childSelector, err := buildSelector(fc, fieldType, astField.SelectionSet)
+	if err != nil {
+		return err
+	}
+	stream, err := fc.fieldStream(astField.Directives)
 	if err != nil {
 		return err
 	}
+	if stream != nil {
+		childSelector = withStream(childSelector, stream)
+	}
 	argValues := make(map[string]ast.Value)
 	for _, arg := range astField.Arguments {
+		if err := fc.withLocation(arg.Row, arg.Col).checkVariableReferences(arg.Value); err != nil {
+			return err
+		}
 		argValues[arg.Name] = arg.Value
 	}
 	defaultValues := make(map[string]schema.LiteralValue)
@@ -117,13 +200,23 @@ func (s *objectSelector) addField(cc *compileContext, typ *schema.ObjectType, as
 		ArgValues:     argValues,
 		ArgResolvers:  argResolvers,
 		DefaultValues: defaultValues,
-		Row:           astField.Row,
-		Col:           astField.Col,
+		Conditions:    conds,
+		Defer:         deferred,
+		CacheHint:     buildCacheHint(schemaField, len(cc.path) == 0),
 	})
 
 	return nil
 }
 
+// notifyResolve notifies the listener that field f of an object of type typ is
+// about to be resolved.  ctx is the context of the field value.
+func notifyResolve(ctx exeContext, typ *schema.ObjectType, f *objectSelectorField) (ResolveCompleteCallback, error) {
+	if ctx.fieldListener != nil {
+		return ctx.fieldListener.NotifyResolveField(&FieldInfo{f.AstField, f.Field, typ, ctx.path.slice()})
+	}
+	return ctx.listener.NotifyResolve(f.AstField, f.Field)
+}
+
 func maybeNotifyCb(v interface{}, err error, cb ResolveCompleteCallback) (interface{}, error) {
 	if cb == nil {
 		return v, err
@@ -142,7 +235,7 @@ func safeResolve(ctx exeContext, value interface{}, f *objectSelectorField, cb R
 	resolver := f.Field.Resolver()
 	var resolverContext context.Context = ctx
 	if resolver.NeedsFullContext() {
-		resolverContext = &resolverContextImpl{ctx, fieldWalker{f.Sel, f.AstField}, f}
+		resolverContext = &resolverContextImpl{ctx, fieldWalker{f.Sel, f.AstField, ctx.variables}, f}
 	}
 
 	if sr, ok := resolver.(schema.SafeResolver); ok {
@@ -155,11 +248,7 @@ func safeResolve(ctx exeContext, value interface{}, f *objectSelectorField, cb R
 		defer func() {
 			if r := recover(); r != nil {
 				fieldValue = nil
-				if re, ok := r.(error); ok {
-					err = re
-				} else {
-					err = fmt.Errorf("%v", r)
-				}
+				err = newPanicError(r)
 			}
 
 			fieldValue, err = maybeNotifyCb(fieldValue, err, cb)
@@ -177,42 +266,74 @@ func safeAsync(ctx exeContext, async schema.AsyncValue, f *objectSelectorField,
 	return func() (ret contFunc) {
 		defer func() {
 			if r := recover(); r != nil {
-				var err error
-				if re, ok := r.(error); ok {
-					err = re
-				} else {
-					err = fmt.Errorf("%v", r)
-				}
+				ret = asyncFailed(ctx, newPanicError(r), f, fieldCollector, cb)
+			}
+		}()
 
-				if cb != nil {
-					err = cb(nil, err)
-				}
+		if err := ctx.contextError(); err != nil {
+			// Awaiting could block long after the deadline has passed
+			return asyncFailed(ctx, err, f, fieldCollector, cb)
+		}
 
-				if err != nil {
-					ctx.listener.NotifyError(err)
-					fieldCollector.Error(err, f.Row, f.Col)
+		if ctx.awaits != nil {
+			// Await concurrently with the other values of this round, and collect
+			// the result in the second pass over the round (see advanceRound)
+			result := ctx.awaits.await(ctx, async)
+			return func() (ret contFunc) {
+				defer func() {
+					if r := recover(); r != nil {
+						ret = asyncFailed(ctx, newPanicError(r), f, fieldCollector, cb)
+					}
+				}()
+
+				select {
+				case r := <-result:
+					return asyncResolved(ctx, r.value, r.err, f, fieldCollector, cb)
+				case <-ctx.done:
+					return asyncFailed(ctx, ctx.contextError(), f, fieldCollector, cb)
 				}
-
-				ret = nil
 			}
-		}()
+		}
 
 		value, err := async.Await(ctx)
-		value, err = maybeNotifyCb(value, err, cb)
+		return asyncResolved(ctx, value, err, f, fieldCollector, cb)
+	}
+}
 
-		if err != nil {
-			ctx.listener.NotifyError(err)
-			fieldCollector.Error(err, f.Row, f.Col)
-			return nil
+// asyncResolved continues selecting a field once its async value has been awaited
+func asyncResolved(ctx exeContext, value interface{}, err error, f *objectSelectorField, fieldCollector collector, cb ResolveCompleteCallback) contFunc {
+	if err != nil {
+		if cerr := ctx.contextError(); cerr != nil && errors.Is(err, ctx.Err()) {
+			// The value gave up waiting because the context is done
+			err = cerr
 		}
+	}
+	value, err = maybeNotifyCb(value, err, cb)
 
-		// The returned value was still async.  Schedule it to run again
-		if async, ok := value.(schema.AsyncValue); ok {
-			return safeAsync(ctx, async, f, fieldCollector, cb)
-		}
-		ret = f.Sel.apply(ctx, value, fieldCollector)
-		return
+	if err != nil {
+		ctx.listener.NotifyError(err)
+		fieldCollector.Error(err, f.AstField)
+		return nil
+	}
+
+	// The returned value was still async.  Schedule it to run again
+	if async, ok := value.(schema.AsyncValue); ok {
+		return safeAsync(ctx, async, f, fieldCollector, cb)
 	}
+	return f.Sel.apply(ctx, value, fieldCollector)
+}
+
+// asyncFailed reports an error that prevented awaiting the async value of a field
+func asyncFailed(ctx exeContext, err error, f *objectSelectorField, fieldCollector collector, cb ResolveCompleteCallback) contFunc {
+	if cb != nil {
+		err = cb(nil, err)
+	}
+
+	if err != nil {
+		ctx.listener.NotifyError(err)
+		fieldCollector.Error(err, f.AstField)
+	}
+	return nil
 }
 
 func (s *objectSelector) apply(ctx exeContext, value interface{}, collector collector) contFunc {
@@ -223,30 +344,62 @@ func (s *objectSelector) apply(ctx exeContext, value interface{}, collector coll
 	valueCollector := collector.Object(len(s.Fields))
 	var deferred worklist
 	for _, f := range s.Fields {
+		if !f.Conditions.included(ctx.variables) {
+			continue
+		}
+		if f.Defer != nil && ctx.incremental != nil && f.Defer.active(ctx.variables) {
+			// Selected by the deferred selector instead
+			continue
+		}
 		currentField := f
+		fieldCtx := ctx.withPathKey(currentField.AstField.Alias)
 		fieldCollector := valueCollector.Field(currentField.AstField.Alias)
 		currentField.Sel.prepareCollector(fieldCollector)
 
-		cb, err := ctx.listener.NotifyResolve(currentField.AstField, currentField.Field)
+		if err := ctx.contextError(); err != nil {
+			ctx.listener.NotifyError(err)
+			fieldCollector.Error(err, currentField.AstField)
+			continue
+		}
+
+		if ctx.cache != nil {
+			ctx.cache.add(fieldCtx, currentField.CacheHint)
+		}
+
+		cb, err := notifyResolve(fieldCtx, s.Type, currentField)
 		if err != nil {
-			fieldCollector.Error(err, currentField.Row, currentField.Col)
+			fieldCollector.Error(err, currentField.AstField)
 			continue
 		}
 
-		value, err := safeResolve(ctx, value, currentField, cb)
+		value, err := safeResolve(fieldCtx, value, currentField, cb)
 		if err != nil {
-			fieldCollector.Error(err, currentField.Row, currentField.Col)
+			fieldCollector.Error(err, currentField.AstField)
 			continue
 		}
+		var cont contFunc
 		if async, ok := value.(schema.AsyncValue); ok {
-			deferred.Add(safeAsync(ctx, async, currentField, fieldCollector, cb))
+			cont = safeAsync(fieldCtx, async, currentField, fieldCollector, cb)
 		} else {
-			deferred.Add(currentField.Sel.apply(ctx, value, fieldCollector))
+			cont = currentField.Sel.apply(fieldCtx, value, fieldCollector)
+		}
+
+		if s.Serial {
+			// Drain all work for this field before moving on to the next one
+			for cont != nil {
+				cont = advanceRound(ctx.listener, ctx.awaits, cont)
+			}
+			continue
 		}
+		deferred.Add(cont)
+	}
 
-		// FUTURE: If and when we support mutations, instead of adding contFunc
-		// to the worklist, we should immediately NotifyIdle() and call contFunc
-		// to ensure serial execution order
+	if ctx.incremental != nil {
+		for _, d := range s.Deferred {
+			if d.Usage.active(ctx.variables) {
+				ctx.incremental.add(ctx, d.Usage.Label, d.Sel, value, nil)
+			}
+		}
 	}
 
 	if len(deferred) > 0 {
@@ -263,8 +416,9 @@ type resolverContextImpl struct {
 }
 
 type fieldWalker struct {
-	sel   selector
-	field *ast.Field
+	sel       selector
+	field     *ast.Field
+	variables Variables
 }
 
 func (c *resolverContextImpl) GetArgumentValue(name string) (interface{}, error) {
@@ -277,14 +431,14 @@ func (c *resolverContextImpl) GetArgumentValue(name string) (interface{}, error)
 	if !ok {
 		rv, err := argResolver(c, c.f.DefaultValues[name])
 		if err != nil {
-			err = fmt.Errorf("Error in argument %s: %v", name, err)
+			err = fmt.Errorf("Error in argument %s: %w", name, err)
 		}
 		return rv, err
 	}
 
 	rv, err := argResolver(c, c.astValueToLiteralValue(val))
 	if err != nil {
-		err = fmt.Errorf("Error in argument %s: %v", name, err)
+		err = fmt.Errorf("Error in argument %s: %w", name, err)
 	}
 	return rv, err
 }
@@ -292,7 +446,10 @@ func (c *resolverContextImpl) GetArgumentValue(name string) (interface{}, error)
 func (f fieldWalker) WalkChildSelections(cb schema.FieldWalkCB) bool {
 	walkObjectSelections := func(o *objectSelector) bool {
 		for _, c := range o.Fields {
-			abort := cb(c.AstField, c.Field, fieldWalker{c.Sel, c.AstField})
+			if !c.Conditions.included(f.variables) {
+				continue
+			}
+			abort := cb(c.AstField, c.Field, fieldWalker{c.Sel, c.AstField, f.variables})
 			if abort {
 				return true
 			}
@@ -334,6 +491,12 @@ func (f fieldWalker) WalkChildSelections(cb schema.FieldWalkCB) bool {
 }
 
 func (c *resolverContextImpl) astValueToLiteralValue(val ast.Value) schema.LiteralValue {
+	return astValueToLiteralValue(val, c.exeContext.variables)
+}
+
+// astValueToLiteralValue converts an argument value from a query to a literal,
+// replacing references to variables with their values
+func astValueToLiteralValue(val ast.Value, variables Variables) schema.LiteralValue {
 	switch v := val.(type) {
 	case ast.StringValue:
 		return schema.LiteralString(v.V)
@@ -350,17 +513,17 @@ func (c *resolverContextImpl) astValueToLiteralValue(val ast.Value) schema.Liter
 	case ast.ArrayValue:
 		ary := make(schema.LiteralArray, len(v.V))
 		for i, e := range v.V {
-			ary[i] = c.astValueToLiteralValue(e)
+			ary[i] = astValueToLiteralValue(e, variables)
 		}
 		return ary
 	case ast.ObjectValue:
 		m := make(schema.LiteralObject)
 		for k, e := range v.V {
-			m[k] = c.astValueToLiteralValue(e)
+			m[k] = astValueToLiteralValue(e, variables)
 		}
 		return m
 	case ast.ReferenceValue:
-		return c.variables[v.Name]
+		return variables[v.Name]
 	}
 	panic(fmt.Errorf("Unknown ast value %v", val))
 }
@@ -133,7 +133,7 @@ func TestObjectSelectorSimplePanic(t *testing.T) {
 	listener := &assertExecutionListener{
 		assertions: []executionListenerAssertion{
 			resolveAssertion{queryField: queryField, schemaField: schemaField},
-			errorAssertion{err: err},
+			panicAssertion{value: err},
 		},
 	}
 	os.apply(exeContext{
@@ -245,7 +245,7 @@ func TestObjectSelectorAsyncPanic(t *testing.T) {
 	listener := &assertExecutionListener{
 		assertions: []executionListenerAssertion{
 			resolveAssertion{queryField: queryField, schemaField: schemaField},
-			errorAssertion{err: err},
+			panicAssertion{value: err},
 		},
 	}
 	cont := os.apply(exeContext{
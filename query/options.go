@@ -0,0 +1,138 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+
+	"github.com/housecanary/gq/ast"
+)
+
+// An ExecutionOption customizes how a query is executed.  Options are passed to
+// PreparedQuery.Execute, PreparedQuery.Subscribe and Batch.Execute.
+type ExecutionOption func(*executionOptions)
+
+type executionOptions struct {
+	errorPresenter        ErrorPresenter
+	maxConcurrentAwaits   int
+	cachePolicy           func(CachePolicy)
+	defaultMaxAge         int
+	cacheControlExtension bool
+}
+
+func newExecutionOptions(opts []ExecutionOption) executionOptions {
+	var o executionOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// An ErrorPresenter converts an error raised during execution into the error
+// reported to the client.  It receives the original error, the response path of
+// the value that failed (nil for errors raised before execution began) and the
+// query field that failed (nil if the error is not associated with a field).
+//
+// The presenter may return a different error to mask or rewrite the message, or
+// to attach extensions by returning an ExtendedError.  If it returns nil, the
+// original error is reported unchanged.
+type ErrorPresenter func(ctx context.Context, err error, path []interface{}, field *ast.Field) error
+
+// WithErrorPresenter sets the ErrorPresenter used to convert errors before they
+// are serialized into the result.
+//
+// Panics recovered from resolvers are reported as a *PanicError, so a presenter
+// can use errors.As to hide their details from clients.
+func WithErrorPresenter(p ErrorPresenter) ExecutionOption {
+	return func(o *executionOptions) {
+		o.errorPresenter = p
+	}
+}
+
+// WithConcurrentAwaits awaits async values concurrently, on up to n goroutines per
+// execution.
+//
+// By default the async values returned by resolvers are awaited one after another.
+// With this option the values that are ready to be awaited after each call to
+// ExecutionListener.NotifyIdle are awaited concurrently, and their results are
+// selected once they are all available.  Resolvers, listeners and the selection of
+// results still run on the calling goroutine, so the output is the same as without
+// this option, but AsyncValue.Await must be safe to call from other goroutines.
+func WithConcurrentAwaits(n int) ExecutionOption {
+	return func(o *executionOptions) {
+		o.maxConcurrentAwaits = n
+	}
+}
+
+// WithCachePolicy computes the cache policy of the result from the @cacheControl
+// hints of the fields that are resolved (see schema.Builder.EnableCacheControl),
+// and calls f with it once execution is complete, before the result is written.
+//
+// The maxAge of the policy is the smallest maxAge of the resolved fields.  A field
+// with no hint of its own takes the maxAge of the type it returns.  Root fields and
+// fields returning objects, interfaces or unions with no hint use the default
+// maxAge (see WithDefaultMaxAge), while fields returning scalars and enums with
+// no hint do not restrict the policy.  The scope is private if any resolved field,
+// or the type it returns, has a private scope.  A result with errors is never
+// cacheable.
+//
+// The policy is reported by Execute, ExecuteTo, ExecuteToValue and Batch.Execute,
+// once for each query of a batch.  Results delivered incrementally or by
+// subscriptions have no cache policy.
+func WithCachePolicy(f func(CachePolicy)) ExecutionOption {
+	return func(o *executionOptions) {
+		o.cachePolicy = f
+	}
+}
+
+// WithDefaultMaxAge sets the maxAge, in seconds, of root fields and fields
+// returning composite types that have no @cacheControl hint.  The default is 0,
+// so a result is only cacheable if all such fields have hints.
+func WithDefaultMaxAge(seconds int) ExecutionOption {
+	return func(o *executionOptions) {
+		o.defaultMaxAge = seconds
+	}
+}
+
+// WithCacheControlExtension adds the cache hints of the resolved fields to the
+// cacheControl entry of the extensions of the result, in the format used by
+// Apollo Server:
+//
+//	{"version": 1, "hints": [{"path": ["user"], "maxAge": 60, "scope": "PRIVATE"}]}
+func WithCacheControlExtension() ExecutionOption {
+	return func(o *executionOptions) {
+		o.cacheControlExtension = true
+	}
+}
+
+// reportCachePolicy calls the function set by WithCachePolicy, if any
+func (o *executionOptions) reportCachePolicy(p CachePolicy) {
+	if o.cachePolicy != nil {
+		o.cachePolicy(p)
+	}
+}
+
+// presentErrors applies the configured ErrorPresenter, if any, to errs
+func (o *executionOptions) presentErrors(ctx context.Context, errs []gqlError) []gqlError {
+	if o == nil || o.errorPresenter == nil {
+		return errs
+	}
+	for i, e := range errs {
+		if presented := o.errorPresenter(ctx, e.error, e.path, e.field); presented != nil {
+			errs[i].error = presented
+		}
+	}
+	return errs
+}
@@ -17,11 +17,15 @@ package query
 import (
 	"context"
 	"fmt"
+	"io"
+	"sync"
+	"time"
 
 	jsonstream "github.com/json-iterator/go"
 
 	"github.com/housecanary/gq/ast"
 	"github.com/housecanary/gq/internal/pkg/parser"
+	"github.com/housecanary/gq/query/validation"
 	"github.com/housecanary/gq/schema"
 )
 
@@ -53,42 +57,174 @@ type ResolveCompleteCallback func(interface{}, error) error
 // A BaseExecutionListener implements ExecutionListener to do nothing
 type BaseExecutionListener struct{}
 
+// A FieldExecutionListener is an ExecutionListener that is told where in the
+// response each field is resolved.  If a listener implements this interface,
+// NotifyResolveField is called in place of NotifyResolve.
+type FieldExecutionListener interface {
+	ExecutionListener
+
+	// Notifies that execution is entering the selection of the described field.
+	// The return values are used as for NotifyResolve.
+	NotifyResolveField(info *FieldInfo) (ResolveCompleteCallback, error)
+}
+
+// FieldInfo describes a field that is about to be resolved
+type FieldInfo struct {
+	QueryField  *ast.Field
+	SchemaField *schema.FieldDescriptor
+
+	// ParentType is the type of the object the field is resolved on
+	ParentType *schema.ObjectType
+
+	// Path is the response path of the value of the field
+	Path []interface{}
+}
+
+// An ExtensionsListener is an ExecutionListener that contributes entries to the
+// extensions object of the response.  ResponseExtensions is called once execution
+// is complete, and the values it returns must be serializable to JSON.
+//
+// A listener shared by a Batch contributes the same extensions to the result of
+// each query.
+type ExtensionsListener interface {
+	ExecutionListener
+	ResponseExtensions() map[string]interface{}
+}
+
+// PrepareTimings reports how long the steps of preparing a query took
+type PrepareTimings struct {
+	// Start is when preparation began
+	Start time.Time
+
+	// Parsing is the time spent parsing the query text
+	Parsing time.Duration
+
+	// Validation is the time spent validating and compiling the parsed query
+	Validation time.Duration
+}
+
 // A PreparedQuery is a compiled query that can be executed given a root value and
 // query context
 type PreparedQuery struct {
-	root selector
+	root          selector
+	operationType ast.OperationType
+	variables     []*variableDefinition
+	timings       PrepareTimings
+	fieldCount    int
+
+	document  *ast.Document
+	operation *ast.OperationDefinition
+	hashOnce  sync.Once
+	hash      string
+}
+
+// PrepareTimings returns how long preparing this query took
+func (q *PreparedQuery) PrepareTimings() PrepareTimings {
+	return q.timings
 }
 
 // Execute runs this query, and returns the serialized results.
-func (q *PreparedQuery) Execute(ctx context.Context, rootValue interface{}, variables Variables, listener ExecutionListener) []byte {
+//
+// The supplied variables are first validated against the variables declared by
+// the query.  If any are invalid, no resolvers are run and the result contains only
+// the list of problems.
+func (q *PreparedQuery) Execute(ctx context.Context, rootValue interface{}, variables Variables, listener ExecutionListener, opts ...ExecutionOption) []byte {
 	if listener == nil {
 		listener = BaseExecutionListener{}
 	}
-	var deferred worklist
-	cc := acquireJSONCollectorContext()
-	collector := &vJSONCollector{cc: cc}
-	q.root.prepareCollector(collector)
-	deferred.Add(q.root.apply(exeContext{ctx, listener, variables}, rootValue, collector))
-	if deferred != nil {
-		for cont := deferred.Continue; cont != nil; {
-			listener.NotifyIdle()
-			cont = cont()
+	options := newExecutionOptions(opts)
+	coerced, errs := coerceVariables(ctx, q.variables, variables)
+	if errs != nil {
+		options.reportCachePolicy(CachePolicy{Scope: CacheScopePublic})
+		return serializeRequestErrors(ctx, listener, &options, errs)
+	}
+	return executeSelector(newExeContext(ctx, listener, coerced, &options), q.executionRoot(), rootValue)
+}
+
+// ExecuteTo runs this query like Execute, but writes the serialized results to w.
+// This avoids the second, buffered copy of the response that Execute returns: the
+// collected values are flushed to w in chunks as they are serialized.  All values
+// are still collected before anything is written, since a null propagated from a
+// late failure can replace values that completed earlier.
+//
+// An error is returned only if writing to w fails.
+func (q *PreparedQuery) ExecuteTo(ctx context.Context, w io.Writer, rootValue interface{}, variables Variables, listener ExecutionListener, opts ...ExecutionOption) error {
+	if listener == nil {
+		listener = BaseExecutionListener{}
+	}
+	options := newExecutionOptions(opts)
+	stream := streamPool.BorrowStream(w)
+	defer streamPool.ReturnStream(stream)
+
+	coerced, errs := coerceVariables(ctx, q.variables, variables)
+	if errs != nil {
+		options.reportCachePolicy(CachePolicy{Scope: CacheScopePublic})
+		writeRequestErrors(ctx, stream, listener, &options, errs)
+	} else {
+		exeCtx := newExeContext(ctx, listener, coerced, &options)
+		cc := acquireJSONCollectorContext()
+		collector := &vJSONCollector{cc: cc}
+		drainSelector(exeCtx, q.executionRoot(), rootValue, collector)
+		writeResult(exeCtx, stream, collector)
+		collector.release()
+		cc.release()
+	}
+	return stream.Flush()
+}
+
+// ExecuteToValue runs this query like Execute, but returns the results as Go values
+// rather than serialized JSON.  This avoids serializing and then parsing the results
+// when the query is run in process.
+func (q *PreparedQuery) ExecuteToValue(ctx context.Context, rootValue interface{}, variables Variables, listener ExecutionListener, opts ...ExecutionOption) *Result {
+	if listener == nil {
+		listener = BaseExecutionListener{}
+	}
+	options := newExecutionOptions(opts)
+	coerced, errs := coerceVariables(ctx, q.variables, variables)
+	if errs != nil {
+		options.reportCachePolicy(CachePolicy{Scope: CacheScopePublic})
+		gqlErrors := make([]gqlError, len(errs))
+		for i, err := range errs {
+			listener.NotifyError(err)
+			gqlErrors[i] = gqlError{error: err}
 		}
+		return &Result{Errors: newResultErrors(options.presentErrors(ctx, gqlErrors))}
 	}
 
-	stream := streamPool.BorrowStream(nil)
+	exeCtx := newExeContext(ctx, listener, coerced, &options)
+	collector := &valueCollector{}
+	drainSelector(exeCtx, q.executionRoot(), rootValue, collector)
+	data, gqlErrors, _ := collector.collectValue(0)
+	if exeCtx.cache != nil {
+		options.reportCachePolicy(exeCtx.cache.policy(len(gqlErrors) > 0))
+	}
+	result := &Result{Errors: newResultErrors(options.presentErrors(ctx, gqlErrors))}
+	result.Extensions = responseExtensions(exeCtx)
+	if obj, ok := data.(ResultObject); ok {
+		result.Data = obj
+	}
+	return result
+}
 
-	stream.WriteObjectStart()
-	stream.WriteObjectField("data")
-	errors, ok := collector.serializeJSON(stream, 0)
-	if !ok {
-		stream.Reset(nil)
-		stream.WriteObjectStart()
-		stream.WriteObjectField("data")
-		stream.WriteNil()
+// executionRoot returns the selector used to execute this query via Execute
+func (q *PreparedQuery) executionRoot() selector {
+	if q.operationType == ast.OperationTypeSubscription {
+		// Subscriptions produce a stream of results, and can only be run via
+		// Subscribe
+		return errorSelector{errSubscriptionExecute}
 	}
-	serializeErrors(stream, errors)
-	stream.WriteObjectEnd()
+	return q.root
+}
+
+// executeSelector applies sel to value, drains all resulting work, and
+// returns the serialized results.
+func executeSelector(ctx exeContext, sel selector, value interface{}) []byte {
+	cc := acquireJSONCollectorContext()
+	collector := &vJSONCollector{cc: cc}
+	drainSelector(ctx, sel, value, collector)
+
+	stream := streamPool.BorrowStream(nil)
+	writeResult(ctx, stream, collector)
 
 	collector.release()
 	cc.release()
@@ -100,6 +236,86 @@ func (q *PreparedQuery) Execute(ctx context.Context, rootValue interface{}, vari
 	return content
 }
 
+// writeResult writes the response object for the values gathered by collector to
+// stream
+func writeResult(ctx exeContext, stream *jsonstream.Stream, collector *vJSONCollector) {
+	// Settle the result before writing anything, so that the cache policy is
+	// reported before any output is flushed
+	errors, ok := collector.settle(0)
+	if ctx.cache != nil {
+		ctx.options.reportCachePolicy(ctx.cache.policy(len(errors) > 0))
+	}
+
+	stream.WriteObjectStart()
+	stream.WriteObjectField("data")
+	if ok {
+		collector.writeJSON(stream)
+	} else {
+		stream.WriteNil()
+	}
+	serializeErrors(stream, ctx.options.presentErrors(ctx, errors))
+	writeExtensions(stream, responseExtensions(ctx))
+	stream.WriteObjectEnd()
+}
+
+// responseExtensions returns the extensions of the response of an execution:
+// those contributed by the listener, and the cacheControl extension if enabled
+func responseExtensions(ctx exeContext) map[string]interface{} {
+	extensions := listenerExtensions(ctx.listener)
+	if ctx.cache != nil && ctx.cache.extension {
+		merged := make(map[string]interface{}, len(extensions)+1)
+		for k, v := range extensions {
+			merged[k] = v
+		}
+		merged["cacheControl"] = ctx.cache.extensionValue()
+		extensions = merged
+	}
+	return extensions
+}
+
+// listenerExtensions returns the extensions contributed by listener, if any
+func listenerExtensions(listener ExecutionListener) map[string]interface{} {
+	el, ok := listener.(ExtensionsListener)
+	if !ok {
+		return nil
+	}
+	return el.ResponseExtensions()
+}
+
+// writeExtensions writes the extensions entry of a response object, if there
+// are any extensions
+func writeExtensions(stream *jsonstream.Stream, extensions map[string]interface{}) {
+	if len(extensions) == 0 {
+		return
+	}
+	stream.WriteMore()
+	stream.WriteObjectField("extensions")
+	writeSortedVal(stream, extensions)
+}
+
+// writeResultFields writes the data and errors entries of a response object
+func writeResultFields(ctx exeContext, stream *jsonstream.Stream, collector *vJSONCollector) {
+	stream.WriteObjectField("data")
+	errors, ok := collector.serializeJSON(stream, 0)
+	if !ok {
+		stream.WriteNil()
+	}
+	serializeErrors(stream, ctx.options.presentErrors(ctx, errors))
+}
+
+// drainSelector applies sel to value, reporting results to collector, and drains
+// all resulting work.
+func drainSelector(ctx exeContext, sel selector, value interface{}, collector collector) {
+	var deferred worklist
+	sel.prepareCollector(collector)
+	deferred.Add(sel.apply(ctx, value, collector))
+	if deferred != nil {
+		for cont := deferred.Continue; cont != nil; {
+			cont = advanceRound(ctx.listener, ctx.awaits, cont)
+		}
+	}
+}
+
 // Batch contains a batch of queries that execute together using the same context and listener
 type Batch struct {
 	queries    []*PreparedQuery
@@ -115,52 +331,59 @@ func (b *Batch) Add(q *PreparedQuery, rootValue interface{}, variables Variables
 }
 
 // Execute executes the entire batch of queries
-func (b *Batch) Execute(ctx context.Context, listener ExecutionListener) [][]byte {
+func (b *Batch) Execute(ctx context.Context, listener ExecutionListener, opts ...ExecutionOption) [][]byte {
 	// NOTE: This code contains a good deal of duplication with PreparedQuery.Execute
 	// Need to consider if this common code can be factored out.
 	if listener == nil {
 		listener = BaseExecutionListener{}
 	}
+	options := newExecutionOptions(opts)
 
 	// Start execution of all queries onto a consolidated worklist.  This will
 	// let us group loads across all queries in the batch.
 	var deferred worklist
+	results := make([][]byte, len(b.queries))
 	collectors := make([]*vJSONCollector, len(b.queries))
+	exeCtxs := make([]exeContext, len(b.queries))
+	var awaits *awaitPool
 	for i, q := range b.queries {
+		variables, errs := coerceVariables(ctx, q.variables, b.variables[i])
+		if errs != nil {
+			options.reportCachePolicy(CachePolicy{Scope: CacheScopePublic})
+			results[i] = serializeRequestErrors(ctx, listener, &options, errs)
+			continue
+		}
 		cc := acquireJSONCollectorContext()
 		defer cc.release()
 		collector := &vJSONCollector{cc: cc}
 		collectors[i] = collector
+		exeCtxs[i] = newExeContext(ctx, listener, variables, &options)
+		if awaits == nil {
+			awaits = exeCtxs[i].awaits
+		} else {
+			// All queries of the batch share the concurrency limit
+			exeCtxs[i].awaits = awaits
+		}
 		rootValue := b.rootValues[i]
-		variables := b.variables[i]
-		q.root.prepareCollector(collector)
-		deferred.Add(q.root.apply(exeContext{ctx, listener, variables}, rootValue, collector))
+		root := q.executionRoot()
+		root.prepareCollector(collector)
+		deferred.Add(root.apply(exeCtxs[i], rootValue, collector))
 	}
 
 	// Drain the worklist
 	if deferred != nil {
 		for cont := deferred.Continue; cont != nil; {
-			listener.NotifyIdle()
-			cont = cont()
+			cont = advanceRound(listener, awaits, cont)
 		}
 	}
 
 	// Prepare the results
-	results := make([][]byte, len(b.queries))
 	for i, collector := range collectors {
-		stream := streamPool.BorrowStream(nil)
-
-		stream.WriteObjectStart()
-		stream.WriteObjectField("data")
-		errors, ok := collector.serializeJSON(stream, 0)
-		if !ok {
-			stream.Reset(nil)
-			stream.WriteObjectStart()
-			stream.WriteObjectField("data")
-			stream.WriteNil()
+		if collector == nil {
+			continue
 		}
-		serializeErrors(stream, errors)
-		stream.WriteObjectEnd()
+		stream := streamPool.BorrowStream(nil)
+		writeResult(exeCtxs[i], stream, collector)
 
 		collector.release()
 
@@ -175,45 +398,133 @@ func (b *Batch) Execute(ctx context.Context, listener ExecutionListener) [][]byt
 
 // PrepareQuery parses the supplied query text, and compiles it to a PreparedQuery which can then
 // be executed many times.  If the supplied query is invalid, nil and an error describing the problem
-// are returned.
+// are returned.  The error is always a QueryErrors listing every problem found, with the
+// locations in the query text that they refer to.
 func PrepareQuery(query string, operationName string, schema *schema.Schema) (*PreparedQuery, error) {
-	ast, parseErr := parser.ParseQuery(query)
+	return PrepareQueryWithOptions(query, operationName, schema, PrepareOptions{})
+}
+
+// PrepareQueryWithOptions is like PrepareQuery, but rejects queries that exceed the
+// limits in options.
+func PrepareQueryWithOptions(query string, operationName string, schema *schema.Schema, options PrepareOptions) (*PreparedQuery, error) {
+	q, err := prepareQuery(query, operationName, schema, options)
+	if err != nil {
+		return nil, queryErrorsFrom(err)
+	}
+	return q, nil
+}
+
+func prepareQuery(query string, operationName string, schema *schema.Schema, options PrepareOptions) (*PreparedQuery, error) {
+	timings := PrepareTimings{Start: time.Now()}
+	doc, parseErr := parser.ParseQuery(query)
 	if parseErr != nil {
 		return nil, parseErr
 	}
+	timings.Parsing = time.Since(timings.Start)
 
-	opsByName := make(map[string]bool)
-	hasAnon := false
-	hasNamed := false
-	for _, op := range ast.OperationDefinitions {
-		if _, ok := opsByName[op.Name]; ok {
-			return nil, fmt.Errorf("Operation %s is defined multiple times", op.Name)
-		}
+	if err := checkDocumentLimits(doc, options); err != nil {
+		return nil, err
+	}
 
-		if op.Name == "" {
-			hasAnon = true
-		} else {
-			hasNamed = true
+	if errs := validation.Validate(schema, doc); len(errs) > 0 {
+		return nil, errs
+	}
+
+	op := doc.LookupOperation(operationName)
+	if op == nil {
+		if operationName == "" {
+			return nil, &QueryError{Message: "Must provide operation name if query contains multiple operations", Rule: RuleUnknownOperation}
 		}
-		opsByName[op.Name] = true
+		return nil, &QueryError{Message: fmt.Sprintf("Operation %s does not exist", operationName), Rule: RuleUnknownOperation}
 	}
 
-	if hasAnon && hasNamed {
-		return nil, fmt.Errorf("Cannot mix named and anonymous operations")
+	typ, err := rootType(schema, op.OperationType)
+	if err != nil {
+		return nil, err
 	}
 
-	op := ast.LookupQueryOperation(operationName)
-	if op == nil {
-		return nil, fmt.Errorf("Operation %s does not exist", operationName)
+	vars, err := buildVariableDefinitions(schema, op.VariableDefinitions)
+	if err != nil {
+		return nil, err
+	}
+
+	declaredVariables := make(map[string]bool, len(vars))
+	for _, v := range vars {
+		declaredVariables[v.Name] = true
 	}
 
-	cc := &compileContext{schema, ast, 0, 0}
-	typ := schema.QueryType
+	cc := &compileContext{schema, doc, declaredVariables, nil, nil, 0, 0, &compileLimits{options: options}}
 	sel, err := buildObjectSelector(cc, typ, op.SelectionSet)
 	if err != nil {
 		return nil, err
 	}
-	return &PreparedQuery{sel}, err
+
+	if op.OperationType == ast.OperationTypeMutation {
+		// Top level mutation fields must be executed serially, see
+		// https://facebook.github.io/graphql/June2018/#sec-Mutation
+		os := sel.(*objectSelector)
+		os.Serial = true
+		for _, d := range os.Deferred {
+			d.Sel.Serial = true
+		}
+	}
+
+	timings.Validation = time.Since(timings.Start) - timings.Parsing
+	return &PreparedQuery{
+		root:          sel,
+		operationType: op.OperationType,
+		variables:     vars,
+		timings:       timings,
+		fieldCount:    cc.limits.fields,
+		document:      doc,
+		operation:     op,
+	}, nil
+}
+
+// rootType returns the type that is the root of operations of the given type
+func rootType(s *schema.Schema, operationType ast.OperationType) (*schema.ObjectType, error) {
+	switch operationType {
+	case ast.OperationTypeQuery:
+		return s.QueryType, nil
+	case ast.OperationTypeMutation:
+		if s.MutationType == nil {
+			return nil, fmt.Errorf("Schema does not support mutations")
+		}
+		return s.MutationType, nil
+	case ast.OperationTypeSubscription:
+		if s.SubscriptionType == nil {
+			return nil, fmt.Errorf("Schema does not support subscriptions")
+		}
+		return s.SubscriptionType, nil
+	}
+	return nil, fmt.Errorf("Unsupported operation type %s", operationType)
+}
+
+// serializeRequestErrors serializes the result of a request that failed before
+// execution began.  Such a result has only errors, and no data.
+func serializeRequestErrors(ctx context.Context, listener ExecutionListener, options *executionOptions, errs []error) []byte {
+	stream := streamPool.BorrowStream(nil)
+	writeRequestErrors(ctx, stream, listener, options, errs)
+
+	buf := stream.Buffer()
+	content := make([]byte, len(buf))
+	copy(content, buf)
+	streamPool.ReturnStream(stream)
+	return content
+}
+
+// writeRequestErrors writes the result of a request that failed before execution
+// began to stream
+func writeRequestErrors(ctx context.Context, stream *jsonstream.Stream, listener ExecutionListener, options *executionOptions, errs []error) {
+	gqlErrors := make([]gqlError, len(errs))
+	for i, err := range errs {
+		listener.NotifyError(err)
+		gqlErrors[i] = gqlError{error: err}
+	}
+
+	stream.WriteObjectStart()
+	writeErrors(stream, options.presentErrors(ctx, gqlErrors))
+	stream.WriteObjectEnd()
 }
 
 func serializeErrors(stream *jsonstream.Stream, errors []gqlError) {
@@ -221,6 +532,10 @@ func serializeErrors(stream *jsonstream.Stream, errors []gqlError) {
 		return
 	}
 	stream.WriteMore()
+	writeErrors(stream, errors)
+}
+
+func writeErrors(stream *jsonstream.Stream, errors []gqlError) {
 	stream.WriteObjectField("errors")
 	stream.WriteArrayStart()
 	for i, e := range errors {
@@ -230,40 +545,53 @@ func serializeErrors(stream *jsonstream.Stream, errors []gqlError) {
 		stream.WriteObjectStart()
 		stream.WriteObjectField("message")
 		stream.WriteString(e.Error())
-		stream.WriteMore()
-		stream.WriteObjectField("path")
-		stream.WriteArrayStart()
-		for pi, pe := range e.path {
-			if pi != 0 {
-				stream.WriteMore()
-			}
-			switch pv := pe.(type) {
-			case string:
-				stream.WriteString(pv)
-			case int:
-				stream.WriteInt(pv)
-			}
+		if e.path != nil {
+			stream.WriteMore()
+			stream.WriteObjectField("path")
+			writePath(stream, e.path)
 		}
-		stream.WriteArrayEnd()
 
-		if e.row > 0 && e.col > 0 {
+		if e.field != nil && e.field.Row > 0 && e.field.Col > 0 {
 			stream.WriteMore()
 			stream.WriteObjectField("locations")
 			stream.WriteArrayStart()
 			stream.WriteObjectStart()
 			stream.WriteObjectField("line")
-			stream.WriteInt(e.row)
+			stream.WriteInt(e.field.Row)
 			stream.WriteMore()
 			stream.WriteObjectField("column")
-			stream.WriteInt(e.col)
+			stream.WriteInt(e.field.Col)
 			stream.WriteObjectEnd()
 			stream.WriteArrayEnd()
 		}
+
+		if ext := errorExtensions(e.error); len(ext) > 0 {
+			stream.WriteMore()
+			stream.WriteObjectField("extensions")
+			writeSortedVal(stream, ext)
+		}
 		stream.WriteObjectEnd()
 	}
 	stream.WriteArrayEnd()
 }
 
+// writePath writes a response path made of field names and list indices
+func writePath(stream *jsonstream.Stream, path []interface{}) {
+	stream.WriteArrayStart()
+	for i, e := range path {
+		if i != 0 {
+			stream.WriteMore()
+		}
+		switch v := e.(type) {
+		case string:
+			stream.WriteString(v)
+		case int:
+			stream.WriteInt(v)
+		}
+	}
+	stream.WriteArrayEnd()
+}
+
 // NotifyResolve implements ExecutionListener
 func (BaseExecutionListener) NotifyResolve(queryField *ast.Field, schemaField *schema.FieldDescriptor) (ResolveCompleteCallback, error) {
 	return nil, nil
@@ -15,11 +15,17 @@
 package query
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/query/validation"
 	"github.com/housecanary/gq/schema"
 	"github.com/housecanary/gq/types"
 )
@@ -71,22 +77,112 @@ func (r stringInputListCreator) Creator() schema.InputListCreator {
 	panic("Not implemented")
 }
 
-func runQuery(t *testing.T, query string, vars Variables, expectedData string, expectedIdleCount int) {
+// buildTestSchema builds the schema shared by the tests of this package
+func buildTestSchema() *schema.Schema {
 	builder := schema.NewBuilder()
 	builder.AddScalarType("String", schema.EncodeScalarMarshaler, func(ctx context.Context, in schema.LiteralValue) (interface{}, error) {
 		return types.NewString(string(in.(schema.LiteralString))), nil
 	}, stringInputListCreator{})
+	builder.AddScalarType("Int", schema.EncodeScalarMarshaler, nil, nil)
+	builder.AddScalarType("Boolean", schema.EncodeScalarMarshaler, nil, nil)
+	builder.AddEnumType("Color", nil, nil, nil).AddValue("RED")
+	lookup := builder.AddInputObjectType("Lookup", func(ctx schema.InputObjectDecodeContext) (interface{}, error) {
+		return ctx.GetFieldValue("name")
+	}, nil)
+	lookup.AddField("name", &ast.NotNilType{Of: &ast.SimpleType{Name: "String"}}, nil)
+	lookup.AddField("color", &ast.SimpleType{Name: "Color"}, ast.EnumValue{V: "RED"})
+	child := builder.AddObjectType("Child")
+	child.AddField("name", &ast.SimpleType{Name: "String"}, stringResolver("child"))
+	child.AddField("slow", &ast.SimpleType{Name: "String"}, asyncResolver(stringResolver("slow")))
+	child.AddField("required", &ast.NotNilType{Of: &ast.SimpleType{Name: "String"}}, errorResolver(fmt.Errorf("Required failed")))
+	user := builder.AddObjectType("User")
+	user.AddField("name", &ast.SimpleType{Name: "String"}, stringResolver("user"))
+	user.AddField("email", &ast.SimpleType{Name: "String"}, stringResolver("user@example.com")).
+		AddDirective("cacheControl").AddArgument("scope", ast.EnumValue{V: "PRIVATE"})
+	friends := user.AddField("friends", &ast.ListType{Of: &ast.SimpleType{Name: "User"}}, nil)
+	friends.AddArgument("first", &ast.SimpleType{Name: "Int"}, nil)
+	friends.AddDirective("cost").AddArgument("multiplier", ast.StringValue{V: "first"})
+	user.AddField("pets", &ast.NotNilType{Of: &ast.ListType{Of: &ast.SimpleType{Name: "Pet"}}}, nil)
+	dog := builder.AddObjectType("Dog")
+	dog.AddField("name", &ast.SimpleType{Name: "String"}, stringResolver("dog"))
+	dog.AddField("owner", &ast.SimpleType{Name: "User"}, nil)
+	cat := builder.AddObjectType("Cat")
+	cat.AddField("name", &ast.SimpleType{Name: "String"}, stringResolver("cat"))
+	builder.AddUnionType("Pet", []string{"Dog", "Cat"}, unwrapTestPet)
+	post := builder.AddObjectType("Post")
+	post.AddDirective("cacheControl").AddArgument("maxAge", ast.IntValue{V: 30})
+	post.AddField("title", &ast.SimpleType{Name: "String"}, stringResolver("post"))
+	post.AddField("author", &ast.SimpleType{Name: "User"}, objectResolver())
+	item := builder.AddObjectType("Item")
+	item.AddField("a", &ast.SimpleType{Name: "String"}, trackedResolver("a"))
+	item.AddField("b", &ast.SimpleType{Name: "String"}, trackedResolver("b"))
 	qt := builder.AddObjectType("Query")
 	qt.AddField("foo", &ast.SimpleType{Name: "String"}, stringResolver("bar"))
 	fooWithArg := qt.AddField("fooWithArg", &ast.SimpleType{Name: "String"}, schema.FullResolver(WithArgResolver))
 	fooWithArg.AddArgument("in", &ast.SimpleType{Name: "String"}, nil)
 	fooWithArgList := qt.AddField("fooWithArgList", &ast.ListType{Of: &ast.SimpleType{Name: "String"}}, schema.FullResolver(WithArgListResolver))
 	fooWithArgList.AddArgument("in", &ast.ListType{Of: &ast.SimpleType{Name: "String"}}, nil)
+	qt.AddField("lookup", &ast.SimpleType{Name: "String"}, schema.FullResolver(func(ctx schema.ResolverContext, v interface{}) (interface{}, error) {
+		return ctx.GetArgumentValue("in")
+	})).AddArgument("in", &ast.SimpleType{Name: "Lookup"}, nil)
 	qt.AddField("asyncFoo", &ast.SimpleType{Name: "String"}, asyncResolver(stringResolver("bar")))
 	qt.AddField("asyncFooError", &ast.SimpleType{Name: "String"}, asyncResolver(errorResolver(fmt.Errorf("Test Error"))))
 	qt.AddField("fooList", &ast.ListType{Of: &ast.SimpleType{Name: "String"}}, schema.SimpleResolver(FooListResolver))
-	s := builder.MustBuild("Query")
-	q, err := PrepareQuery(query, "", s)
+	qt.AddField("slow", &ast.SimpleType{Name: "String"}, asyncResolver(stringResolver("slow")))
+	qt.AddField("child", &ast.SimpleType{Name: "Child"}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return struct{}{}, nil
+	}))
+	qt.AddField("list", &ast.ListType{Of: &ast.SimpleType{Name: "String"}}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return schema.ListOf(types.NewString("a"), types.NewString("b"), types.NewString("c")), nil
+	}))
+	qt.AddField("children", &ast.ListType{Of: &ast.SimpleType{Name: "Child"}}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return schema.ListOf(struct{}{}, struct{}{}), nil
+	}))
+	qt.AddField("user", &ast.SimpleType{Name: "User"}, objectResolver()).
+		AddDirective("cacheControl").AddArgument("maxAge", ast.IntValue{V: 60})
+	users := qt.AddField("users", &ast.ListType{Of: &ast.SimpleType{Name: "User"}}, nil)
+	users.AddArgument("first", &ast.SimpleType{Name: "Int"}, ast.IntValue{V: 10})
+	cost := users.AddDirective("cost")
+	cost.AddArgument("weight", ast.IntValue{V: 2})
+	cost.AddArgument("multiplier", ast.StringValue{V: "first"})
+	qt.AddField("tags", &ast.ListType{Of: &ast.SimpleType{Name: "String"}}, nil)
+	qt.AddField("post", &ast.SimpleType{Name: "Post"}, objectResolver())
+	qt.AddField("version", &ast.SimpleType{Name: "String"}, stringResolver("1"))
+	qt.AddField("fail", &ast.SimpleType{Name: "String"}, errorResolver(errors.New("Failed"))).
+		AddDirective("cacheControl").AddArgument("maxAge", ast.IntValue{V: 100})
+	// wait blocks until the context is done
+	qt.AddField("wait", &ast.SimpleType{Name: "String"}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return schema.AsyncValueFunc(func(ctx context.Context) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}), nil
+	}))
+	// sleep ignores the context, and resolves after the deadline of the tests
+	qt.AddField("sleep", &ast.SimpleType{Name: "Child"}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return schema.AsyncValueFunc(func(ctx context.Context) (interface{}, error) {
+			time.Sleep(20 * time.Millisecond)
+			return struct{}{}, nil
+		}), nil
+	}))
+	qt.AddField("required", &ast.NotNilType{Of: &ast.SimpleType{Name: "String"}}, stringResolver("required"))
+	// items are awaited by the concurrencyTracker passed as the root value
+	qt.AddField("items", &ast.ListType{Of: &ast.SimpleType{Name: "Item"}}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		tracker := v.(*concurrencyTracker)
+		return schema.ListOf(trackedItem{tracker, 1}, trackedItem{tracker, 2}, trackedItem{tracker, 3}), nil
+	}))
+	qt.AddField("panic", &ast.SimpleType{Name: "String"}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return schema.AsyncValueFunc(func(ctx context.Context) (interface{}, error) {
+			panic("Await failed")
+		}), nil
+	}))
+	builder.EnableIncrementalDelivery()
+	builder.EnableCostDirective()
+	builder.EnableCacheControl()
+	return builder.MustBuild("Query")
+}
+
+func runQuery(t *testing.T, query string, vars Variables, expectedData string, expectedIdleCount int) {
+	q, err := PrepareQuery(query, "", buildTestSchema())
 	if err != nil {
 		panic(err)
 	}
@@ -123,7 +219,7 @@ func TestAsyncQuery(t *testing.T) {
 }
 
 func TestAsyncError(t *testing.T) {
-	runQuery(t, "{asyncFooError}", nil, `{"data":{"asyncFooError":null},"errors":[{"message":"Test Error","path":["asyncFooError"],"locations":[{"line":2,"column":2}]}]}`, 1)
+	runQuery(t, "{asyncFooError}", nil, `{"data":{"asyncFooError":null},"errors":[{"message":"Test Error","path":["asyncFooError"],"locations":[{"line":1,"column":2}]}]}`, 1)
 }
 
 func TestList(t *testing.T) {
@@ -131,6 +227,19 @@ func TestList(t *testing.T) {
 
 }
 
+func TestSkipInclude(t *testing.T) {
+	runQuery(t, `{foo @skip(if: true) fooWithArg(in: "a") @include(if: true)}`, nil, `{"data":{"fooWithArg":"a"}}`, 0)
+	runQuery(t, `query($s: Boolean!) {foo @skip(if: $s) fooWithArg(in: "a")}`, Variables{"s": schema.LiteralBool(true)}, `{"data":{"fooWithArg":"a"}}`, 0)
+	runQuery(t, `query($s: Boolean!) {foo @skip(if: $s) fooWithArg(in: "a")}`, Variables{"s": schema.LiteralBool(false)}, `{"data":{"foo":"bar","fooWithArg":"a"}}`, 0)
+	runQuery(t, `query($i: Boolean!) {...F @include(if: $i) fooWithArg(in: "a")} fragment F on Query {foo}`, Variables{"i": schema.LiteralBool(false)}, `{"data":{"fooWithArg":"a"}}`, 0)
+	runQuery(t, `query($i: Boolean!, $s: Boolean!) {... @include(if: $i) {foo @skip(if: $s)}}`, Variables{"i": schema.LiteralBool(true), "s": schema.LiteralBool(false)}, `{"data":{"foo":"bar"}}`, 0)
+	runQuery(t, `query($i: Boolean!, $s: Boolean!) {... @include(if: $i) {foo @skip(if: $s)}}`, Variables{"i": schema.LiteralBool(true), "s": schema.LiteralBool(true)}, `{"data":{}}`, 0)
+}
+
+func TestBuiltinDirectivesIntrospection(t *testing.T) {
+	runQuery(t, `{__schema {directives {name}}}`, nil, `{"data":{"__schema":{"directives":[{"name":"skip"},{"name":"include"},{"name":"defer"},{"name":"stream"},{"name":"cost"},{"name":"cacheControl"}]}}}`, 0)
+}
+
 func BenchmarkSimpleQuery(b *testing.B) {
 	builder := schema.NewBuilder()
 	builder.AddScalarType("String", schema.EncodeScalarMarshaler, nil, nil)
@@ -160,3 +269,350 @@ func BenchmarkAsyncQuery(b *testing.B) {
 		q.Execute(nil, &Query{}, nil, nil)
 	}
 }
+
+func TestMutationSerial(t *testing.T) {
+	var events []string
+	recordingResolver := func(name string) schema.Resolver {
+		return schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+			events = append(events, "resolve "+name)
+			return schema.AsyncValueFunc(func(ctx context.Context) (interface{}, error) {
+				events = append(events, "await "+name)
+				return types.NewString(name), nil
+			}), nil
+		})
+	}
+
+	builder := schema.NewBuilder()
+	builder.AddScalarType("String", schema.EncodeScalarMarshaler, nil, nil)
+	builder.AddObjectType("Query").AddField("foo", &ast.SimpleType{Name: "String"}, stringResolver("bar"))
+	mt := builder.AddObjectType("Mutation")
+	mt.AddField("first", &ast.SimpleType{Name: "String"}, recordingResolver("first"))
+	mt.AddField("second", &ast.SimpleType{Name: "String"}, recordingResolver("second"))
+	builder.SetMutationType("Mutation")
+	s := builder.MustBuild("Query")
+
+	q, err := PrepareQuery("mutation {first second}", "", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener := &idleCountExecutionListener{}
+	result := string(q.Execute(context.Background(), &Query{}, nil, listener))
+	if expected := `{"data":{"first":"first","second":"second"}}`; result != expected {
+		t.Errorf("Expected result %v, got %v", expected, result)
+	}
+
+	expectedEvents := []string{"resolve first", "await first", "resolve second", "await second"}
+	if fmt.Sprint(events) != fmt.Sprint(expectedEvents) {
+		t.Errorf("Expected events %v, got %v", expectedEvents, events)
+	}
+
+	if listener.idleCount != 2 {
+		t.Errorf("Expected idle count %v, got %v", 2, listener.idleCount)
+	}
+}
+
+func TestMutationNotSupported(t *testing.T) {
+	builder := schema.NewBuilder()
+	builder.AddScalarType("String", schema.EncodeScalarMarshaler, nil, nil)
+	builder.AddObjectType("Query").AddField("foo", &ast.SimpleType{Name: "String"}, stringResolver("bar"))
+	s := builder.MustBuild("Query")
+
+	if _, err := PrepareQuery("mutation {foo}", "", s); err == nil {
+		t.Errorf("Expected error preparing mutation against schema without mutation type")
+	}
+}
+
+func TestPrepareQueryErrors(t *testing.T) {
+	builder := schema.NewBuilder()
+	builder.AddScalarType("String", schema.EncodeScalarMarshaler, nil, nil)
+	qt := builder.AddObjectType("Query")
+	qt.AddField("foo", &ast.SimpleType{Name: "String"}, stringResolver("bar"))
+	s := builder.MustBuild("Query")
+
+	for _, c := range []struct {
+		query    string
+		expected QueryErrors
+	}{
+		{"{foo", QueryErrors{
+			{Locations: []ErrorLocation{{1, 5}}, Rule: RuleSyntax},
+		}},
+		{"{\n  foo\n  bar\n  baz\n}", QueryErrors{
+			{Message: `Cannot query field "bar" on type "Query"`, Locations: []ErrorLocation{{3, 3}}, Rule: "FieldsOnCorrectType"},
+			{Message: `Cannot query field "baz" on type "Query"`, Locations: []ErrorLocation{{4, 3}}, Rule: "FieldsOnCorrectType"},
+		}},
+		{"query A {foo} query B {foo}", QueryErrors{
+			{Message: "Must provide operation name if query contains multiple operations", Rule: RuleUnknownOperation},
+		}},
+	} {
+		_, err := PrepareQuery(c.query, "", s)
+		errs, ok := err.(QueryErrors)
+		if !ok {
+			t.Errorf("Expected QueryErrors preparing %s, got %v", c.query, err)
+			continue
+		}
+		if len(errs) != len(c.expected) {
+			t.Errorf("Expected %d errors preparing %s, got %v", len(c.expected), c.query, errs)
+			continue
+		}
+		for i, e := range c.expected {
+			if e.Message == "" {
+				e.Message = errs[i].Message
+			}
+			if !reflect.DeepEqual(errs[i], e) {
+				t.Errorf("Expected error %#v preparing %s, got %#v", e, c.query, errs[i])
+			}
+		}
+	}
+}
+
+func TestFieldMerging(t *testing.T) {
+	builder := schema.NewBuilder()
+	builder.AddScalarType("String", schema.EncodeScalarMarshaler, nil, nil)
+	builder.AddScalarType("Boolean", schema.EncodeScalarMarshaler, nil, nil)
+	ot := builder.AddObjectType("Obj")
+	ot.AddField("a", &ast.SimpleType{Name: "String"}, stringResolver("a"))
+	ot.AddField("b", &ast.SimpleType{Name: "String"}, stringResolver("b"))
+	resolveCount := 0
+	qt := builder.AddObjectType("Query")
+	qt.AddField("obj", &ast.SimpleType{Name: "Obj"}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		resolveCount++
+		return v, nil
+	}))
+	s := builder.MustBuild("Query")
+
+	for _, c := range []struct {
+		query    string
+		vars     Variables
+		expected string
+	}{
+		{`{obj {a} ...F obj {b a}} fragment F on Query {obj {a}}`, nil, `{"data":{"obj":{"a":"a","b":"b"}}}`},
+		{`{o: obj {a} ... on Query {o: obj {b}}}`, nil, `{"data":{"o":{"a":"a","b":"b"}}}`},
+		{`query($i: Boolean!) {obj {a} obj @include(if: $i) {b}}`, Variables{"i": schema.LiteralBool(false)}, `{"data":{"obj":{"a":"a"}}}`},
+		{`query($i: Boolean!) {obj {a} obj @include(if: $i) {b}}`, Variables{"i": schema.LiteralBool(true)}, `{"data":{"obj":{"a":"a","b":"b"}}}`},
+		{`query($i: Boolean!) {obj @skip(if: $i) {a} obj @include(if: $i) {b}}`, Variables{"i": schema.LiteralBool(true)}, `{"data":{"obj":{"b":"b"}}}`},
+	} {
+		q, err := PrepareQuery(c.query, "", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resolveCount = 0
+		result := string(q.Execute(context.Background(), &Query{}, c.vars, nil))
+		if result != c.expected {
+			t.Errorf("Expected result %v for %s, got %v", c.expected, c.query, result)
+		}
+		if resolveCount != 1 {
+			t.Errorf("Expected obj to be resolved once for %s, resolved %d times", c.query, resolveCount)
+		}
+	}
+
+	if _, err := PrepareQuery(`{obj {a} obj: obj {a: b}}`, "", s); err == nil {
+		t.Errorf("Expected conflicting fields to be rejected")
+	}
+}
+
+type testDog struct{}
+type testCat struct{}
+
+func unwrapTestPet(ctx context.Context, v interface{}) (interface{}, string) {
+	switch v.(type) {
+	case testDog:
+		return v, "Dog"
+	case testCat:
+		return v, "Cat"
+	}
+	return nil, ""
+}
+
+func TestFragmentTypeConditions(t *testing.T) {
+	builder := schema.NewBuilder()
+	builder.AddScalarType("String", schema.EncodeScalarMarshaler, nil, nil)
+	builder.AddInterfaceType("Named", unwrapTestPet).AddField("name", &ast.SimpleType{Name: "String"})
+	dog := builder.AddObjectType("Dog")
+	dog.Implements("Named")
+	dog.AddField("name", &ast.SimpleType{Name: "String"}, stringResolver("dog"))
+	dog.AddField("bark", &ast.SimpleType{Name: "String"}, stringResolver("woof"))
+	cat := builder.AddObjectType("Cat")
+	cat.AddField("name", &ast.SimpleType{Name: "String"}, stringResolver("cat"))
+	builder.AddUnionType("Pet", []string{"Dog", "Cat"}, unwrapTestPet)
+	builder.AddObjectType("Other").AddField("name", &ast.SimpleType{Name: "String"}, stringResolver("other"))
+	qt := builder.AddObjectType("Query")
+	qt.AddField("pets", &ast.ListType{Of: &ast.SimpleType{Name: "Pet"}}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return schema.ListOf(testDog{}, testCat{}), nil
+	}))
+	qt.AddField("named", &ast.ListType{Of: &ast.SimpleType{Name: "Named"}}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return schema.ListOf(testDog{}), nil
+	}))
+	s := builder.MustBuild("Query")
+
+	for _, c := range []struct {
+		query    string
+		expected string
+	}{
+		{`{pets {... on Named {name} ... on Cat {name}}}`, `{"data":{"pets":[{"name":"dog"},{"name":"cat"}]}}`},
+		{`{named {... on Pet {... on Dog {bark}}}}`, `{"data":{"named":[{"bark":"woof"}]}}`},
+		{`{named {...P}} fragment P on Pet {... on Named {name}}`, `{"data":{"named":[{"name":"dog"}]}}`},
+	} {
+		q, err := PrepareQuery(c.query, "", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := string(q.Execute(context.Background(), &Query{}, nil, nil))
+		if result != c.expected {
+			t.Errorf("Expected result %v for %s, got %v", c.expected, c.query, result)
+		}
+	}
+
+	for _, query := range []string{
+		`{pets {... on Other {name}}}`,
+		`{named {... on Cat {name}}}`,
+		`{named {...O}} fragment O on Other {name}`,
+	} {
+		if _, err := PrepareQuery(query, "", s); err == nil {
+			t.Errorf("Expected impossible spread in %s to be rejected", query)
+		}
+	}
+}
+
+func TestErrorExtensions(t *testing.T) {
+	builder := schema.NewBuilder()
+	builder.AddScalarType("String", schema.EncodeScalarMarshaler, nil, nil)
+	qt := builder.AddObjectType("Query")
+	qt.AddField("notFound", &ast.SimpleType{Name: "String"}, errorResolver(NewNotFoundError("No %s", "foo")))
+	qt.AddField("wrapped", &ast.SimpleType{Name: "String"}, asyncResolver(errorResolver(fmt.Errorf("Wrapped: %w", NewUnavailableError(2*time.Second, "Try later")))))
+	qt.AddField("plain", &ast.SimpleType{Name: "String"}, errorResolver(fmt.Errorf("Plain")))
+	s := builder.MustBuild("Query")
+
+	q, err := PrepareQuery("{notFound wrapped plain}", "", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"data":{"notFound":null,"wrapped":null,"plain":null},"errors":[` +
+		`{"message":"No foo","path":["notFound"],"locations":[{"line":1,"column":2}],"extensions":{"code":"NOT_FOUND"}},` +
+		`{"message":"Wrapped: Try later","path":["wrapped"],"locations":[{"line":1,"column":11}],"extensions":{"code":"SERVICE_UNAVAILABLE","retryAfter":2}},` +
+		`{"message":"Plain","path":["plain"],"locations":[{"line":1,"column":19}]}]}`
+	result := string(q.Execute(context.Background(), &Query{}, nil, nil))
+	if result != expected {
+		t.Errorf("Expected result %v, got %v", expected, result)
+	}
+
+	ext := queryErrorsFrom(validation.Errors{{Message: "m", Rule: "FieldsOnCorrectType"}})[0].Extensions()
+	if ext["code"] != ErrorCodeValidationFailed || ext["rule"] != "FieldsOnCorrectType" {
+		t.Errorf("Unexpected extensions of validation error: %v", ext)
+	}
+}
+
+func TestErrorPresenter(t *testing.T) {
+	builder := schema.NewBuilder()
+	builder.AddScalarType("String", schema.EncodeScalarMarshaler, nil, nil)
+	qt := builder.AddObjectType("Query")
+	qt.AddField("broken", &ast.SimpleType{Name: "String"}, panicResolver(fmt.Errorf("Secret details")))
+	qt.AddField("notFound", &ast.SimpleType{Name: "String"}, errorResolver(NewNotFoundError("No foo")))
+	s := builder.MustBuild("Query")
+
+	q, err := PrepareQuery("{ alias: broken notFound }", "", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var presented []string
+	presenter := func(ctx context.Context, err error, path []interface{}, field *ast.Field) error {
+		presented = append(presented, fmt.Sprintf("%v %v", path, field.Name))
+		var pe *PanicError
+		if errors.As(err, &pe) {
+			return NewInternalError(err)
+		}
+		return nil
+	}
+
+	expected := `{"data":{"alias":null,"notFound":null},"errors":[` +
+		`{"message":"Internal server error","path":["alias"],"locations":[{"line":1,"column":3}],"extensions":{"code":"INTERNAL_SERVER_ERROR"}},` +
+		`{"message":"No foo","path":["notFound"],"locations":[{"line":1,"column":17}],"extensions":{"code":"NOT_FOUND"}}]}`
+	result := string(q.Execute(context.Background(), &Query{}, nil, nil, WithErrorPresenter(presenter)))
+	if result != expected {
+		t.Errorf("Expected result %v, got %v", expected, result)
+	}
+	if fmt.Sprint(presented) != "[[alias] broken [notFound] notFound]" {
+		t.Errorf("Unexpected presenter calls %v", presented)
+	}
+}
+
+func TestExecuteToValue(t *testing.T) {
+	builder := schema.NewBuilder()
+	builder.AddScalarType("String", schema.EncodeScalarMarshaler, nil, nil)
+	child := builder.AddObjectType("Child")
+	child.AddField("name", &ast.SimpleType{Name: "String"}, stringResolver("child"))
+	child.AddField("required", &ast.NotNilType{Of: &ast.SimpleType{Name: "String"}}, errorResolver(fmt.Errorf("Required failed")))
+	qt := builder.AddObjectType("Query")
+	qt.AddField("foo", &ast.SimpleType{Name: "String"}, asyncResolver(stringResolver("bar")))
+	qt.AddField("list", &ast.ListType{Of: &ast.SimpleType{Name: "String"}}, schema.SimpleResolver(FooListResolver))
+	qt.AddField("child", &ast.SimpleType{Name: "Child"}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return struct{}{}, nil
+	}))
+	s := builder.MustBuild("Query")
+
+	q, err := PrepareQuery("{foo list child { name } broken: child { name required }}", "", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := q.ExecuteToValue(context.Background(), &Query{}, nil, nil)
+	expected := map[string]interface{}{
+		"foo":    "bar",
+		"list":   []interface{}{"foo", "bar", "bang", "bleet", "frob", "splat", "baz"},
+		"child":  map[string]interface{}{"name": "child"},
+		"broken": nil,
+	}
+	if !reflect.DeepEqual(result.Data.Map(), expected) {
+		t.Errorf("Expected data %v, got %v", expected, result.Data.Map())
+	}
+	if len(result.Errors) != 1 {
+		t.Fatalf("Expected 1 error, got %v", result.Errors)
+	}
+	re := result.Errors[0]
+	if re.Error() != "Required failed" || !reflect.DeepEqual(re.Path, []interface{}{"broken", "required"}) || !reflect.DeepEqual(re.Locations, []ErrorLocation{{1, 47}}) {
+		t.Errorf("Unexpected error %v at %v %v", re, re.Path, re.Locations)
+	}
+
+	data, err := json.Marshal(result.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedJSON := `{"foo":"bar","list":["foo","bar","bang","bleet","frob","splat","baz"],"child":{"name":"child"},"broken":null}`
+	if string(data) != expectedJSON {
+		t.Errorf("Expected JSON %v, got %v", expectedJSON, string(data))
+	}
+
+	vq, err := PrepareQuery("query($a: Boolean!) {foo @skip(if: $a)}", "", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result = vq.ExecuteToValue(context.Background(), &Query{}, nil, nil)
+	if result.Data != nil || len(result.Errors) != 1 || result.Errors[0].Path != nil {
+		t.Errorf("Expected only a variable error, got %v %v", result.Data, result.Errors)
+	}
+}
+
+func TestExecuteTo(t *testing.T) {
+	builder := schema.NewBuilder()
+	builder.AddScalarType("String", schema.EncodeScalarMarshaler, nil, nil)
+	qt := builder.AddObjectType("Query")
+	qt.AddField("list", &ast.ListType{Of: &ast.SimpleType{Name: "String"}}, schema.SimpleResolver(FooListResolver))
+	qt.AddField("error", &ast.SimpleType{Name: "String"}, asyncResolver(errorResolver(fmt.Errorf("Test Error"))))
+	s := builder.MustBuild("Query")
+
+	for _, text := range []string{"{list error}", "query($a: Boolean!) {list @skip(if: $a)}"} {
+		q, err := PrepareQuery(text, "", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := string(q.Execute(context.Background(), &Query{}, nil, nil))
+		var buf bytes.Buffer
+		if err := q.ExecuteTo(context.Background(), &buf, &Query{}, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != expected {
+			t.Errorf("Expected result %v, got %v", expected, buf.String())
+		}
+	}
+}
@@ -43,7 +43,7 @@ func (s scalarSelector) apply(ctx exeContext, value interface{}, collector colle
 
 	sv, err := s.Type.Encode(ctx, value)
 	if err != nil {
-		collector.Error(err, s.row, s.col)
+		collector.Error(err, s.field)
 		return nil
 	}
 	encodeScalarValue(sv, collector)
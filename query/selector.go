@@ -26,6 +26,64 @@ type exeContext struct {
 	context.Context
 	listener  ExecutionListener
 	variables Variables
+	options   *executionOptions
+
+	// incremental is set when deferred work is delivered separately, see
+	// ExecuteIncremental.
+	incremental *incrementalContext
+
+	// fieldListener is set if the listener is a FieldExecutionListener
+	fieldListener FieldExecutionListener
+
+	// path is the path of the value being selected.  It is only tracked when
+	// incremental or fieldListener is set, or cache hints are reported in the
+	// extensions of the result.
+	path *responsePath
+
+	// done is the Done channel of the context, used to stop running resolvers
+	// once the execution is cancelled or its deadline passes
+	done <-chan struct{}
+
+	// awaits is used to await async values concurrently, if enabled by
+	// WithConcurrentAwaits
+	awaits *awaitPool
+
+	// cache computes the cache policy of the result, if enabled by
+	// WithCachePolicy or WithCacheControlExtension
+	cache *cachePolicyTracker
+}
+
+func newExeContext(ctx context.Context, listener ExecutionListener, variables Variables, options *executionOptions) exeContext {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c := exeContext{Context: ctx, listener: listener, variables: variables, options: options, done: ctx.Done()}
+	c.fieldListener, _ = listener.(FieldExecutionListener)
+	if options.maxConcurrentAwaits > 0 {
+		c.awaits = newAwaitPool(options.maxConcurrentAwaits)
+	}
+	c.cache = newCachePolicyTracker(options)
+	return c
+}
+
+// contextError returns the error to report in place of values that are not
+// resolved because the context is done, or nil if execution may continue
+func (c exeContext) contextError() error {
+	select {
+	case <-c.done:
+		return newContextError(c.Err())
+	default:
+		return nil
+	}
+}
+
+// withPathKey returns a context for selecting the child of the current value with
+// the given key
+func (c exeContext) withPathKey(key interface{}) exeContext {
+	if c.incremental != nil || c.fieldListener != nil || c.cache != nil && c.cache.extension {
+		c.path = c.path.child(key)
+	}
+	return c
 }
 
 // A contFunc represents remaining work that a selector needs to perform.
@@ -66,6 +124,22 @@ func (w *worklist) Continue() contFunc {
 	return w.Continue
 }
 
+// advanceRound performs a round of the remaining work cont, once listener was
+// notified that execution is idle, and returns the work left for the next round.
+//
+// When async values are awaited concurrently by awaits, the work is advanced
+// twice: the first pass starts awaiting the values that are ready, and the second
+// selects their results, so the values are completed in the round they were
+// awaited in.
+func advanceRound(listener ExecutionListener, awaits *awaitPool, cont contFunc) contFunc {
+	listener.NotifyIdle()
+	cont = cont()
+	if cont != nil && awaits != nil {
+		cont = cont()
+	}
+	return cont
+}
+
 // A selector is the runtime peer of an element in the query tree.
 //
 // Selectors are responsible for extracting the data specified by a query
@@ -76,8 +150,9 @@ type selector interface {
 }
 
 type defaultSelector struct {
-	row int
-	col int
+	// field is the field whose value is selected, used to locate errors.  It is
+	// nil for the root selector of a query.
+	field *ast.Field
 }
 
 func (defaultSelector) prepareCollector(collector collector) {
@@ -0,0 +1,190 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+)
+
+var errSubscriptionExecute = fmt.Errorf("Subscription operations must be executed with Subscribe")
+
+// Subscribe runs a subscription query.  The single top level field of the
+// subscription is resolved against rootValue to obtain a source stream (either
+// a schema.SourceStream or a <-chan interface{}).  For each event read from
+// the source stream, the selection set of the subscription field is executed
+// against the event, and the serialized result is delivered on the returned
+// channel.
+//
+// Events are processed serially on a single goroutine, so the threading model
+// of a single execution is unchanged: the listener is never called concurrently.
+// The returned channel is closed when the source stream ends, or ctx is done.
+// The caller must read from the channel until it is closed, or cancel ctx once
+// it stops reading; otherwise the goroutine delivering events is never released.
+//
+// If the subscription field is skipped with @skip or @include, it is not resolved,
+// and the returned channel is closed without delivering any result.
+//
+// If the supplied variables are invalid, or the subscription field cannot be
+// resolved to a source stream, an error is returned.
+func (q *PreparedQuery) Subscribe(ctx context.Context, rootValue interface{}, variables Variables, listener ExecutionListener, opts ...ExecutionOption) (<-chan []byte, error) {
+	if q.operationType != ast.OperationTypeSubscription {
+		return nil, fmt.Errorf("Operation is not a subscription")
+	}
+
+	if listener == nil {
+		listener = BaseExecutionListener{}
+	}
+
+	coerced, errs := coerceVariables(ctx, q.variables, variables)
+	if errs != nil {
+		for _, err := range errs {
+			listener.NotifyError(err)
+		}
+		return nil, &multierror.Error{Errors: errs}
+	}
+
+	options := newExecutionOptions(opts)
+	exeCtx := newExeContext(ctx, listener, coerced, &options)
+	// Subscription events have no cache policy
+	exeCtx.cache = nil
+	root := q.root.(*objectSelector)
+	if len(root.Fields) == 0 || !root.Fields[0].Conditions.included(coerced) {
+		// The subscription field is skipped
+		results := make(chan []byte)
+		close(results)
+		return results, nil
+	}
+	f := root.Fields[0]
+	exeCtx = exeCtx.withPathKey(f.AstField.Alias)
+	source, err := resolveSourceStream(exeCtx, rootValue, root.Type, f)
+	if err != nil {
+		listener.NotifyError(err)
+		return nil, err
+	}
+
+	sel := subscriptionEventSelector{f}
+	results := make(chan []byte)
+	go func() {
+		defer close(results)
+		for {
+			event, ok, err := source.Next(exeCtx)
+			if err != nil {
+				if exeCtx.Err() != nil {
+					// The subscription was cancelled, the source stream did
+					// not fail
+					return
+				}
+				event = sourceStreamError{err}
+			} else if !ok {
+				return
+			}
+
+			select {
+			case results <- executeSelector(exeCtx, sel, event):
+			case <-exeCtx.done:
+				return
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return results, nil
+}
+
+// resolveSourceStream resolves the subscription field f, awaiting any
+// asynchronous values, and converts the result to a source stream
+func resolveSourceStream(ctx exeContext, rootValue interface{}, typ *schema.ObjectType, f *objectSelectorField) (schema.SourceStream, error) {
+	cb, err := notifyResolve(ctx, typ, f)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := safeResolve(ctx, rootValue, f, cb)
+	for err == nil {
+		async, ok := value.(schema.AsyncValue)
+		if !ok {
+			break
+		}
+		ctx.listener.NotifyIdle()
+		value, err = async.Await(ctx)
+		value, err = maybeNotifyCb(value, err, cb)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case schema.SourceStream:
+		return v, nil
+	case <-chan interface{}:
+		return schema.ChanSourceStream(v), nil
+	case chan interface{}:
+		return schema.ChanSourceStream(v), nil
+	}
+	return nil, fmt.Errorf("Subscription field %s did not resolve to a source stream", f.AstField.Name)
+}
+
+// sourceStreamError wraps an error read from a source stream so that it can
+// be reported at the location of the subscription field
+type sourceStreamError struct {
+	err error
+}
+
+// A subscriptionEventSelector executes the selection set of a subscription
+// field against a single event from its source stream.
+type subscriptionEventSelector struct {
+	Field *objectSelectorField
+}
+
+func (s subscriptionEventSelector) prepareCollector(collector collector) {
+}
+
+func (s subscriptionEventSelector) apply(ctx exeContext, value interface{}, collector collector) contFunc {
+	f := s.Field
+	fieldCollector := collector.Object(1).Field(f.AstField.Alias)
+	f.Sel.prepareCollector(fieldCollector)
+
+	switch v := value.(type) {
+	case sourceStreamError:
+		ctx.listener.NotifyError(v.err)
+		fieldCollector.Error(v.err, f.AstField)
+		return nil
+	case schema.AsyncValue:
+		return safeAsync(ctx, v, f, fieldCollector, nil)
+	}
+	return f.Sel.apply(ctx, value, fieldCollector)
+}
+
+// An errorSelector reports an error in place of any value
+type errorSelector struct {
+	err error
+}
+
+func (s errorSelector) prepareCollector(collector collector) {
+}
+
+func (s errorSelector) apply(ctx exeContext, value interface{}, collector collector) contFunc {
+	ctx.listener.NotifyError(s.err)
+	collector.Error(s.err, nil)
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+	"github.com/housecanary/gq/types"
+)
+
+type testPriceChange struct {
+	symbol string
+	price  float64
+}
+
+func buildSubscriptionSchema(events <-chan interface{}) *schema.Schema {
+	builder := schema.NewBuilder()
+	builder.AddScalarType("String", schema.EncodeScalarMarshaler, nil, nil)
+	builder.AddScalarType("Float", schema.EncodeScalarMarshaler, nil, nil)
+	builder.AddObjectType("Query").AddField("foo", &ast.SimpleType{Name: "String"}, stringResolver("bar"))
+	pc := builder.AddObjectType("PriceChange")
+	pc.AddField("symbol", &ast.SimpleType{Name: "String"}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return types.NewString(v.(*testPriceChange).symbol), nil
+	}))
+	pc.AddField("price", &ast.SimpleType{Name: "Float"}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return types.NewFloat(v.(*testPriceChange).price), nil
+	}))
+	st := builder.AddObjectType("Subscription")
+	st.AddField("priceChanged", &ast.SimpleType{Name: "PriceChange"}, schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return events, nil
+	}))
+	st.AddField("failing", &ast.SimpleType{Name: "PriceChange"}, errorResolver(fmt.Errorf("Test Error")))
+	builder.SetSubscriptionType("Subscription")
+	return builder.MustBuild("Query")
+}
+
+func TestSubscription(t *testing.T) {
+	events := make(chan interface{}, 2)
+	events <- &testPriceChange{"HC", 1.5}
+	events <- &testPriceChange{"GQ", 2.5}
+	close(events)
+
+	s := buildSubscriptionSchema(events)
+	q, err := PrepareQuery("subscription {change: priceChanged {symbol price}}", "", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := q.Subscribe(context.Background(), &Query{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for r := range results {
+		actual = append(actual, string(r))
+	}
+
+	expected := []string{
+		`{"data":{"change":{"symbol":"HC","price":1.5}}}`,
+		`{"data":{"change":{"symbol":"GQ","price":2.5}}}`,
+	}
+	if fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Errorf("Expected results %v, got %v", expected, actual)
+	}
+}
+
+func TestSubscriptionNilContext(t *testing.T) {
+	events := make(chan interface{}, 1)
+	events <- &testPriceChange{"HC", 1.5}
+	close(events)
+
+	q, err := PrepareQuery("subscription {priceChanged {symbol}}", "", buildSubscriptionSchema(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := q.Subscribe(nil, &Query{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for r := range results {
+		actual = append(actual, string(r))
+	}
+	if expected := []string{`{"data":{"priceChanged":{"symbol":"HC"}}}`}; fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Errorf("Expected results %v, got %v", expected, actual)
+	}
+}
+
+func TestSubscriptionCancel(t *testing.T) {
+	events := make(chan interface{})
+	q, err := PrepareQuery("subscription {priceChanged {symbol}}", "", buildSubscriptionSchema(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err := q.Subscribe(ctx, &Query{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	for r := range results {
+		t.Errorf("Expected no results after cancelling, got %s", r)
+	}
+}
+
+func TestSubscriptionResolveError(t *testing.T) {
+	s := buildSubscriptionSchema(nil)
+	q, err := PrepareQuery("subscription {failing {symbol}}", "", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := q.Subscribe(context.Background(), &Query{}, nil, nil); err == nil {
+		t.Errorf("Expected error subscribing to a failing field")
+	}
+}
+
+func TestSubscriptionValidation(t *testing.T) {
+	s := buildSubscriptionSchema(nil)
+	if _, err := PrepareQuery("subscription {priceChanged {symbol} failing {symbol}}", "", s); err == nil {
+		t.Errorf("Expected error preparing subscription with multiple top level fields")
+	}
+
+	q, err := PrepareQuery("subscription {priceChanged {symbol}}", "", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := string(q.Execute(context.Background(), &Query{}, nil, nil))
+	expected := `{"data":null,"errors":[{"message":"Subscription operations must be executed with Subscribe","path":[]}]}`
+	if result != expected {
+		t.Errorf("Expected result %v, got %v", expected, result)
+	}
+}
+
+func TestSubscriptionSkipped(t *testing.T) {
+	for _, c := range []struct {
+		query     string
+		variables Variables
+		expected  []string
+	}{
+		{"subscription {priceChanged @skip(if: true) {symbol}}", nil, nil},
+		{"subscription {priceChanged @include(if: false) {symbol}}", nil, nil},
+		{"subscription ($s: Boolean!) {priceChanged @skip(if: $s) {symbol}}", Variables{"s": schema.LiteralBool(true)}, nil},
+		{"subscription ($i: Boolean!) {priceChanged @include(if: $i) {symbol}}", Variables{"i": schema.LiteralBool(false)}, nil},
+		{"subscription ($s: Boolean!) {priceChanged @skip(if: $s) {symbol}}", Variables{"s": schema.LiteralBool(false)}, []string{`{"data":{"priceChanged":{"symbol":"HC"}}}`}},
+	} {
+		events := make(chan interface{}, 1)
+		events <- &testPriceChange{"HC", 1.5}
+		close(events)
+
+		q, err := PrepareQuery(c.query, "", buildSubscriptionSchema(events))
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := q.Subscribe(context.Background(), &Query{}, c.variables, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actual []string
+		for r := range results {
+			actual = append(actual, string(r))
+		}
+		if fmt.Sprint(actual) != fmt.Sprint(c.expected) {
+			t.Errorf("Expected results %v for %s, got %v", c.expected, c.query, actual)
+		}
+	}
+}
@@ -14,6 +14,8 @@
 
 package query
 
+import "github.com/housecanary/gq/ast"
+
 type testCollector struct {
 	v interface{}
 }
@@ -34,11 +36,11 @@ func (c *testCollector) String(v string) {
 	c.v = v
 }
 
-func (c *testCollector) Error(err error, row, col int) {
-	c.v = edat{err, row, col}
+func (c *testCollector) Error(err error, field *ast.Field) {
+	c.v = edat{err, field}
 }
 
-func (c *testCollector) Required(row, col int) {
+func (c *testCollector) Required(field *ast.Field) {
 }
 
 func (c *testCollector) Object(sizeHint int) objectCollector {
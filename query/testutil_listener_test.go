@@ -110,6 +110,17 @@ func (a errorAssertion) NotifyError(l *assertExecutionListener, err error) {
 	}
 }
 
+type panicAssertion struct {
+	baseExecutionListenerAssertion
+	value interface{}
+}
+
+func (a panicAssertion) NotifyError(l *assertExecutionListener, err error) {
+	if pe, ok := err.(*PanicError); !ok || pe.Value != a.value {
+		panic(fmt.Errorf("Invalid call to NotifyError: panic %v != %v", a.value, err))
+	}
+}
+
 type assertExecutionListener struct {
 	assertions       []executionListenerAssertion
 	pendingCallbacks map[*resolveAssertion]bool
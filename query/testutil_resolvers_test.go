@@ -43,6 +43,12 @@ func stringResolver(value string) schema.Resolver {
 	})
 }
 
+func objectResolver() schema.Resolver {
+	return schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return struct{}{}, nil
+	})
+}
+
 func errorResolver(value error) schema.Resolver {
 	return schema.SimpleResolver(func(v interface{}) (interface{}, error) {
 		return nil, value
@@ -36,7 +36,7 @@ func buildUnionSelector(cc *compileContext, typ *schema.UnionType, selections as
 		switch v := sel.(type) {
 		case *ast.FieldSelection:
 			if v.Field.Name != "__typename" {
-				return nil, fmt.Errorf("Cannot select field %s on union", v.Field.Name)
+				return nil, cc.withField(v.Field).errorf("FieldsOnCorrectType", "Cannot select field %s on union", v.Field.Name)
 			}
 		}
 	}
@@ -67,7 +67,7 @@ func (s unionSelector) apply(ctx exeContext, value interface{}, collector collec
 	if !ok {
 		err := fmt.Errorf("Value %v does not conform to any member of union %s", value, s.Type.Name())
 		ctx.listener.NotifyError(err)
-		collector.Error(err, s.row, s.col)
+		collector.Error(err, s.field)
 		return nil
 	}
 
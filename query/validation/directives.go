@@ -0,0 +1,77 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+)
+
+// validateDirectives checks the directives applied at a location in the document.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-Validation.Directives
+func (v *validator) validateDirectives(directives ast.Directives, location schema.DirectiveLocation) {
+	seen := make(map[string]*ast.Directive)
+	for _, d := range directives {
+		dirLocation := Location{d.Row, d.Col}
+		if prev, ok := seen[d.Name]; ok {
+			v.report("UniqueDirectivesPerLocation", []Location{{prev.Row, prev.Col}, dirLocation},
+				`The directive "@%s" can only be used once at this location`, d.Name)
+		} else {
+			seen[d.Name] = d
+		}
+
+		def := v.schema.Directive(d.Name)
+		if def == nil {
+			v.report("KnownDirectives", []Location{dirLocation},
+				`Unknown directive "@%s"`, d.Name)
+			v.validateArguments(d.Arguments, nil, "", dirLocation)
+			continue
+		}
+
+		allowed := false
+		for _, l := range def.Locations() {
+			if l == location {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			v.report("KnownDirectives", []Location{dirLocation},
+				`Directive "@%s" may not be used on %s`, d.Name, location)
+		}
+
+		v.validateArguments(d.Arguments, def.Arguments(), `directive "@`+d.Name+`"`, dirLocation)
+	}
+}
+
+// validateStream checks that a @stream directive is only applied to a list field.
+//
+// See https://github.com/graphql/graphql-spec/blob/main/rfcs/DeferStream.md
+func (v *validator) validateStream(f *ast.Field, def *schema.FieldDescriptor) {
+	d, found := f.Directives.ByName(schema.StreamDirective.Name())
+	if !found || v.schema.Directive(d.Name) == nil {
+		return
+	}
+
+	typ := def.Type()
+	if nn, ok := typ.(*schema.NotNilType); ok {
+		typ = nn.Unwrap()
+	}
+	if _, ok := typ.(*schema.ListType); !ok {
+		v.report("StreamDirectiveOnListField", []Location{{d.Row, d.Col}},
+			`Directive "@stream" cannot be used on non-list field "%s"`, f.Name)
+	}
+}
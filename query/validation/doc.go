@@ -0,0 +1,25 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package validation checks that a GraphQL query document is valid against a schema
+// before it is executed.
+//
+// Validate implements the validation rules described in
+// https://facebook.github.io/graphql/June2018/#sec-Validation.  All problems found in
+// a document are reported together, each with the locations in the query text it
+// refers to and the name of the rule that was violated.
+//
+// The parser discards duplicate fields of input object literals, so the
+// "Input Object Field Uniqueness" rule is not checked.
+package validation
@@ -0,0 +1,134 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"fmt"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+)
+
+// validateSelectionSet checks a selection set applied to a value of the parent type.
+// If the parent type is not known (because of an earlier error), checks that need it
+// are skipped.
+func (v *validator) validateSelectionSet(parent schema.Type, selections ast.SelectionSet) {
+	v.validateFieldsCanMerge(parent, selections)
+	for _, sel := range selections {
+		switch s := sel.(type) {
+		case *ast.FieldSelection:
+			v.validateField(parent, &s.Field)
+		case *ast.FragmentSpreadSelection:
+			v.validateFragmentSpread(parent, s)
+		case *ast.InlineFragmentSelection:
+			v.validateInlineFragment(parent, s)
+		}
+	}
+}
+
+// validateField checks a field selection.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-Field-Selections-on-Objects-Interfaces-and-Unions-Types
+// and https://facebook.github.io/graphql/June2018/#sec-Leaf-Field-Selections
+func (v *validator) validateField(parent schema.Type, f *ast.Field) {
+	location := Location{f.Row, f.Col}
+	v.validateDirectives(f.Directives, schema.DirectiveLocationField)
+
+	if parent == nil {
+		v.validateArguments(f.Arguments, nil, "", location)
+		v.validateSelectionSet(nil, f.SelectionSet)
+		return
+	}
+
+	def := v.fieldDefinition(parent, f.Name)
+	if def == nil {
+		v.report("FieldsOnCorrectType", []Location{location},
+			`Cannot query field "%s" on type "%s"`, f.Name, schema.Signature(parent))
+		v.validateArguments(f.Arguments, nil, "", location)
+		v.validateSelectionSet(nil, f.SelectionSet)
+		return
+	}
+
+	v.validateArguments(f.Arguments, def.Arguments(), fmt.Sprintf(`field "%s.%s"`, schema.Signature(parent), f.Name), location)
+	v.validateStream(f, def)
+
+	typ := namedType(def.Type())
+	switch {
+	case isLeafType(typ):
+		if len(f.SelectionSet) > 0 {
+			v.report("ScalarLeafs", []Location{location},
+				`Field "%s" must not have a selection since type "%s" has no subfields`, f.Name, schema.Signature(def.Type()))
+		}
+		v.validateSelectionSet(nil, f.SelectionSet)
+	case isCompositeType(typ):
+		if len(f.SelectionSet) == 0 {
+			v.report("ScalarLeafs", []Location{location},
+				`Field "%s" of type "%s" must have a selection of subfields`, f.Name, schema.Signature(def.Type()))
+		}
+		v.validateSelectionSet(typ, f.SelectionSet)
+	}
+}
+
+// validateArguments checks the arguments supplied to a field or directive against the
+// arguments it accepts.  owner describes the field or directive in messages, if it is
+// empty the field or directive is not known, and only variable usages are recorded.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-Validation.Arguments
+func (v *validator) validateArguments(args ast.Arguments, defs []*schema.ArgumentDescriptor, owner string, location Location) {
+	seen := make(map[string]*ast.Argument)
+	for _, arg := range args {
+		argLocation := Location{arg.Row, arg.Col}
+		if prev, ok := seen[arg.Name]; ok {
+			v.report("UniqueArgumentNames", []Location{{prev.Row, prev.Col}, argLocation},
+				`There can be only one argument named "%s"`, arg.Name)
+		} else {
+			seen[arg.Name] = arg
+		}
+
+		if owner == "" {
+			v.validateValue(arg.Value, nil, false, argLocation)
+			continue
+		}
+
+		def := findArgument(defs, arg.Name)
+		if def == nil {
+			v.report("KnownArgumentNames", []Location{argLocation},
+				`Unknown argument "%s" on %s`, arg.Name, owner)
+			v.validateValue(arg.Value, nil, false, argLocation)
+			continue
+		}
+
+		v.validateValue(arg.Value, def.Type(), def.HasDefaultValue(), argLocation)
+	}
+
+	for _, def := range defs {
+		if _, ok := def.Type().(*schema.NotNilType); !ok || def.HasDefaultValue() {
+			continue
+		}
+		if _, ok := seen[def.Name()]; !ok {
+			v.report("ProvidedRequiredArguments", []Location{location},
+				`Argument "%s" of required type "%s" was not provided to %s`, def.Name(), schema.Signature(def.Type()), owner)
+		}
+	}
+}
+
+func findArgument(defs []*schema.ArgumentDescriptor, name string) *schema.ArgumentDescriptor {
+	for _, def := range defs {
+		if def.Name() == name {
+			return def
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+)
+
+// validateFragmentDefinitions checks the names and type conditions of the fragments
+// defined by the document.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-Fragment-Name-Uniqueness,
+// https://facebook.github.io/graphql/June2018/#sec-Fragment-Spread-Type-Existence
+// and https://facebook.github.io/graphql/June2018/#sec-Fragments-On-Composite-Types
+func (v *validator) validateFragmentDefinitions() {
+	for _, frag := range v.doc.FragmentDefinitions {
+		if prev, ok := v.fragments[frag.Name]; ok {
+			v.report("UniqueFragmentNames", []Location{{prev.Row, prev.Col}, {frag.Row, frag.Col}},
+				`There can be only one fragment named "%s"`, frag.Name)
+		} else {
+			v.fragments[frag.Name] = frag
+		}
+
+		t := v.schema.Type(frag.OnType)
+		if t == nil {
+			v.report("KnownTypeNames", []Location{{frag.Row, frag.Col}},
+				`Unknown type "%s"`, frag.OnType)
+		} else if !isCompositeType(t) {
+			v.report("FragmentsOnCompositeTypes", []Location{{frag.Row, frag.Col}},
+				`Fragment "%s" cannot condition on non composite type "%s"`, frag.Name, frag.OnType)
+		}
+	}
+}
+
+// validateFragmentSpread checks a named fragment spread within a selection set of
+// the parent type.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-Fragment-spread-target-defined
+// and https://facebook.github.io/graphql/June2018/#sec-Fragment-spread-is-possible
+func (v *validator) validateFragmentSpread(parent schema.Type, spread *ast.FragmentSpreadSelection) {
+	location := Location{spread.Row, spread.Col}
+	v.validateDirectives(spread.Directives, schema.DirectiveLocationFragmentSpread)
+	v.scope.spreads = append(v.scope.spreads, fragmentSpread{spread.FragmentName, location})
+
+	frag, ok := v.fragments[spread.FragmentName]
+	if !ok {
+		v.report("KnownFragmentNames", []Location{location},
+			`Unknown fragment "%s"`, spread.FragmentName)
+		return
+	}
+
+	fragType := v.fragmentType(frag)
+	if parent != nil && fragType != nil && !typesOverlap(parent, fragType) {
+		v.report("PossibleFragmentSpreads", []Location{location},
+			`Fragment "%s" cannot be spread here as objects of type "%s" can never be of type "%s"`,
+			spread.FragmentName, schema.Signature(parent), schema.Signature(fragType))
+	}
+}
+
+// validateInlineFragment checks an inline fragment within a selection set of the
+// parent type
+func (v *validator) validateInlineFragment(parent schema.Type, frag *ast.InlineFragmentSelection) {
+	location := Location{frag.Row, frag.Col}
+	v.validateDirectives(frag.Directives, schema.DirectiveLocationInlineFragment)
+
+	fragType := parent
+	if frag.OnType != "" {
+		fragType = v.schema.Type(frag.OnType)
+		if fragType == nil {
+			v.report("KnownTypeNames", []Location{location},
+				`Unknown type "%s"`, frag.OnType)
+		} else if !isCompositeType(fragType) {
+			v.report("FragmentsOnCompositeTypes", []Location{location},
+				`Fragment cannot condition on non composite type "%s"`, frag.OnType)
+			fragType = nil
+		} else if parent != nil && !typesOverlap(parent, fragType) {
+			v.report("PossibleFragmentSpreads", []Location{location},
+				`Fragment cannot be spread here as objects of type "%s" can never be of type "%s"`,
+				schema.Signature(parent), schema.Signature(fragType))
+		}
+	}
+
+	v.validateSelectionSet(fragType, frag.SelectionSet)
+}
+
+// typesOverlap returns true if there is an object type that is a possible type of both a and b
+func typesOverlap(a, b schema.Type) bool {
+	for _, at := range possibleTypes(a) {
+		for _, bt := range possibleTypes(b) {
+			if at == bt {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateFragmentUsage checks that every fragment definition is spread by some
+// operation.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-Fragments-Must-Be-Used
+func (v *validator) validateFragmentUsage() {
+	used := make(map[string]bool)
+	for _, op := range v.doc.OperationDefinitions {
+		v.markFragmentsUsed(v.opScopes[op], used)
+	}
+
+	for _, frag := range v.doc.FragmentDefinitions {
+		if !used[frag.Name] {
+			v.report("NoUnusedFragments", []Location{{frag.Row, frag.Col}},
+				`Fragment "%s" is never used`, frag.Name)
+		}
+	}
+}
+
+func (v *validator) markFragmentsUsed(s *scope, used map[string]bool) {
+	for _, spread := range s.spreads {
+		if used[spread.name] {
+			continue
+		}
+		used[spread.name] = true
+		if frag, ok := v.fragments[spread.name]; ok {
+			v.markFragmentsUsed(v.fragScopes[frag], used)
+		}
+	}
+}
+
+// detectFragmentCycles checks that no fragment spreads itself, directly or
+// through other fragments.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-Fragment-spreads-must-not-form-cycles
+func (v *validator) detectFragmentCycles() {
+	d := &cycleDetector{
+		v:         v,
+		visited:   make(map[string]bool),
+		pathIndex: make(map[string]int),
+	}
+	for _, frag := range v.doc.FragmentDefinitions {
+		d.detect(frag)
+	}
+}
+
+type cycleDetector struct {
+	v         *validator
+	visited   map[string]bool
+	path      []fragmentSpread
+	pathIndex map[string]int
+}
+
+func (d *cycleDetector) detect(frag *ast.FragmentDefinition) {
+	if d.visited[frag.Name] {
+		return
+	}
+	d.visited[frag.Name] = true
+
+	spreads := d.v.fragScopes[frag].spreads
+	if len(spreads) == 0 {
+		return
+	}
+
+	d.pathIndex[frag.Name] = len(d.path)
+	for _, spread := range spreads {
+		d.path = append(d.path, spread)
+		if cycleIndex, ok := d.pathIndex[spread.name]; ok {
+			cycle := d.path[cycleIndex:]
+			locations := make([]Location, len(cycle))
+			via := make([]string, 0, len(cycle)-1)
+			for i, e := range cycle {
+				locations[i] = e.location
+				if i < len(cycle)-1 {
+					via = append(via, fmt.Sprintf(`"%s"`, e.name))
+				}
+			}
+			if len(via) > 0 {
+				d.v.report("NoFragmentCycles", locations,
+					`Cannot spread fragment "%s" within itself via %s`, spread.name, strings.Join(via, ", "))
+			} else {
+				d.v.report("NoFragmentCycles", locations,
+					`Cannot spread fragment "%s" within itself`, spread.name)
+			}
+		} else if next, ok := d.v.fragments[spread.name]; ok {
+			d.detect(next)
+		}
+		d.path = d.path[:len(d.path)-1]
+	}
+	delete(d.pathIndex, frag.Name)
+}
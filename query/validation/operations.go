@@ -0,0 +1,263 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+)
+
+// variableDefinitionLocation is where directives on variable definitions are used.
+// No directive of the schema may be used there.
+const variableDefinitionLocation schema.DirectiveLocation = "VARIABLE_DEFINITION"
+
+// validateOperations checks the rules that apply to the set of operations in the
+// document.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-Operation-Name-Uniqueness
+// and https://facebook.github.io/graphql/June2018/#sec-Lone-Anonymous-Operation
+func (v *validator) validateOperations() {
+	byName := make(map[string]*ast.OperationDefinition)
+	for _, op := range v.doc.OperationDefinitions {
+		if op.Name == "" {
+			if len(v.doc.OperationDefinitions) > 1 {
+				v.report("LoneAnonymousOperation", []Location{{op.Row, op.Col}},
+					"This anonymous operation must be the only defined operation")
+			}
+			continue
+		}
+
+		if prev, ok := byName[op.Name]; ok {
+			v.report("UniqueOperationNames", []Location{{prev.Row, prev.Col}, {op.Row, op.Col}},
+				`There can be only one operation named "%s"`, op.Name)
+			continue
+		}
+		byName[op.Name] = op
+	}
+}
+
+// rootType returns the type that is the root of an operation, or nil if the schema
+// does not support the operation type
+func (v *validator) rootType(op *ast.OperationDefinition) *schema.ObjectType {
+	switch op.OperationType {
+	case ast.OperationTypeMutation:
+		return v.schema.MutationType
+	case ast.OperationTypeSubscription:
+		return v.schema.SubscriptionType
+	}
+	return v.schema.QueryType
+}
+
+func operationDirectiveLocation(op *ast.OperationDefinition) schema.DirectiveLocation {
+	switch op.OperationType {
+	case ast.OperationTypeMutation:
+		return schema.DirectiveLocationMutation
+	case ast.OperationTypeSubscription:
+		return schema.DirectiveLocationSubscription
+	}
+	return schema.DirectiveLocationQuery
+}
+
+// validateOperation checks a single operation definition
+func (v *validator) validateOperation(op *ast.OperationDefinition) {
+	v.validateDirectives(op.Directives, operationDirectiveLocation(op))
+	v.validateVariableDefinitions(op.VariableDefinitions)
+
+	root := v.rootType(op)
+	if root == nil {
+		v.report("KnownOperationTypes", []Location{{op.Row, op.Col}},
+			"Schema does not support %ss", op.OperationType)
+		// Still walk the selections so that the fragments and variables
+		// they use are accounted for.
+		v.validateSelectionSet(nil, op.SelectionSet)
+		return
+	}
+
+	if op.OperationType == ast.OperationTypeSubscription {
+		// See https://facebook.github.io/graphql/June2018/#sec-Single-root-field
+		if _, keys := v.collectFields(root, op.SelectionSet); len(keys) != 1 {
+			if op.Name == "" {
+				v.report("SingleFieldSubscriptions", []Location{{op.Row, op.Col}},
+					"Anonymous subscription must select only one top level field")
+			} else {
+				v.report("SingleFieldSubscriptions", []Location{{op.Row, op.Col}},
+					`Subscription "%s" must select only one top level field`, op.Name)
+			}
+		}
+	}
+
+	v.validateSelectionSet(root, op.SelectionSet)
+}
+
+// validateVariableDefinitions checks the variables declared by an operation.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-Variable-Uniqueness
+// and https://facebook.github.io/graphql/June2018/#sec-Variables-Are-Input-Types
+func (v *validator) validateVariableDefinitions(defs ast.VariableDefinitions) {
+	seen := make(map[string]*ast.VariableDefinition)
+	for _, def := range defs {
+		if prev, ok := seen[def.VariableName]; ok {
+			v.report("UniqueVariableNames", []Location{{prev.Row, prev.Col}, {def.Row, def.Col}},
+				`There can be only one variable named "$%s"`, def.VariableName)
+		} else {
+			seen[def.VariableName] = def
+		}
+
+		v.validateDirectives(def.Directives, variableDefinitionLocation)
+
+		typ := v.schema.ResolveType(def.Type)
+		if typ == nil {
+			v.report("KnownTypeNames", []Location{{def.Row, def.Col}},
+				`Unknown type "%s"`, astTypeName(def.Type))
+			continue
+		}
+
+		if !isInputType(typ) {
+			v.report("VariablesAreInputTypes", []Location{{def.Row, def.Col}},
+				`Variable "$%s" cannot be non-input type "%s"`, def.VariableName, def.Type.Signature())
+			continue
+		}
+
+		if def.DefaultValue != nil {
+			v.validateValue(def.DefaultValue, typ, false, Location{def.Row, def.Col})
+		}
+	}
+}
+
+// validateVariableUsages checks that the variables used by an operation, including
+// those used by the fragments it spreads, are defined by the operation and
+// are used in positions that accept them, and that every defined variable is used.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-All-Variable-Uses-Defined,
+// https://facebook.github.io/graphql/June2018/#sec-All-Variables-Used and
+// https://facebook.github.io/graphql/June2018/#sec-All-Variable-Usages-are-Allowed
+func (v *validator) validateVariableUsages(op *ast.OperationDefinition) {
+	defs := make(map[string]*ast.VariableDefinition)
+	for _, def := range op.VariableDefinitions {
+		if _, ok := defs[def.VariableName]; !ok {
+			defs[def.VariableName] = def
+		}
+	}
+
+	used := make(map[string]bool)
+	for _, usage := range v.recursiveVariableUsages(v.opScopes[op], make(map[string]bool), nil) {
+		used[usage.name] = true
+		def, ok := defs[usage.name]
+		if !ok {
+			if op.Name == "" {
+				v.report("NoUndefinedVariables", []Location{usage.location, {op.Row, op.Col}},
+					`Variable "$%s" is not defined`, usage.name)
+			} else {
+				v.report("NoUndefinedVariables", []Location{usage.location, {op.Row, op.Col}},
+					`Variable "$%s" is not defined by operation "%s"`, usage.name, op.Name)
+			}
+			continue
+		}
+
+		if usage.typ == nil {
+			continue
+		}
+
+		varType := v.schema.ResolveType(def.Type)
+		if varType == nil || !isInputType(varType) {
+			continue
+		}
+
+		_, nilDefault := def.DefaultValue.(ast.NilValue)
+		varHasDefault := def.DefaultValue != nil && !nilDefault
+		if !isVariableUsageAllowed(varType, varHasDefault, usage.typ, usage.hasDefault) {
+			v.report("VariablesInAllowedPosition", []Location{{def.Row, def.Col}, usage.location},
+				`Variable "$%s" of type "%s" used in position expecting type "%s"`,
+				usage.name, schema.Signature(varType), schema.Signature(usage.typ))
+		}
+	}
+
+	for _, def := range op.VariableDefinitions {
+		if used[def.VariableName] {
+			continue
+		}
+		if op.Name == "" {
+			v.report("NoUnusedVariables", []Location{{def.Row, def.Col}},
+				`Variable "$%s" is never used`, def.VariableName)
+		} else {
+			v.report("NoUnusedVariables", []Location{{def.Row, def.Col}},
+				`Variable "$%s" is never used in operation "%s"`, def.VariableName, op.Name)
+		}
+	}
+}
+
+// recursiveVariableUsages collects the variable usages of a scope and all
+// fragments spread within it
+func (v *validator) recursiveVariableUsages(s *scope, visited map[string]bool, usages []variableUsage) []variableUsage {
+	usages = append(usages, s.variables...)
+	for _, spread := range s.spreads {
+		if visited[spread.name] {
+			continue
+		}
+		visited[spread.name] = true
+		if frag, ok := v.fragments[spread.name]; ok {
+			usages = v.recursiveVariableUsages(v.fragScopes[frag], visited, usages)
+		}
+	}
+	return usages
+}
+
+// isVariableUsageAllowed checks if a variable of type varType may be used in a
+// position expecting locationType.
+//
+// See https://facebook.github.io/graphql/June2018/#IsVariableUsageAllowed()
+func isVariableUsageAllowed(varType schema.Type, varHasDefault bool, locationType schema.Type, locationHasDefault bool) bool {
+	if nn, ok := locationType.(*schema.NotNilType); ok {
+		if _, ok := varType.(*schema.NotNilType); !ok {
+			if !varHasDefault && !locationHasDefault {
+				return false
+			}
+			return areTypesCompatible(varType, nn.Unwrap())
+		}
+	}
+	return areTypesCompatible(varType, locationType)
+}
+
+// areTypesCompatible checks if a value of varType may be supplied where a value of
+// locationType is expected.
+//
+// See https://facebook.github.io/graphql/June2018/#AreTypesCompatible()
+func areTypesCompatible(varType schema.Type, locationType schema.Type) bool {
+	if lnn, ok := locationType.(*schema.NotNilType); ok {
+		vnn, ok := varType.(*schema.NotNilType)
+		if !ok {
+			return false
+		}
+		return areTypesCompatible(vnn.Unwrap(), lnn.Unwrap())
+	}
+
+	if vnn, ok := varType.(*schema.NotNilType); ok {
+		return areTypesCompatible(vnn.Unwrap(), locationType)
+	}
+
+	if ll, ok := locationType.(*schema.ListType); ok {
+		vl, ok := varType.(*schema.ListType)
+		if !ok {
+			return false
+		}
+		return areTypesCompatible(vl.Unwrap(), ll.Unwrap())
+	}
+
+	if _, ok := varType.(*schema.ListType); ok {
+		return false
+	}
+
+	return schema.Signature(varType) == schema.Signature(locationType)
+}
@@ -0,0 +1,322 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+)
+
+// A fieldPair identifies two fields that have been checked for conflicts, by
+// their ids in validator.fieldIDs.  The smaller id is first, so that a pair has
+// a single key whatever order its fields are compared in.
+type fieldPair struct {
+	a, b int
+}
+
+// pair returns the key of a pair of fields in compared
+func (v *validator) pair(a, b *ast.Field) fieldPair {
+	ids := [2]int{v.fieldID(a), v.fieldID(b)}
+	if ids[0] > ids[1] {
+		ids[0], ids[1] = ids[1], ids[0]
+	}
+	return fieldPair{ids[0], ids[1]}
+}
+
+func (v *validator) fieldID(f *ast.Field) int {
+	id, ok := v.fieldIDs[f]
+	if !ok {
+		id = len(v.fieldIDs)
+		v.fieldIDs[f] = id
+	}
+	return id
+}
+
+// A collectedField is a field selected within a selection set, along with the
+// type it was selected on and its definition.  The parent and definition are nil
+// if not known.
+type collectedField struct {
+	field  *ast.Field
+	parent schema.Type
+	def    *schema.FieldDescriptor
+}
+
+// collectFields gathers the fields of a selection set, including those of fragments,
+// grouped by response key.  The keys are returned in the order they are first
+// selected.
+func (v *validator) collectFields(parent schema.Type, selections ast.SelectionSet) (map[string][]collectedField, []string) {
+	fields := make(map[string][]collectedField)
+	var keys []string
+	v.collectFieldsInto(parent, selections, fields, &keys, make(map[string]bool))
+	return fields, keys
+}
+
+func (v *validator) collectFieldsInto(parent schema.Type, selections ast.SelectionSet, fields map[string][]collectedField, keys *[]string, visited map[string]bool) {
+	for _, sel := range selections {
+		switch s := sel.(type) {
+		case *ast.FieldSelection:
+			key := s.Field.Alias
+			if _, ok := fields[key]; !ok {
+				*keys = append(*keys, key)
+			}
+			fields[key] = append(fields[key], collectedField{&s.Field, parent, v.fieldDefinition(parent, s.Field.Name)})
+		case *ast.FragmentSpreadSelection:
+			if visited[s.FragmentName] {
+				continue
+			}
+			visited[s.FragmentName] = true
+			if frag, ok := v.fragments[s.FragmentName]; ok {
+				v.collectFieldsInto(v.fragmentType(frag), frag.SelectionSet, fields, keys, visited)
+			}
+		case *ast.InlineFragmentSelection:
+			fragType := parent
+			if s.OnType != "" {
+				fragType = v.schema.Type(s.OnType)
+				if !isCompositeType(fragType) {
+					fragType = nil
+				}
+			}
+			v.collectFieldsInto(fragType, s.SelectionSet, fields, keys, visited)
+		}
+	}
+}
+
+// validateFieldsCanMerge checks that all fields of a selection set that share a
+// response key can be merged into a single field of the response.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-Field-Selection-Merging
+func (v *validator) validateFieldsCanMerge(parent schema.Type, selections ast.SelectionSet) {
+	fields, keys := v.collectFields(parent, selections)
+	for _, key := range keys {
+		group := v.distinctFields(fields[key])
+		for i := 0; i < len(group); i++ {
+			for j := i + 1; j < len(group); j++ {
+				v.checkFieldConflict(key, group[i], group[j], false)
+			}
+		}
+	}
+}
+
+// checkFieldConflict checks if two fields with the same response key can be merged.
+// parentsExclusive is true if the fields are selected on object types that can never
+// apply to the same value, in which case they may select different fields or use
+// different arguments.
+func (v *validator) checkFieldConflict(key string, a, b collectedField, parentsExclusive bool) {
+	if a.field == b.field {
+		return
+	}
+	pair := v.pair(a.field, b.field)
+	if v.compared[pair] {
+		return
+	}
+	v.compared[pair] = true
+
+	if !parentsExclusive && a.parent != b.parent {
+		_, aIsObject := a.parent.(*schema.ObjectType)
+		_, bIsObject := b.parent.(*schema.ObjectType)
+		parentsExclusive = aIsObject && bIsObject
+	}
+
+	var reason string
+	if !parentsExclusive {
+		if a.field.Name != b.field.Name {
+			reason = `"` + a.field.Name + `" and "` + b.field.Name + `" are different fields`
+		} else if !sameArguments(a.field.Arguments, b.field.Arguments) {
+			reason = "they have differing arguments"
+		}
+	}
+
+	if reason == "" && a.def != nil && b.def != nil && typesConflict(a.def.Type(), b.def.Type()) {
+		reason = `they return conflicting types "` + schema.Signature(a.def.Type()) + `" and "` + schema.Signature(b.def.Type()) + `"`
+	}
+
+	if reason != "" {
+		v.report("OverlappingFieldsCanBeMerged", []Location{{a.field.Row, a.field.Col}, {b.field.Row, b.field.Col}},
+			`Fields "%s" conflict because %s. Use different aliases on the fields to fetch both if this was intentional`, key, reason)
+		return
+	}
+
+	if len(a.field.SelectionSet) == 0 || len(b.field.SelectionSet) == 0 {
+		return
+	}
+
+	aFields := v.subfields(a)
+	bFields := v.subfields(b)
+	for _, subKey := range aFields.keys {
+		bGroup := bFields.fields[subKey]
+		for _, af := range aFields.fields[subKey] {
+			for _, bf := range bGroup {
+				v.checkFieldConflict(subKey, af, bf, parentsExclusive)
+			}
+		}
+	}
+}
+
+// collectedSubfields are the distinct fields selected by a field, grouped by
+// response key
+type collectedSubfields struct {
+	fields map[string][]collectedField
+	keys   []string
+}
+
+// subfields returns the distinct fields selected by f.  The result is cached, as a
+// field is compared to each other field with the same response key.
+func (v *validator) subfields(f collectedField) collectedSubfields {
+	if sub, ok := v.subfieldCache[f.field]; ok {
+		return sub
+	}
+	var typ schema.Type
+	if f.def != nil {
+		typ = namedType(f.def.Type())
+	}
+	fields, keys := v.collectFields(typ, f.field.SelectionSet)
+	for key, group := range fields {
+		fields[key] = v.distinctFields(group)
+	}
+	sub := collectedSubfields{fields, keys}
+	v.subfieldCache[f.field] = sub
+	return sub
+}
+
+// distinctFields removes the fields of a group that have the same shape as an
+// earlier field of the group (see fieldShape).  Such fields can always be merged,
+// and are in conflict with the same fields, so comparing them all would only take
+// time quadratic in the number of times a query repeats a field.
+func (v *validator) distinctFields(group []collectedField) []collectedField {
+	if len(group) < 2 {
+		return group
+	}
+	seen := make(map[int]bool, len(group))
+	distinct := make([]collectedField, 0, len(group))
+	for _, f := range group {
+		shape := v.fieldShape(f)
+		if !seen[shape] {
+			seen[shape] = true
+			distinct = append(distinct, f)
+		}
+	}
+	return distinct
+}
+
+// fieldShape returns an id that is the same for fields selected on the same type,
+// with the same name and arguments, whose selections have the same shapes once
+// fragments are expanded.  Directives are ignored, as they do not affect merging.
+func (v *validator) fieldShape(f collectedField) int {
+	if shape, ok := v.fieldShapes[f.field]; ok {
+		return shape
+	}
+	// Until its shape is known, a field has a unique shape, so that the fields
+	// spreading a fragment cycle are not merged
+	v.fieldShapes[f.field] = -1 - v.fieldID(f.field)
+
+	var b strings.Builder
+	if f.parent != nil {
+		b.WriteString(schema.Signature(f.parent))
+	}
+	b.WriteString(" " + f.field.Name)
+	f.field.Arguments.MarshalGraphQL(&b)
+	sub := v.subfields(f)
+	for _, key := range sub.keys {
+		b.WriteString(" " + key + ":")
+		for _, sf := range sub.fields[key] {
+			b.WriteString(" " + strconv.Itoa(v.fieldShape(sf)))
+		}
+	}
+
+	shape, ok := v.shapeIDs[b.String()]
+	if !ok {
+		shape = len(v.shapeIDs)
+		v.shapeIDs[b.String()] = shape
+	}
+	v.fieldShapes[f.field] = shape
+	return shape
+}
+
+// typesConflict checks if two field types would produce differently shaped
+// responses
+func typesConflict(a, b schema.Type) bool {
+	for {
+		al, aIsList := a.(*schema.ListType)
+		bl, bIsList := b.(*schema.ListType)
+		if aIsList || bIsList {
+			if !aIsList || !bIsList {
+				return true
+			}
+			a, b = al.Unwrap(), bl.Unwrap()
+			continue
+		}
+
+		ann, aIsNotNil := a.(*schema.NotNilType)
+		bnn, bIsNotNil := b.(*schema.NotNilType)
+		if aIsNotNil || bIsNotNil {
+			if !aIsNotNil || !bIsNotNil {
+				return true
+			}
+			a, b = ann.Unwrap(), bnn.Unwrap()
+			continue
+		}
+
+		if isLeafType(a) || isLeafType(b) {
+			return schema.Signature(a) != schema.Signature(b)
+		}
+		return false
+	}
+}
+
+// sameArguments checks if two argument lists are identical, ignoring order
+func sameArguments(a, b ast.Arguments) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, arg := range a {
+		other, ok := b.ByName(arg.Name)
+		if !ok || !sameValue(arg.Value, other.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameValue(a, b ast.Value) bool {
+	switch av := a.(type) {
+	case ast.ArrayValue:
+		bv, ok := b.(ast.ArrayValue)
+		if !ok || len(av.V) != len(bv.V) {
+			return false
+		}
+		for i := range av.V {
+			if !sameValue(av.V[i], bv.V[i]) {
+				return false
+			}
+		}
+		return true
+	case ast.ObjectValue:
+		bv, ok := b.(ast.ObjectValue)
+		if !ok || len(av.V) != len(bv.V) {
+			return false
+		}
+		for k, e := range av.V {
+			other, ok := bv.V[k]
+			if !ok || !sameValue(e, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,277 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+)
+
+// A Location identifies a position in the text of a query
+type Location struct {
+	Line   int
+	Column int
+}
+
+// An Error describes a single violation of a validation rule
+type Error struct {
+	// Message is a human readable description of the problem
+	Message string
+
+	// Rule is the name of the violated rule, i.e. FieldsOnCorrectType
+	Rule string
+
+	// Locations are the positions in the query text that the error refers to
+	Locations []Location
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errors is the list of all problems found while validating a document
+type Errors []*Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Message
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// MaxErrors is the number of errors after which Validate stops validating a
+// document.  Some invalid documents, such as those repeating a field with different
+// arguments, have a number of errors that is quadratic in their size.
+const MaxErrors = 100
+
+// errTooManyErrors aborts a validation that reached MaxErrors
+type errTooManyErrors struct{}
+
+// Validate checks the document against the schema, returning all validation errors
+// found.  If the document is valid, the returned list is empty.  Once MaxErrors
+// errors are found, validation stops and a final error reports that it was aborted.
+func Validate(s *schema.Schema, doc *ast.Document) (errs Errors) {
+	v := &validator{
+		schema:     s,
+		doc:        doc,
+		fragments:  make(map[string]*ast.FragmentDefinition),
+		opScopes:   make(map[*ast.OperationDefinition]*scope),
+		fragScopes: make(map[*ast.FragmentDefinition]*scope),
+		compared:   make(map[fieldPair]bool),
+		fieldIDs:   make(map[*ast.Field]int),
+
+		subfieldCache: make(map[*ast.Field]collectedSubfields),
+		fieldShapes:   make(map[*ast.Field]int),
+		shapeIDs:      make(map[string]int),
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(errTooManyErrors); !ok {
+				panic(r)
+			}
+			errs = append(v.errs, &Error{
+				Message: "Too many validation errors, error limit reached. Validation aborted.",
+				Rule:    "MaxErrors",
+			})
+		}
+	}()
+
+	v.validateOperations()
+	v.validateFragmentDefinitions()
+
+	for _, op := range doc.OperationDefinitions {
+		v.scope = &scope{}
+		v.opScopes[op] = v.scope
+		v.validateOperation(op)
+	}
+
+	for _, frag := range doc.FragmentDefinitions {
+		v.scope = &scope{}
+		v.fragScopes[frag] = v.scope
+		v.validateDirectives(frag.Directives, schema.DirectiveLocationFragmentDefinition)
+		v.validateSelectionSet(v.fragmentType(frag), frag.SelectionSet)
+	}
+
+	v.validateFragmentUsage()
+	v.detectFragmentCycles()
+
+	for _, op := range doc.OperationDefinitions {
+		v.validateVariableUsages(op)
+	}
+
+	return v.errs
+}
+
+// validator holds the state of validating a single document
+type validator struct {
+	schema    *schema.Schema
+	doc       *ast.Document
+	errs      Errors
+	fragments map[string]*ast.FragmentDefinition
+
+	// scope collects the variable usages and fragment spreads of the
+	// operation or fragment definition currently being validated
+	scope      *scope
+	opScopes   map[*ast.OperationDefinition]*scope
+	fragScopes map[*ast.FragmentDefinition]*scope
+
+	// compared records the pairs of fields that have already been checked
+	// for conflicts
+	compared map[fieldPair]bool
+
+	// fieldIDs numbers the fields that have been checked for conflicts, to
+	// order the fields of a fieldPair
+	fieldIDs map[*ast.Field]int
+
+	// subfieldCache caches the fields selected by the fields checked for
+	// conflicts
+	subfieldCache map[*ast.Field]collectedSubfields
+
+	// fieldShapes caches the shapes of fields, see fieldShape.  shapeIDs numbers
+	// the distinct shapes by their description.
+	fieldShapes map[*ast.Field]int
+	shapeIDs    map[string]int
+}
+
+// A scope records the variables used and fragments spread directly within an
+// operation or fragment definition
+type scope struct {
+	variables []variableUsage
+	spreads   []fragmentSpread
+}
+
+type variableUsage struct {
+	name string
+
+	// typ is the type expected at the position the variable is used in, or nil
+	// if it is not known
+	typ schema.Type
+
+	// hasDefault is true if the position the variable is used in has a default value
+	hasDefault bool
+
+	location Location
+}
+
+type fragmentSpread struct {
+	name     string
+	location Location
+}
+
+func (v *validator) report(rule string, locations []Location, format string, args ...interface{}) {
+	v.errs = append(v.errs, &Error{
+		Message:   fmt.Sprintf(format, args...),
+		Rule:      rule,
+		Locations: locations,
+	})
+	if len(v.errs) >= MaxErrors {
+		panic(errTooManyErrors{})
+	}
+}
+
+// fragmentType returns the type condition of a fragment definition, or nil if it
+// does not name a composite type
+func (v *validator) fragmentType(frag *ast.FragmentDefinition) schema.Type {
+	t := v.schema.Type(frag.OnType)
+	if !isCompositeType(t) {
+		return nil
+	}
+	return t
+}
+
+// fieldDefinition looks up the definition of a field of a composite type
+func (v *validator) fieldDefinition(parent schema.Type, name string) *schema.FieldDescriptor {
+	switch t := parent.(type) {
+	case *schema.ObjectType:
+		return t.Field(name)
+	case *schema.InterfaceType:
+		return t.Field(name)
+	case *schema.UnionType:
+		// Unions have no fields of their own, but all members share the
+		// definition of __typename
+		if name == "__typename" && len(t.Members()) > 0 {
+			return t.Members()[0].Field(name)
+		}
+	}
+	return nil
+}
+
+func isCompositeType(t schema.Type) bool {
+	switch t.(type) {
+	case *schema.ObjectType, *schema.InterfaceType, *schema.UnionType:
+		return true
+	}
+	return false
+}
+
+func isLeafType(t schema.Type) bool {
+	switch t.(type) {
+	case *schema.ScalarType, *schema.EnumType:
+		return true
+	}
+	return false
+}
+
+func isInputType(t schema.Type) bool {
+	switch namedType(t).(type) {
+	case *schema.ScalarType, *schema.EnumType, *schema.InputObjectType:
+		return true
+	}
+	return false
+}
+
+// namedType removes all list and not nil wrappers from a type
+func namedType(t schema.Type) schema.Type {
+	for {
+		wt, ok := t.(schema.WrappedType)
+		if !ok {
+			return t
+		}
+		t = wt.Unwrap()
+	}
+}
+
+// possibleTypes returns the object types that a value of a composite type may have
+func possibleTypes(t schema.Type) []*schema.ObjectType {
+	switch t := t.(type) {
+	case *schema.ObjectType:
+		return []*schema.ObjectType{t}
+	case *schema.InterfaceType:
+		return t.Implementations()
+	case *schema.UnionType:
+		return t.Members()
+	}
+	return nil
+}
+
+// astTypeName returns the name of the named type referenced by an ast type
+func astTypeName(t ast.Type) string {
+	for {
+		switch tt := t.(type) {
+		case *ast.SimpleType:
+			return tt.Name
+		case *ast.ListType:
+			t = tt.Of
+		case *ast.NotNilType:
+			t = tt.Of
+		default:
+			return ""
+		}
+	}
+}
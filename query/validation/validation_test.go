@@ -0,0 +1,254 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/internal/pkg/parser"
+	"github.com/housecanary/gq/schema"
+)
+
+func named(name string) ast.Type {
+	return &ast.SimpleType{Name: name}
+}
+
+func buildTestSchema() *schema.Schema {
+	builder := schema.NewBuilder()
+	for _, name := range []string{"String", "Int", "Boolean", "ID"} {
+		builder.AddScalarType(name, nil, nil, nil)
+	}
+	color := builder.AddEnumType("Color", nil, nil, nil)
+	color.AddValue("RED")
+	color.AddValue("GREEN")
+
+	filter := builder.AddInputObjectType("Filter", nil, nil)
+	filter.AddField("name", &ast.NotNilType{Of: named("String")}, nil)
+	filter.AddField("color", named("Color"), ast.EnumValue{V: "RED"})
+	filter.AddField("limit", named("Int"), nil)
+
+	pet := builder.AddInterfaceType("Pet", nil)
+	pet.AddField("name", named("String"))
+
+	dog := builder.AddObjectType("Dog")
+	dog.Implements("Pet")
+	dog.AddField("name", named("String"), nil)
+	dog.AddField("barks", named("Boolean"), nil)
+	dog.AddField("owner", named("Human"), nil)
+
+	cat := builder.AddObjectType("Cat")
+	cat.Implements("Pet")
+	cat.AddField("name", named("String"), nil)
+	cat.AddField("meows", named("Boolean"), nil)
+	cat.AddField("lives", named("Int"), nil)
+
+	human := builder.AddObjectType("Human")
+	human.AddField("name", named("String"), nil)
+	human.AddField("pets", &ast.ListType{Of: named("Pet")}, nil)
+
+	builder.AddUnionType("CatOrDog", []string{"Cat", "Dog"}, nil)
+
+	qt := builder.AddObjectType("Query")
+	qt.AddField("dog", named("Dog"), nil)
+	qt.AddField("pet", named("Pet"), nil)
+	qt.AddField("catOrDog", named("CatOrDog"), nil)
+	qt.AddField("human", named("Human"), nil)
+	pets := qt.AddField("pets", &ast.ListType{Of: named("Pet")}, nil)
+	pets.AddArgument("filter", named("Filter"), nil)
+	pets.AddArgument("required", &ast.NotNilType{Of: named("Boolean")}, nil)
+	echo := qt.AddField("echo", named("String"), nil)
+	echo.AddArgument("s", named("String"), nil)
+	echo.AddArgument("i", named("Int"), nil)
+	echo.AddArgument("c", named("Color"), nil)
+	echo.AddArgument("ids", &ast.ListType{Of: &ast.NotNilType{Of: named("ID")}}, nil)
+	echo.AddArgument("b", &ast.NotNilType{Of: named("Boolean")}, ast.BooleanValue{V: true})
+
+	st := builder.AddObjectType("Subscription")
+	st.AddField("dogAdded", named("Dog"), nil)
+	st.AddField("catAdded", named("Cat"), nil)
+	builder.SetSubscriptionType("Subscription")
+	builder.EnableIncrementalDelivery()
+
+	return builder.MustBuild("Query")
+}
+
+func validate(t *testing.T, s *schema.Schema, query string) Errors {
+	doc, err := parser.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("Error parsing %s: %v", query, err)
+	}
+	return Validate(s, doc)
+}
+
+func TestValidDocuments(t *testing.T) {
+	s := buildTestSchema()
+	for _, query := range []string{
+		`{dog {name barks owner {name}}}`,
+		`query Q($f: Filter, $r: Boolean!) {pets(filter: $f, required: $r) {name}}`,
+		`query A {dog {name}} query B {pet {name}}`,
+		`{pet {name ... on Dog {barks} ... on Cat {meows}}}`,
+		`{catOrDog {__typename ... on Dog {name: barks} ... on Cat {name: meows}}}`,
+		`{pet {...petFields}} fragment petFields on Pet {name ...dogFields} fragment dogFields on Dog {barks}`,
+		`{dog {name name} a: dog {name} a: dog {barks}}`,
+		`{echo(s: "a", i: 1, c: RED, ids: ["a", 1], b: false)}`,
+		`{echo(ids: "a")}`,
+		`{pets(required: true, filter: {name: "a", limit: 3}) {name}}`,
+		`query($c: Color = RED, $id: ID!) {echo(c: $c, ids: [$id])}`,
+		`query($b: Boolean) {echo(b: $b)}`,
+		`query($skip: Boolean!) {dog @skip(if: $skip) {name @include(if: true)}}`,
+		`query($d: Boolean!, $n: Int) {dog {name ... @defer(label: "slow", if: $d) {barks}} pets(required: true) @stream(initialCount: $n) {name}}`,
+		`subscription {dogAdded {name}}`,
+		`{__typename __schema {queryType {name}}}`,
+	} {
+		if errs := validate(t, s, query); len(errs) != 0 {
+			t.Errorf("Expected %s to be valid, got %v", query, errs)
+		}
+	}
+}
+
+func TestInvalidDocuments(t *testing.T) {
+	s := buildTestSchema()
+	for _, c := range []struct {
+		query string
+		rule  string
+	}{
+		{`query A {dog {name}} query A {pet {name}}`, "UniqueOperationNames"},
+		{`{dog {name}} query B {pet {name}}`, "LoneAnonymousOperation"},
+		{`mutation {dog {name}}`, "KnownOperationTypes"},
+		{`subscription {dogAdded {name} catAdded {name}}`, "SingleFieldSubscriptions"},
+		{`{dog {meows}}`, "FieldsOnCorrectType"},
+		{`{catOrDog {name}}`, "FieldsOnCorrectType"},
+		{`{dog {name {first}}}`, "ScalarLeafs"},
+		{`{dog}`, "ScalarLeafs"},
+		{`{echo(x: 1)}`, "KnownArgumentNames"},
+		{`{echo(s: "a", s: "b")}`, "UniqueArgumentNames"},
+		{`{pets {name}}`, "ProvidedRequiredArguments"},
+		{`{dog {...f}} fragment f on Dog {name} fragment f on Dog {barks}`, "UniqueFragmentNames"},
+		{`{dog {...f}} fragment f on Unknown {name}`, "KnownTypeNames"},
+		{`{dog {... on Unknown {name}}}`, "KnownTypeNames"},
+		{`query($v: Unknown) {echo(s: $v)}`, "KnownTypeNames"},
+		{`{dog {...f}} fragment f on String {name}`, "FragmentsOnCompositeTypes"},
+		{`{dog {name}} fragment f on Dog {name}`, "NoUnusedFragments"},
+		{`{dog {...f}}`, "KnownFragmentNames"},
+		{`{dog {...f}} fragment f on Dog {owner {pets {...g}}} fragment g on Dog {...f}`, "NoFragmentCycles"},
+		{`{dog {...f}} fragment f on Cat {meows}`, "PossibleFragmentSpreads"},
+		{`{dog {... on Cat {meows}}}`, "PossibleFragmentSpreads"},
+		{`{echo(i: "a")}`, "ValuesOfCorrectType"},
+		{`{dog @stream {name}}`, "StreamDirectiveOnListField"},
+		{`{dog {name @defer}}`, "KnownDirectives"},
+		{`{pets(required: true) @stream(initialCount: "a") {name}}`, "ValuesOfCorrectType"},
+		{`{echo(i: 3000000000)}`, "ValuesOfCorrectType"},
+		{`{echo(c: BLUE)}`, "ValuesOfCorrectType"},
+		{`{echo(b: null)}`, "ValuesOfCorrectType"},
+		{`{pets(required: true, filter: {limit: 1}) {name}}`, "ValuesOfCorrectType"},
+		{`{pets(required: true, filter: {name: "a", other: 1}) {name}}`, "ValuesOfCorrectType"},
+		{`{dog @unknown {name}}`, "KnownDirectives"},
+		{`query @skip(if: true) {dog {name}}`, "KnownDirectives"},
+		{`{dog @skip(if: true) @skip(if: false) {name}}`, "UniqueDirectivesPerLocation"},
+		{`query($a: String, $a: String) {echo(s: $a)}`, "UniqueVariableNames"},
+		{`query($d: Dog) {echo(s: $d)}`, "VariablesAreInputTypes"},
+		{`{echo(s: $s)}`, "NoUndefinedVariables"},
+		{`query Q {dog {...f}} fragment f on Dog {owner {pets {name}} name @include(if: $i)}`, "NoUndefinedVariables"},
+		{`query($s: String) {echo}`, "NoUnusedVariables"},
+		{`query($i: Int) {echo(s: $i)}`, "VariablesInAllowedPosition"},
+		{`query($b: Boolean) {pets(required: $b) {name}}`, "VariablesInAllowedPosition"},
+		{`query($ids: [ID]) {echo(ids: $ids)}`, "VariablesInAllowedPosition"},
+		{`{dog {name: barks name}}`, "OverlappingFieldsCanBeMerged"},
+		{`{echo(s: "a") echo(s: "b")}`, "OverlappingFieldsCanBeMerged"},
+		{`{dog {owner {name}} dog {owner {name: pets {name}}}}`, "OverlappingFieldsCanBeMerged"},
+		{`{pet {... on Dog {x: barks} ... on Cat {x: lives}}}`, "OverlappingFieldsCanBeMerged"},
+	} {
+		errs := validate(t, s, c.query)
+		if len(errs) != 1 {
+			t.Errorf("Expected one error validating %s, got %v", c.query, errs)
+			continue
+		}
+		if errs[0].Rule != c.rule {
+			t.Errorf("Expected %s to violate %s, got %s: %s", c.query, c.rule, errs[0].Rule, errs[0].Message)
+		}
+	}
+}
+
+func TestMultipleErrors(t *testing.T) {
+	errs := validate(t, buildTestSchema(), `{dog {meows} cat}`)
+	expected := Errors{
+		{`Cannot query field "meows" on type "Dog"`, "FieldsOnCorrectType", []Location{{1, 7}}},
+		{`Cannot query field "cat" on type "Query"`, "FieldsOnCorrectType", []Location{{1, 14}}},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), errs)
+	}
+	for i, e := range expected {
+		if !reflect.DeepEqual(errs[i], e) {
+			t.Errorf("Expected error %#v, got %#v", e, errs[i])
+		}
+	}
+}
+
+func repeatedFieldsQuery(n int, suffix string) string {
+	return "{" + strings.Repeat("dog {name owner {name}} ", n) + suffix + "}"
+}
+
+func TestRepeatedFields(t *testing.T) {
+	s := buildTestSchema()
+	start := time.Now()
+	if errs := validate(t, s, repeatedFieldsQuery(20000, "")); len(errs) != 0 {
+		t.Errorf("Expected repeated fields to be valid, got %v", errs)
+	}
+	// Without removing identical fields, this takes minutes
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Validating repeated fields took %v", elapsed)
+	}
+
+	errs := validate(t, s, repeatedFieldsQuery(1000, "dog {name: barks}"))
+	if len(errs) != 1 || errs[0].Rule != "OverlappingFieldsCanBeMerged" {
+		t.Errorf("Expected a conflict with the repeated fields, got %v", errs)
+	}
+}
+
+func BenchmarkRepeatedFields(b *testing.B) {
+	s := buildTestSchema()
+	doc, err := parser.ParseQuery(repeatedFieldsQuery(4000, ""))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Validate(s, doc)
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("{")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&b, "echo(i: %d) ", i)
+	}
+	b.WriteString("}")
+
+	start := time.Now()
+	errs := validate(t, buildTestSchema(), b.String())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Validating conflicting fields took %v", elapsed)
+	}
+	if len(errs) != MaxErrors+1 || errs[MaxErrors].Rule != "MaxErrors" {
+		t.Errorf("Expected validation to stop after %d errors, got %d errors", MaxErrors, len(errs))
+	}
+}
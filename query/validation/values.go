@@ -0,0 +1,162 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"math"
+	"sort"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/schema"
+)
+
+// validateValue checks that a value supplied at a position of type typ is valid.
+// Variables found in the value are recorded to be checked against the definitions of
+// the operations using them.  If typ is nil, only the variables are recorded.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-Values-of-Correct-Type
+// and https://facebook.github.io/graphql/June2018/#sec-Input-Object-Required-Fields
+func (v *validator) validateValue(val ast.Value, typ schema.Type, hasDefault bool, location Location) {
+	if ref, ok := val.(ast.ReferenceValue); ok {
+		v.scope.variables = append(v.scope.variables, variableUsage{ref.Name, typ, hasDefault, location})
+		return
+	}
+
+	if typ == nil {
+		v.recordVariables(val, location)
+		return
+	}
+
+	_, isNil := val.(ast.NilValue)
+	if nn, ok := typ.(*schema.NotNilType); ok {
+		if isNil {
+			v.reportBadValue(val, typ, location)
+			return
+		}
+		v.validateValue(val, nn.Unwrap(), hasDefault, location)
+		return
+	}
+
+	if isNil {
+		return
+	}
+
+	switch t := typ.(type) {
+	case *schema.ListType:
+		if av, ok := val.(ast.ArrayValue); ok {
+			for _, e := range av.V {
+				v.validateValue(e, t.Unwrap(), false, location)
+			}
+		} else {
+			v.validateValue(val, t.Unwrap(), false, location)
+		}
+	case *schema.InputObjectType:
+		ov, ok := val.(ast.ObjectValue)
+		if !ok {
+			v.reportBadValue(val, typ, location)
+			return
+		}
+
+		names := make([]string, 0, len(ov.V))
+		for name := range ov.V {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			field := t.Field(name)
+			if field == nil {
+				v.report("ValuesOfCorrectType", []Location{location},
+					`Field "%s" is not defined by type "%s"`, name, t.Name())
+				v.recordVariables(ov.V[name], location)
+				continue
+			}
+			v.validateValue(ov.V[name], field.Type(), field.HasDefaultValue(), location)
+		}
+
+		for _, field := range t.Fields() {
+			if _, ok := field.Type().(*schema.NotNilType); !ok || field.HasDefaultValue() {
+				continue
+			}
+			if _, ok := ov.V[field.Name()]; !ok {
+				v.report("ValuesOfCorrectType", []Location{location},
+					`Field "%s.%s" of required type "%s" was not provided`, t.Name(), field.Name(), schema.Signature(field.Type()))
+			}
+		}
+	case *schema.EnumType:
+		if ev, ok := val.(ast.EnumValue); !ok || !t.HasValue(ev.V) {
+			v.reportBadValue(val, typ, location)
+		}
+	case *schema.ScalarType:
+		if !isValidScalarLiteral(t, val) {
+			v.reportBadValue(val, typ, location)
+		}
+		v.recordVariables(val, location)
+	}
+}
+
+func (v *validator) reportBadValue(val ast.Value, typ schema.Type, location Location) {
+	v.report("ValuesOfCorrectType", []Location{location},
+		`Expected value of type "%s", found %s`, schema.Signature(typ), val.Representation())
+}
+
+// recordVariables records all variables referenced by a value as used in a
+// position of unknown type
+func (v *validator) recordVariables(val ast.Value, location Location) {
+	switch tv := val.(type) {
+	case ast.ReferenceValue:
+		v.scope.variables = append(v.scope.variables, variableUsage{tv.Name, nil, false, location})
+	case ast.ArrayValue:
+		for _, e := range tv.V {
+			v.recordVariables(e, location)
+		}
+	case ast.ObjectValue:
+		for _, e := range tv.V {
+			v.recordVariables(e, location)
+		}
+	}
+}
+
+// isValidScalarLiteral checks a literal against the built in scalar types.  The
+// literal representation of custom scalars is up to the scalar, so any literal
+// is accepted for them.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-Scalars
+func isValidScalarLiteral(t *schema.ScalarType, val ast.Value) bool {
+	switch t.Name() {
+	case "Int":
+		iv, ok := val.(ast.IntValue)
+		return ok && iv.V >= math.MinInt32 && iv.V <= math.MaxInt32
+	case "Float":
+		switch val.(type) {
+		case ast.IntValue, ast.FloatValue:
+			return true
+		}
+		return false
+	case "String":
+		_, ok := val.(ast.StringValue)
+		return ok
+	case "Boolean":
+		_, ok := val.(ast.BooleanValue)
+		return ok
+	case "ID":
+		switch val.(type) {
+		case ast.StringValue, ast.IntValue:
+			return true
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,295 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"github.com/housecanary/gq/ast"
+)
+
+// A ResultField is a field of a ResultObject
+type ResultField struct {
+	Name  string
+	Value interface{}
+}
+
+// A ResultObject is an object in the result of ExecuteToValue.  Its fields are
+// in the order they were selected by the query.
+//
+// Field values are nil, int64, float64, bool, string, ResultObject or
+// []interface{} (whose items are also of these types).
+type ResultObject []ResultField
+
+// Get returns the value of the named field, and whether the field is present
+func (o ResultObject) Get(name string) (interface{}, bool) {
+	for _, f := range o {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Map converts this object to a map.  Nested objects are converted as well, so the
+// result contains only maps, slices and scalar values.
+func (o ResultObject) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(o))
+	for _, f := range o {
+		m[f.Name] = plainValue(f.Value)
+	}
+	return m
+}
+
+func plainValue(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case ResultObject:
+		return tv.Map()
+	case []interface{}:
+		items := make([]interface{}, len(tv))
+		for i, item := range tv {
+			items[i] = plainValue(item)
+		}
+		return items
+	}
+	return v
+}
+
+// MarshalJSON serializes this object to JSON, preserving field order
+func (o ResultObject) MarshalJSON() ([]byte, error) {
+	stream := streamPool.BorrowStream(nil)
+	defer streamPool.ReturnStream(stream)
+	stream.WriteObjectStart()
+	for i, f := range o {
+		if i != 0 {
+			stream.WriteMore()
+		}
+		stream.WriteObjectField(f.Name)
+		stream.WriteVal(f.Value)
+	}
+	stream.WriteObjectEnd()
+	if stream.Error != nil {
+		return nil, stream.Error
+	}
+	buf := stream.Buffer()
+	content := make([]byte, len(buf))
+	copy(content, buf)
+	return content, nil
+}
+
+// A Result is the outcome of executing a query with ExecuteToValue
+type Result struct {
+	// Data is the selected data, or nil if execution did not begin or a null
+	// value propagated to the root of the result.
+	Data ResultObject
+
+	// Errors lists the errors that occurred, in the order they appear in the
+	// result.
+	Errors []*ResultError
+
+	// Extensions holds the entries contributed by an ExtensionsListener, if any
+	Extensions map[string]interface{}
+}
+
+// A ResultError is an error that occurred executing a query
+type ResultError struct {
+	// Err is the error, after conversion by any ErrorPresenter
+	Err error
+
+	// Path is the response path of the value that failed, made of field names and
+	// list indices.  It is nil for errors that occurred before execution began.
+	Path []interface{}
+
+	// Locations lists the locations in the query text of the field that failed
+	Locations []ErrorLocation
+}
+
+func (e *ResultError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ResultError) Unwrap() error {
+	return e.Err
+}
+
+func newResultErrors(errs []gqlError) []*ResultError {
+	if len(errs) == 0 {
+		return nil
+	}
+	result := make([]*ResultError, len(errs))
+	for i, e := range errs {
+		re := &ResultError{Err: e.error, Path: e.path}
+		if e.field != nil && e.field.Row > 0 && e.field.Col > 0 {
+			re.Locations = []ErrorLocation{{e.field.Row, e.field.Col}}
+		}
+		result[i] = re
+	}
+	return result
+}
+
+// valueCollector is a collector that builds a tree of Go values
+type valueCollector struct {
+	required bool
+
+	// kind/dat store the value of this node.  dat is the value itself for
+	// vKindSerialized, edat for vKindError, and a subValueCollector for vKindSub.
+	kind vKind
+	dat  interface{}
+}
+
+type subValueCollector interface {
+	collectValue(depth int) (interface{}, []gqlError, bool)
+}
+
+var _ collector = &valueCollector{}
+
+func (c *valueCollector) set(kind vKind, v interface{}) {
+	if c.kind != vKindNil {
+		panic("Set value on already set collector")
+	}
+	c.kind = kind
+	c.dat = v
+}
+
+func (c *valueCollector) Int(v int64) {
+	c.set(vKindSerialized, v)
+}
+
+func (c *valueCollector) Float(v float64) {
+	c.set(vKindSerialized, v)
+}
+
+func (c *valueCollector) Bool(v bool) {
+	c.set(vKindSerialized, v)
+}
+
+func (c *valueCollector) String(v string) {
+	c.set(vKindSerialized, v)
+}
+
+func (c *valueCollector) Object(sizeHint int) objectCollector {
+	if sizeHint < 0 {
+		sizeHint = 0
+	}
+	o := &oValueCollector{fields: make([]oValueField, 0, sizeHint)}
+	c.set(vKindSub, o)
+	return o
+}
+
+func (c *valueCollector) Array(sizeHint int) arrayCollector {
+	if sizeHint < 0 {
+		sizeHint = 0
+	}
+	a := &aValueCollector{values: make([]valueCollector, 0, sizeHint)}
+	c.set(vKindSub, a)
+	return a
+}
+
+func (c *valueCollector) Required(field *ast.Field) {
+	if c.kind == vKindNil {
+		c.dat = edat{nil, field}
+	}
+	c.required = true
+}
+
+func (c *valueCollector) Error(err error, field *ast.Field) {
+	c.kind = vKindError
+	c.dat = edat{err, field}
+}
+
+func (c *valueCollector) collectValue(depth int) (interface{}, []gqlError, bool) {
+	switch c.kind {
+	case vKindError:
+		e := c.dat.(edat)
+		return nil, []gqlError{pe(e.err, depth, e.field)}, !c.required
+	case vKindNil:
+		if c.required {
+			e := c.dat.(edat)
+			return nil, []gqlError{pe(errUnexpectedNil, depth, e.field)}, false
+		}
+	case vKindSerialized:
+		return c.dat, nil, true
+	case vKindSub:
+		v, errs, ok := c.dat.(subValueCollector).collectValue(depth)
+		if !ok {
+			// Error bubbled up from child.  Either bubble the error or
+			// use nil as our value depending if we are required
+			return nil, errs, !c.required
+		}
+		return v, errs, true
+	}
+	return nil, nil, true
+}
+
+type oValueField struct {
+	name string
+	c    valueCollector
+}
+
+type oValueCollector struct {
+	fields []oValueField
+}
+
+func (c *oValueCollector) Field(name string) collector {
+	c.fields = append(c.fields, oValueField{name: name})
+	return &c.fields[len(c.fields)-1].c
+}
+
+func (c *oValueCollector) collectValue(depth int) (interface{}, []gqlError, bool) {
+	var allErrs []gqlError
+	allOk := true
+	obj := make(ResultObject, len(c.fields))
+	for i := range c.fields {
+		f := &c.fields[i]
+		v, fieldErrors, ok := f.c.collectValue(depth + 1)
+		for _, fe := range fieldErrors {
+			fe.path[depth] = f.name
+		}
+		obj[i] = ResultField{f.name, v}
+		allErrs = append(allErrs, fieldErrors...)
+		allOk = allOk && ok
+	}
+	if !allOk {
+		return nil, allErrs, false
+	}
+	return obj, allErrs, true
+}
+
+type aValueCollector struct {
+	values []valueCollector
+}
+
+func (c *aValueCollector) Item() collector {
+	c.values = append(c.values, valueCollector{})
+	return &c.values[len(c.values)-1]
+}
+
+func (c *aValueCollector) collectValue(depth int) (interface{}, []gqlError, bool) {
+	var allErrs []gqlError
+	allOk := true
+	items := make([]interface{}, len(c.values))
+	for i := range c.values {
+		v, itemErrors, ok := c.values[i].collectValue(depth + 1)
+		for _, fe := range itemErrors {
+			fe.path[depth] = i
+		}
+		items[i] = v
+		allErrs = append(allErrs, itemErrors...)
+		allOk = allOk && ok
+	}
+	if !allOk {
+		return nil, allErrs, false
+	}
+	return items, allErrs, true
+}
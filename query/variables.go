@@ -15,10 +15,14 @@
 package query
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"sort"
 
 	jsoniter "github.com/json-iterator/go"
 
+	"github.com/housecanary/gq/ast"
 	"github.com/housecanary/gq/schema"
 )
 
@@ -101,3 +105,251 @@ func decodeJSONArray(itr *jsoniter.Iterator) (schema.LiteralArray, bool) {
 	})
 	return r, ok
 }
+
+// A variableDefinition is the compiled form of a variable declared by an operation
+type variableDefinition struct {
+	Name         string
+	Type         schema.Type
+	DefaultValue schema.LiteralValue
+	HasDefault   bool
+}
+
+// buildVariableDefinitions compiles the variable definitions of an operation
+func buildVariableDefinitions(s *schema.Schema, defs ast.VariableDefinitions) ([]*variableDefinition, error) {
+	result := make([]*variableDefinition, len(defs))
+	seen := make(map[string]bool)
+	for i, def := range defs {
+		if seen[def.VariableName] {
+			return nil, fmt.Errorf("Variable $%s is defined multiple times", def.VariableName)
+		}
+		seen[def.VariableName] = true
+
+		typ := s.ResolveType(def.Type)
+		if typ == nil {
+			return nil, fmt.Errorf("Variable $%s has unknown type %s", def.VariableName, def.Type.Signature())
+		}
+		if !isInputType(typ) {
+			return nil, fmt.Errorf("Variable $%s cannot be of non-input type %s", def.VariableName, def.Type.Signature())
+		}
+
+		vd := &variableDefinition{
+			Name: def.VariableName,
+			Type: typ,
+		}
+		if def.DefaultValue != nil {
+			defaultValue, problems := coerceVariableValue(context.Background(), typ, literalFromConstValue(def.DefaultValue), "")
+			if len(problems) > 0 {
+				return nil, fmt.Errorf("Variable $%s has invalid default value: %s", def.VariableName, problems[0])
+			}
+			vd.DefaultValue = defaultValue
+			vd.HasDefault = true
+		}
+		result[i] = vd
+	}
+	return result, nil
+}
+
+func isInputType(typ schema.Type) bool {
+	switch t := typ.(type) {
+	case schema.WrappedType:
+		return isInputType(t.Unwrap())
+	case schema.InputableType:
+		return true
+	}
+	return false
+}
+
+// coerceVariables validates the supplied variables against the definitions of
+// an operation, applying default values.  The returned Variables contain only
+// declared variables.  If any variable is invalid, all problems are returned.
+//
+// See https://facebook.github.io/graphql/June2018/#sec-Coercing-Variable-Values
+func coerceVariables(ctx context.Context, defs []*variableDefinition, variables Variables) (Variables, []error) {
+	if len(defs) == 0 {
+		return nil, nil
+	}
+
+	var errs []error
+	coerced := make(Variables, len(defs))
+	for _, def := range defs {
+		v, provided := variables[def.Name]
+		if !provided {
+			if def.HasDefault {
+				coerced[def.Name] = def.DefaultValue
+				continue
+			}
+			if _, ok := def.Type.(*schema.NotNilType); ok {
+				errs = append(errs, fmt.Errorf("Variable $%s of required type %s was not provided", def.Name, schema.Signature(def.Type)))
+			}
+			continue
+		}
+
+		cv, problems := coerceVariableValue(ctx, def.Type, v, "")
+		for _, p := range problems {
+			errs = append(errs, fmt.Errorf("Variable $%s got invalid value: %s", def.Name, p))
+		}
+		coerced[def.Name] = cv
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return coerced, nil
+}
+
+// coerceVariableValue checks a value against an input type, and returns the
+// coerced value and a description of each problem found.
+func coerceVariableValue(ctx context.Context, typ schema.Type, v schema.LiteralValue, path string) (schema.LiteralValue, []string) {
+	if nn, ok := typ.(*schema.NotNilType); ok {
+		if v == nil {
+			return nil, []string{fmt.Sprintf("Expected non-null value of type %s%s", schema.Signature(typ), pathSuffix(path))}
+		}
+		return coerceVariableValue(ctx, nn.Unwrap(), v, path)
+	}
+
+	if v == nil {
+		return nil, nil
+	}
+
+	switch t := typ.(type) {
+	case *schema.ListType:
+		av, ok := v.(schema.LiteralArray)
+		if !ok {
+			// A single value is coerced to a list of one element.
+			// See https://facebook.github.io/graphql/June2018/#sec-Type-System.List
+			cv, problems := coerceVariableValue(ctx, t.Unwrap(), v, path)
+			if len(problems) > 0 {
+				return nil, problems
+			}
+			return schema.LiteralArray{cv}, nil
+		}
+		var allProblems []string
+		result := make(schema.LiteralArray, len(av))
+		for i, e := range av {
+			cv, problems := coerceVariableValue(ctx, t.Unwrap(), e, fmt.Sprintf("%s[%d]", path, i))
+			allProblems = append(allProblems, problems...)
+			result[i] = cv
+		}
+		return result, allProblems
+
+	case *schema.InputObjectType:
+		ov, ok := v.(schema.LiteralObject)
+		if !ok {
+			return nil, []string{fmt.Sprintf("Expected object of type %s%s", t.Name(), pathSuffix(path))}
+		}
+		var allProblems []string
+		result := make(schema.LiteralObject, len(ov))
+		for _, f := range t.Fields() {
+			fieldPath := path + "." + f.Name()
+			fv, provided := ov[f.Name()]
+			if !provided {
+				if f.HasDefaultValue() {
+					result[f.Name()] = f.DefaultValue()
+				} else if _, ok := f.Type().(*schema.NotNilType); ok {
+					allProblems = append(allProblems, fmt.Sprintf("Field %s of required type %s was not provided%s", f.Name(), schema.Signature(f.Type()), pathSuffix(path)))
+				}
+				continue
+			}
+			cv, problems := coerceVariableValue(ctx, f.Type(), fv, fieldPath)
+			allProblems = append(allProblems, problems...)
+			result[f.Name()] = cv
+		}
+		var unknown []string
+		for k := range ov {
+			if t.Field(k) == nil {
+				unknown = append(unknown, k)
+			}
+		}
+		sort.Strings(unknown)
+		for _, k := range unknown {
+			allProblems = append(allProblems, fmt.Sprintf("Field %s is not defined by type %s%s", k, t.Name(), pathSuffix(path)))
+		}
+		return result, allProblems
+
+	case *schema.EnumType:
+		sv, ok := v.(schema.LiteralString)
+		if !ok || !t.HasValue(string(sv)) {
+			return nil, []string{fmt.Sprintf("Expected value of type %s%s", t.Name(), pathSuffix(path))}
+		}
+		return v, nil
+
+	case *schema.ScalarType:
+		if !scalarAccepts(ctx, t, v) {
+			return nil, []string{fmt.Sprintf("Expected value of type %s%s", t.Name(), pathSuffix(path))}
+		}
+		return v, nil
+	}
+
+	return nil, []string{fmt.Sprintf("Invalid input type %s%s", schema.Signature(typ), pathSuffix(path))}
+}
+
+// scalarAccepts checks whether a scalar type can accept a literal value.  The
+// built in scalars are checked by kind, other scalars are checked by attempting
+// to decode the value.
+func scalarAccepts(ctx context.Context, t *schema.ScalarType, v schema.LiteralValue) (ok bool) {
+	switch t.Name() {
+	case "Int":
+		n, isNum := v.(schema.LiteralNumber)
+		return isNum && float64(n) == math.Trunc(float64(n)) && n >= math.MinInt32 && n <= math.MaxInt32
+	case "Float":
+		_, isNum := v.(schema.LiteralNumber)
+		return isNum
+	case "String":
+		_, isStr := v.(schema.LiteralString)
+		return isStr
+	case "Boolean":
+		_, isBool := v.(schema.LiteralBool)
+		return isBool
+	case "ID":
+		switch v.(type) {
+		case schema.LiteralString, schema.LiteralNumber:
+			return true
+		}
+		return false
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+	_, err := t.Decode(ctx, v)
+	return err == nil
+}
+
+func pathSuffix(path string) string {
+	if path == "" {
+		return ""
+	}
+	return fmt.Sprintf(" at value%s", path)
+}
+
+// literalFromConstValue converts a constant (variable free) ast value to a
+// literal value
+func literalFromConstValue(val ast.Value) schema.LiteralValue {
+	switch v := val.(type) {
+	case ast.StringValue:
+		return schema.LiteralString(v.V)
+	case ast.IntValue:
+		return schema.LiteralNumber(v.V)
+	case ast.FloatValue:
+		return schema.LiteralNumber(v.V)
+	case ast.BooleanValue:
+		return schema.LiteralBool(v.V)
+	case ast.EnumValue:
+		return schema.LiteralString(v.V)
+	case ast.ArrayValue:
+		ary := make(schema.LiteralArray, len(v.V))
+		for i, e := range v.V {
+			ary[i] = literalFromConstValue(e)
+		}
+		return ary
+	case ast.ObjectValue:
+		m := make(schema.LiteralObject)
+		for k, e := range v.V {
+			m[k] = literalFromConstValue(e)
+		}
+		return m
+	}
+	return nil
+}
@@ -61,3 +61,41 @@ func TestParseObjectVariables(t *testing.T) {
 		t.Errorf("Expected [\"c\"] got %v", vars["c"])
 	}
 }
+
+func TestVariableDefaults(t *testing.T) {
+	runQuery(t, `query($s: String = "def") {fooWithArg(in: $s)}`, nil, `{"data":{"fooWithArg":"def"}}`, 0)
+	runQuery(t, `query($s: String = "def") {fooWithArg(in: $s)}`, Variables{"s": schema.LiteralString("val")}, `{"data":{"fooWithArg":"val"}}`, 0)
+}
+
+func TestVariableCoercionErrors(t *testing.T) {
+	runQuery(t, `query($s: String!) {fooWithArg(in: $s)}`, nil,
+		`{"errors":[{"message":"Variable $s of required type String! was not provided"}]}`, 0)
+	runQuery(t, `query($s: String!, $l: Lookup) {fooWithArg(in: $s) lookup(in: $l)}`, Variables{
+		"s": schema.LiteralNumber(1),
+		"l": schema.LiteralObject{"color": schema.LiteralString("BLUE"), "other": schema.LiteralBool(true)},
+	}, `{"errors":[`+
+		`{"message":"Variable $s got invalid value: Expected value of type String"},`+
+		`{"message":"Variable $l got invalid value: Expected value of type Color at value.color"},`+
+		`{"message":"Variable $l got invalid value: Field name of required type String! was not provided"},`+
+		`{"message":"Variable $l got invalid value: Field other is not defined by type Lookup"}]}`, 0)
+}
+
+func TestVariableInputObject(t *testing.T) {
+	runQuery(t, `query($l: Lookup) {lookup(in: $l)}`, Variables{
+		"l": schema.LiteralObject{"name": schema.LiteralString("foo")},
+	}, `{"data":{"lookup":"foo"}}`, 0)
+}
+
+func TestVariableDefinitionErrors(t *testing.T) {
+	s := buildTestSchema()
+	for _, query := range []string{
+		`{fooWithArg(in: $s)}`,
+		`query($s: Unknown) {fooWithArg(in: $s)}`,
+		`query($s: Int = "a") {fooWithArg}`,
+		`query($s: String, $s: String) {fooWithArg(in: $s)}`,
+	} {
+		if _, err := PrepareQuery(query, "", s); err == nil {
+			t.Errorf("Expected error preparing %s", query)
+		}
+	}
+}
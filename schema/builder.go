@@ -66,6 +66,11 @@ func NewBuilder() *Builder {
 		nil,
 		nil,
 		false,
+		false,
+		false,
+		false,
+		"",
+		"",
 	}
 }
 
@@ -76,6 +81,11 @@ type Builder struct {
 	directives           []*DirectiveDefinitionBuilder
 	deferredErrors       []error
 	disableIntrospection bool
+	incrementalDelivery  bool
+	costDirective        bool
+	cacheControl         bool
+	mutationTypeName     string
+	subscriptionTypeName string
 }
 
 type typeBuilder interface {
@@ -245,6 +255,13 @@ func (b *Builder) Build(queryTypeName string) (*Schema, error) {
 
 	var ctx buildContext
 
+	if b.cacheControl {
+		if _, ok := b.typeBuilders[CacheControlScopeType.name]; ok {
+			return nil, fmt.Errorf("Type %s is reserved by the @cacheControl directive", CacheControlScopeType.name)
+		}
+		b.resolvedTypes[CacheControlScopeType.name] = CacheControlScopeType
+	}
+
 	for k, v := range b.typeBuilders {
 		if _, ok := b.resolvedTypes[k]; !ok {
 			err := v.registerType(&ctx)
@@ -267,9 +284,27 @@ func (b *Builder) Build(queryTypeName string) (*Schema, error) {
 		}
 	}
 
-	directives := make([]*DirectiveDefinition, len(b.directives))
+	directives := make([]*DirectiveDefinition, len(builtinDirectives), len(builtinDirectives)+len(b.directives))
 	directivesByName := make(map[string]bool)
-	for i, d := range b.directives {
+	for i, d := range builtinDirectives {
+		directives[i] = d
+		directivesByName[d.name] = true
+	}
+	if b.incrementalDelivery {
+		for _, d := range []*DirectiveDefinition{DeferDirective, StreamDirective} {
+			directives = append(directives, d)
+			directivesByName[d.name] = true
+		}
+	}
+	if b.costDirective {
+		directives = append(directives, CostDirective)
+		directivesByName[CostDirective.name] = true
+	}
+	if b.cacheControl {
+		directives = append(directives, CacheControlDirective)
+		directivesByName[CacheControlDirective.name] = true
+	}
+	for _, d := range b.directives {
 		if _, ok := directivesByName[d.name]; ok {
 			return nil, fmt.Errorf("Duplicate directive definition %s", d.name)
 		}
@@ -293,12 +328,12 @@ func (b *Builder) Build(queryTypeName string) (*Schema, error) {
 				defaultValue:  a.defaultValue,
 			}
 		}
-		directives[i] = &DirectiveDefinition{
+		directives = append(directives, &DirectiveDefinition{
 			named:       d.named,
 			description: d.description,
 			arguments:   args,
 			locations:   d.locations,
-		}
+		})
 	}
 
 	qtc, ok := b.resolvedTypes[queryTypeName]
@@ -310,7 +345,17 @@ func (b *Builder) Build(queryTypeName string) (*Schema, error) {
 		return nil, fmt.Errorf("Query type %s is not an object type", queryTypeName)
 	}
 
-	s := &Schema{QueryType: qt, allTypes: b.resolvedTypes, directives: directives}
+	mt, err := b.lookupRootType("Mutation", b.mutationTypeName)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := b.lookupRootType("Subscription", b.subscriptionTypeName)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Schema{QueryType: qt, MutationType: mt, SubscriptionType: st, allTypes: b.resolvedTypes, directives: directives}
 
 	if !b.disableIntrospection {
 		// Add in introspection meta fields
@@ -356,6 +401,55 @@ func (b *Builder) DisableIntrospection() {
 	b.disableIntrospection = true
 }
 
+// EnableIncrementalDelivery adds the @defer and @stream directives to the schema,
+// allowing queries to request that parts of their results are delivered
+// incrementally.  See query.PreparedQuery.ExecuteIncremental.
+func (b *Builder) EnableIncrementalDelivery() {
+	b.incrementalDelivery = true
+}
+
+// EnableCostDirective adds the @cost directive to the schema, which is used to
+// assign costs to fields.  See query.PreparedQuery.Cost.
+func (b *Builder) EnableCostDirective() {
+	b.costDirective = true
+}
+
+// EnableCacheControl adds the @cacheControl directive, and the CacheControlScope enum
+// type of its scope argument, to the schema.  The directive gives cache hints for
+// fields and types.  See query.WithCachePolicy.
+func (b *Builder) EnableCacheControl() {
+	b.cacheControl = true
+}
+
+// SetMutationType sets the name of the object type that is the root of mutation
+// operations.  If it is not set, the schema does not support mutations.
+func (b *Builder) SetMutationType(name string) {
+	b.mutationTypeName = name
+}
+
+// SetSubscriptionType sets the name of the object type that is the root of
+// subscription operations.  If it is not set, the schema does not support
+// subscriptions.
+func (b *Builder) SetSubscriptionType(name string) {
+	b.subscriptionTypeName = name
+}
+
+// lookupRootType finds the optional root operation type with the given name
+func (b *Builder) lookupRootType(kind string, name string) (*ObjectType, error) {
+	if name == "" {
+		return nil, nil
+	}
+	t, ok := b.resolvedTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("%s type %s does not exist", kind, name)
+	}
+	ot, ok := t.(*ObjectType)
+	if !ok {
+		return nil, fmt.Errorf("%s type %s is not an object type", kind, name)
+	}
+	return ot, nil
+}
+
 func (b *Builder) addTypeBuilder(tb typeBuilder) {
 	if _, ok := b.typeBuilders[tb.Name()]; ok {
 		b.deferredErrors = append(b.deferredErrors, fmt.Errorf("Type %s already registered", tb.Name()))
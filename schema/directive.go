@@ -15,6 +15,7 @@
 package schema
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/housecanary/gq/ast"
@@ -77,6 +78,184 @@ func (d *DirectiveDefinition) writeSchemaDefinition(w *schemaWriter) {
 	}
 }
 
+// Description returns the description of the directive
+func (d *DirectiveDefinition) Description() string {
+	return d.description
+}
+
+// Arguments returns the arguments accepted by the directive
+func (d *DirectiveDefinition) Arguments() []*ArgumentDescriptor {
+	return d.arguments
+}
+
+// Argument returns the named argument, or nil if the directive does not accept it
+func (d *DirectiveDefinition) Argument(name string) *ArgumentDescriptor {
+	for _, arg := range d.arguments {
+		if arg.name == name {
+			return arg
+		}
+	}
+
+	return nil
+}
+
+// Locations returns the locations at which the directive may be used
+func (d *DirectiveDefinition) Locations() []DirectiveLocation {
+	return d.locations
+}
+
+// Directives that are defined in every schema.
+// See https://facebook.github.io/graphql/June2018/#sec-Type-System.Directives
+var (
+	SkipDirective = &DirectiveDefinition{
+		named:       named{"skip"},
+		description: "Directs the executor to skip this field or fragment when the `if` argument is true.",
+		arguments: []*ArgumentDescriptor{
+			{
+				named:         named{"if"},
+				schemaElement: schemaElement{description: "Skipped when true."},
+				typ:           &NotNilType{introspectionBoolType},
+			},
+		},
+		locations: []DirectiveLocation{DirectiveLocationField, DirectiveLocationFragmentSpread, DirectiveLocationInlineFragment},
+	}
+
+	IncludeDirective = &DirectiveDefinition{
+		named:       named{"include"},
+		description: "Directs the executor to include this field or fragment only when the `if` argument is true.",
+		arguments: []*ArgumentDescriptor{
+			{
+				named:         named{"if"},
+				schemaElement: schemaElement{description: "Included when true."},
+				typ:           &NotNilType{introspectionBoolType},
+			},
+		},
+		locations: []DirectiveLocation{DirectiveLocationField, DirectiveLocationFragmentSpread, DirectiveLocationInlineFragment},
+	}
+)
+
+var builtinDirectives = []*DirectiveDefinition{SkipDirective, IncludeDirective}
+
+// Directives for incremental delivery of results.  These are added to a schema by
+// Builder.EnableIncrementalDelivery.
+// See https://github.com/graphql/graphql-spec/blob/main/rfcs/DeferStream.md
+var (
+	DeferDirective = &DirectiveDefinition{
+		named:       named{"defer"},
+		description: "Directs the executor to deliver this fragment after the rest of the result, when the `if` argument is true.",
+		arguments: []*ArgumentDescriptor{
+			{
+				named:         named{"label"},
+				schemaElement: schemaElement{description: "Identifies the delivered result."},
+				typ:           introspectionStringType,
+			},
+			{
+				named:         named{"if"},
+				schemaElement: schemaElement{description: "Deferred when true."},
+				typ:           &NotNilType{introspectionBoolType},
+				defaultValue:  ast.BooleanValue{V: true},
+			},
+		},
+		locations: []DirectiveLocation{DirectiveLocationFragmentSpread, DirectiveLocationInlineFragment},
+	}
+
+	StreamDirective = &DirectiveDefinition{
+		named:       named{"stream"},
+		description: "Directs the executor to deliver the items of this list one at a time after the rest of the result, when the `if` argument is true.",
+		arguments: []*ArgumentDescriptor{
+			{
+				named:         named{"label"},
+				schemaElement: schemaElement{description: "Identifies the delivered results."},
+				typ:           introspectionStringType,
+			},
+			{
+				named:         named{"if"},
+				schemaElement: schemaElement{description: "Streamed when true."},
+				typ:           &NotNilType{introspectionBoolType},
+				defaultValue:  ast.BooleanValue{V: true},
+			},
+			{
+				named:         named{"initialCount"},
+				schemaElement: schemaElement{description: "The number of items delivered with the rest of the result."},
+				typ:           introspectionIntType,
+				defaultValue:  ast.IntValue{V: 0},
+			},
+		},
+		locations: []DirectiveLocation{DirectiveLocationField},
+	}
+)
+
+// CostDirective assigns a cost to a field for static query cost analysis.  It is
+// added to a schema by Builder.EnableCostDirective.  See query.PreparedQuery.Cost.
+var CostDirective = &DirectiveDefinition{
+	named:       named{"cost"},
+	description: "Assigns a cost to selecting this field, used to limit the cost of queries.",
+	arguments: []*ArgumentDescriptor{
+		{
+			named:         named{"weight"},
+			schemaElement: schemaElement{description: "The cost of selecting this field."},
+			typ:           introspectionIntType,
+		},
+		{
+			named:         named{"multiplier"},
+			schemaElement: schemaElement{description: "The name of an argument of this field that limits the number of values it returns.  The cost of the selections of the field is multiplied by the value of the argument."},
+			typ:           introspectionStringType,
+		},
+	},
+	locations: []DirectiveLocation{DirectiveLocationFieldDefinition},
+}
+
+// CacheControlDirective gives a cache hint for the values of a field, or of all
+// fields returning a type.  It is added to a schema, along with
+// CacheControlScopeType, by Builder.EnableCacheControl.  See query.WithCachePolicy.
+var CacheControlDirective = &DirectiveDefinition{
+	named:       named{"cacheControl"},
+	description: "Sets how long the values of this field, or of fields returning this type, may be cached, and by whom.",
+	arguments: []*ArgumentDescriptor{
+		{
+			named:         named{"maxAge"},
+			schemaElement: schemaElement{description: "The number of seconds the value may be cached for."},
+			typ:           introspectionIntType,
+		},
+		{
+			named:         named{"scope"},
+			schemaElement: schemaElement{description: "Whether the value may be cached by shared caches, or only by the client."},
+			typ:           CacheControlScopeType,
+		},
+	},
+	locations: []DirectiveLocation{DirectiveLocationFieldDefinition, DirectiveLocationObject, DirectiveLocationInterface, DirectiveLocationUnion},
+}
+
+// CacheControlScopeType is the type of the scope argument of the @cacheControl
+// directive
+var CacheControlScopeType = &EnumType{
+	named: named{"CacheControlScope"},
+	values: map[LiteralString]*enumValueDescriptor{
+		"PUBLIC":  {named: named{"PUBLIC"}, schemaElement: schemaElement{description: "The value may be cached by shared caches."}},
+		"PRIVATE": {named: named{"PRIVATE"}, schemaElement: schemaElement{description: "The value is specific to the client, and may only be cached by it."}},
+	},
+	encode: func(ctx context.Context, v interface{}) (LiteralValue, error) {
+		if v == nil {
+			return nil, nil
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("Value is not a string")
+		}
+		return LiteralString(s), nil
+	},
+	decode: func(ctx context.Context, v LiteralValue) (interface{}, error) {
+		if v == nil {
+			return nil, nil
+		}
+		s, ok := v.(LiteralString)
+		if !ok {
+			return nil, fmt.Errorf("Value is not a string")
+		}
+		return string(s), nil
+	},
+}
+
 // DirectiveArgument represents an argument to a directive applied to a schema element
 type DirectiveArgument struct {
 	named
@@ -81,6 +81,12 @@ func (t *EnumType) Decode(ctx context.Context, v LiteralValue) (interface{}, err
 	return t.decode(ctx, v)
 }
 
+// HasValue returns whether v is one of the values of this enum
+func (t *EnumType) HasValue(v string) bool {
+	_, ok := t.values[LiteralString(v)]
+	return ok
+}
+
 // InputListCreator returns a creator for lists of this enum type
 func (t *EnumType) InputListCreator() InputListCreator {
 	return t.listCreator
@@ -57,6 +57,22 @@ func (t *InputObjectType) InputListCreator() InputListCreator {
 	return t.listCreator
 }
 
+// Field returns the named field of the input object, or nil if the field does
+// not exist
+func (t *InputObjectType) Field(name string) *InputObjectFieldDescriptor {
+	return t.fields[name]
+}
+
+// Fields returns all fields of the input object, sorted by name
+func (t *InputObjectType) Fields() []*InputObjectFieldDescriptor {
+	vals := make([]*InputObjectFieldDescriptor, 0, len(t.fields))
+	for _, v := range t.fields {
+		vals = append(vals, v)
+	}
+	sort.Stable(sortInputObjectFieldDescriptorsByName(vals))
+	return vals
+}
+
 // A InputObjectFieldDescriptor represents a field in a GraphQL input object.
 // It has a name and a type.  It must be a scalar, a reference to an input object
 // or a not-nil or list of either of these types
@@ -73,6 +89,16 @@ func (d *InputObjectFieldDescriptor) Type() Type {
 	return d.typ
 }
 
+// HasDefaultValue returns whether a default value was declared for this field
+func (d *InputObjectFieldDescriptor) HasDefaultValue() bool {
+	return d.defaultValue != nil
+}
+
+// DefaultValue returns the declared default value of this field
+func (d *InputObjectFieldDescriptor) DefaultValue() LiteralValue {
+	return literalValueFromAstValue(d.defaultValue)
+}
+
 type inputObjectDecodeContext struct {
 	t    *InputObjectType
 	root LiteralValue
@@ -43,6 +43,11 @@ func (t *InterfaceType) HasField(name string) bool {
 	return t.fields[name] != nil
 }
 
+// Field returns the named field, or nil if the interface does not define it
+func (t *InterfaceType) Field(name string) *FieldDescriptor {
+	return t.fields[name]
+}
+
 // Implementations returns the list of object types that implement this interface
 func (t *InterfaceType) Implementations() []*ObjectType {
 	return t.implementations
@@ -49,6 +49,19 @@ var introspectionBoolType = &ScalarType{
 	},
 }
 
+var introspectionIntType = &ScalarType{
+	named: named{"Int"},
+	encode: func(ctx context.Context, v interface{}) (LiteralValue, error) {
+		return LiteralNumber(v.(int)), nil
+	},
+	decode: func(ctx context.Context, v LiteralValue) (interface{}, error) {
+		if v == nil {
+			return nil, nil
+		}
+		return int(v.(LiteralNumber)), nil
+	},
+}
+
 type iTypeKind string
 
 var introspectionTypeKindType = &EnumType{
@@ -144,14 +157,20 @@ var introspectionSchemaType = &ObjectType{
 		"mutationType": {
 			named: named{"mutationType"},
 			r: SimpleResolver(func(v interface{}) (interface{}, error) {
-				return nil, nil // FUTURE: Mutations not supported
+				if mt := v.(*Schema).MutationType; mt != nil {
+					return mt, nil
+				}
+				return nil, nil
 			}),
 			typ: introspectionTypeType,
 		},
 		"subscriptionType": {
 			named: named{"subscriptionType"},
 			r: SimpleResolver(func(v interface{}) (interface{}, error) {
-				return nil, nil // FUTURE: Subscriptions not supported
+				if st := v.(*Schema).SubscriptionType; st != nil {
+					return st, nil
+				}
+				return nil, nil
 			}),
 			typ: introspectionTypeType,
 		},
@@ -182,6 +182,11 @@ func (t *ObjectType) HasInterface(name string) bool {
 	return false
 }
 
+// Interfaces returns the interfaces implemented by this type
+func (t *ObjectType) Interfaces() []*InterfaceType {
+	return t.interfaces
+}
+
 // A FieldDescriptor represents a field in a GraphQL object.  It has a name, a type,
 // and a function used to resolve the value of the field from a containing object.
 type FieldDescriptor struct {
@@ -221,6 +226,11 @@ func (d *ArgumentDescriptor) Type() Type {
 	return d.typ
 }
 
+// HasDefaultValue returns whether the argument declares a default value
+func (d *ArgumentDescriptor) HasDefaultValue() bool {
+	return d.defaultValue != nil
+}
+
 // DefaultValue returns the default value of this field
 func (d *ArgumentDescriptor) DefaultValue() LiteralValue {
 	return literalValueFromAstValue(d.defaultValue)
@@ -17,14 +17,18 @@ package schema
 import (
 	"io"
 	"sort"
+
+	"github.com/housecanary/gq/ast"
 )
 
 // A Schema represents a GraphQL schema against which queries
 // may be executed
 type Schema struct {
-	QueryType  *ObjectType
-	allTypes   map[string]Type
-	directives []*DirectiveDefinition
+	QueryType        *ObjectType
+	MutationType     *ObjectType
+	SubscriptionType *ObjectType
+	allTypes         map[string]Type
+	directives       []*DirectiveDefinition
 }
 
 // WriteDefinition writes this schema as a GraphQL schema definition
@@ -40,12 +44,27 @@ func (s *Schema) WriteDefinition(w io.Writer) error {
 	iw.write("query: ")
 	iw.write(s.QueryType.signature())
 	iw.writeNL()
+	if s.MutationType != nil {
+		iw.writeIndent()
+		iw.write("mutation: ")
+		iw.write(s.MutationType.signature())
+		iw.writeNL()
+	}
+	if s.SubscriptionType != nil {
+		iw.writeIndent()
+		iw.write("subscription: ")
+		iw.write(s.SubscriptionType.signature())
+		iw.writeNL()
+	}
 
 	dds := make([]*DirectiveDefinition, len(s.directives))
 	copy(dds, s.directives)
 
 	sort.Stable(sortDirectiveDefsByName(dds))
 	for _, e := range dds {
+		if isBuiltin(e) {
+			continue
+		}
 		iw.writeNL()
 		e.writeSchemaDefinition(iw)
 		iw.writeNL()
@@ -73,6 +92,58 @@ func (s *Schema) WriteDefinition(w io.Writer) error {
 	return ec.err
 }
 
+// Directive returns the definition of the named directive, or nil if the
+// schema does not define it
+func (s *Schema) Directive(name string) *DirectiveDefinition {
+	for _, d := range s.directives {
+		if d.name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// Type returns the named type, or nil if the schema does not contain a type
+// with that name
+func (s *Schema) Type(name string) Type {
+	if t, ok := s.allTypes[name]; ok {
+		return t
+	}
+
+	// The scalars used by introspection and the built in directives are always
+	// available, even if the schema does not otherwise refer to them.
+	switch name {
+	case introspectionStringType.name:
+		return introspectionStringType
+	case introspectionBoolType.name:
+		return introspectionBoolType
+	}
+	return nil
+}
+
+// ResolveType finds the schema type corresponding to an ast type, or nil
+// if the type does not exist
+func (s *Schema) ResolveType(typ ast.Type) Type {
+	switch t := typ.(type) {
+	case *ast.SimpleType:
+		return s.Type(t.Name)
+	case *ast.ListType:
+		if of := s.ResolveType(t.Of); of != nil {
+			return &ListType{of}
+		}
+	case *ast.NotNilType:
+		if of := s.ResolveType(t.Of); of != nil {
+			return &NotNilType{of}
+		}
+	}
+	return nil
+}
+
+// Signature returns the GraphQL representation of a type reference (i.e. [String!])
+func Signature(t Type) string {
+	return t.signature()
+}
+
 // Type is a marker interface for all types.
 type Type interface {
 	isType()
@@ -101,6 +172,15 @@ type InputableType interface {
 }
 
 func isBuiltin(v interface{}) bool {
+	if dd, ok := v.(*DirectiveDefinition); ok {
+		for _, e := range builtinDirectives {
+			if dd == e {
+				return true
+			}
+		}
+		return false
+	}
+
 	if st, ok := v.(*ScalarType); ok {
 		switch st.name {
 		case "ID":
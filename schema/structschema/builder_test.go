@@ -476,7 +476,7 @@ func Example() {
 	//       ],
 	//       "locations": [
 	//         {
-	//           "line": 21,
+	//           "line": 20,
 	//           "column": 3
 	//         }
 	//       ]
@@ -488,7 +488,7 @@ func Example() {
 	//       ],
 	//       "locations": [
 	//         {
-	//           "line": 26,
+	//           "line": 25,
 	//           "column": 3
 	//         }
 	//       ]
@@ -501,7 +501,7 @@ func Example() {
 	//       ],
 	//       "locations": [
 	//         {
-	//           "line": 35,
+	//           "line": 34,
 	//           "column": 5
 	//         }
 	//       ]
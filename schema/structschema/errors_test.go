@@ -0,0 +1,82 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structschema_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/housecanary/gq/query"
+	"github.com/housecanary/gq/schema/structschema"
+	"github.com/housecanary/gq/types"
+)
+
+type ErrorRoot struct {
+	structschema.Meta `{
+		missing: String
+		unavailable: String
+		lookup(id: LookupInput!): String
+	}`
+}
+
+func (r *ErrorRoot) ResolveMissing() (types.String, error) {
+	return types.NilString(), query.NewNotFoundError("No such thing")
+}
+
+func (r *ErrorRoot) ResolveUnavailable() (<-chan types.String, <-chan error) {
+	e := make(chan error, 1)
+	e <- query.NewUnavailableError(30*time.Second, "Try again later")
+	return make(chan types.String), e
+}
+
+func (r *ErrorRoot) ResolveLookup(id *LookupInput) types.String {
+	return id.ID
+}
+
+type LookupInput struct {
+	structschema.InputObject
+	ID types.String `gq:":String!"`
+}
+
+func (i *LookupInput) Validate() error {
+	if i.ID.String() == "" {
+		return query.NewBadUserInputError("ID must not be empty")
+	}
+	return nil
+}
+
+func TestResolverErrorExtensions(t *testing.T) {
+	builder := structschema.Builder{Types: []interface{}{&ErrorRoot{}, &LookupInput{}}}
+	s := builder.MustBuild("ErrorRoot")
+
+	for _, c := range []struct {
+		query    string
+		expected string
+	}{
+		{`{missing}`, `{"data":{"missing":null},"errors":[{"message":"No such thing","path":["missing"],"locations":[{"line":1,"column":2}],"extensions":{"code":"NOT_FOUND"}}]}`},
+		{`{unavailable}`, `{"data":{"unavailable":null},"errors":[{"message":"Try again later","path":["unavailable"],"locations":[{"line":1,"column":2}],"extensions":{"code":"SERVICE_UNAVAILABLE","retryAfter":30}}]}`},
+		{`{lookup(id: {id: ""})}`, `{"data":{"lookup":null},"errors":[{"message":"Error resolving argument id: Error in argument id: ID must not be empty","path":["lookup"],"locations":[{"line":1,"column":2}],"extensions":{"code":"BAD_USER_INPUT"}}]}`},
+	} {
+		q, err := query.PrepareQuery(c.query, "", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := string(q.Execute(context.Background(), &ErrorRoot{}, nil, nil))
+		if result != c.expected {
+			t.Errorf("Expected result\n%s\ngot\n%s", c.expected, result)
+		}
+	}
+}
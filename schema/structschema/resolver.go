@@ -175,7 +175,7 @@ func (m *fieldMeta) buildMethodResolver(b *Builder, structTyp reflect.Type, name
 			rc := ctx.(schema.ResolverContext)
 			v, err := rc.GetArgumentValue(argName)
 			if err != nil {
-				return reflect.ValueOf(nil), fmt.Errorf("Error resolving argument %s: %v", argName, err)
+				return reflect.ValueOf(nil), fmt.Errorf("Error resolving argument %s: %w", argName, err)
 			}
 
 			if v == nil {
@@ -324,7 +324,20 @@ type chanAsyncValue struct {
 }
 
 func (v *chanAsyncValue) Await(ctx context.Context) (interface{}, error) {
-	rv, ok := v.c.Recv()
+	var rv reflect.Value
+	var ok bool
+	if done := contextDone(ctx); done.IsValid() {
+		var chosen int
+		chosen, rv, ok = reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: v.c},
+			{Dir: reflect.SelectRecv, Chan: done},
+		})
+		if chosen == 1 {
+			return nil, ctx.Err()
+		}
+	} else {
+		rv, ok = v.c.Recv()
+	}
 	if !ok {
 		return nil, fmt.Errorf("Channel receive failed, closed prematurely")
 	}
@@ -343,7 +356,7 @@ type chanErrorAsyncValue struct {
 }
 
 func (v *chanErrorAsyncValue) Await(ctx context.Context) (interface{}, error) {
-	chosen, rv, ok := reflect.Select([]reflect.SelectCase{
+	cases := []reflect.SelectCase{
 		reflect.SelectCase{
 			Dir:  reflect.SelectRecv,
 			Chan: v.c,
@@ -352,7 +365,11 @@ func (v *chanErrorAsyncValue) Await(ctx context.Context) (interface{}, error) {
 			Dir:  reflect.SelectRecv,
 			Chan: v.e,
 		},
-	})
+	}
+	if done := contextDone(ctx); done.IsValid() {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: done})
+	}
+	chosen, rv, ok := reflect.Select(cases)
 
 	switch chosen {
 	case 0:
@@ -376,12 +393,27 @@ func (v *chanErrorAsyncValue) Await(ctx context.Context) (interface{}, error) {
 			return fixNil(resultValue), nil
 		}
 		return nil, fixNilE(rv)
+	case 2:
+		return nil, ctx.Err()
 	}
 
 	// Unreachable code
 	panic("Invalid selection")
 }
 
+// contextDone returns the Done channel of ctx, or an invalid value if ctx can
+// never be done
+func contextDone(ctx context.Context) reflect.Value {
+	if ctx == nil {
+		return reflect.Value{}
+	}
+	done := ctx.Done()
+	if done == nil {
+		return reflect.Value{}
+	}
+	return reflect.ValueOf(done)
+}
+
 type resultHandler func(ctx context.Context, result ...reflect.Value) (interface{}, error)
 
 func fixNil(v reflect.Value) interface{} {
@@ -0,0 +1,38 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package structschema
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestChanAsyncValueCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	values := []interface {
+		Await(context.Context) (interface{}, error)
+	}{
+		&chanAsyncValue{c: reflect.ValueOf(make(chan string))},
+		&chanErrorAsyncValue{c: reflect.ValueOf(make(chan string)), e: reflect.ValueOf(make(chan error))},
+	}
+	for _, v := range values {
+		if _, err := v.Await(ctx); err != context.Canceled {
+			t.Errorf("Expected %T to stop waiting when the context is cancelled, got %v", v, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"context"
+)
+
+// A SourceStream is the value returned by the resolver of a subscription
+// root field.  Each event read from the stream is used as the value the
+// selection set of the subscription field is executed against.
+type SourceStream interface {
+	// Next blocks until the next event is available.  When the stream is
+	// exhausted ok is false.
+	Next(ctx context.Context) (event interface{}, ok bool, err error)
+}
+
+// ChanSourceStream adapts a channel to a SourceStream.  The stream ends when
+// the channel is closed.
+type ChanSourceStream <-chan interface{}
+
+// Next implements SourceStream
+func (s ChanSourceStream) Next(ctx context.Context) (interface{}, bool, error) {
+	select {
+	case v, ok := <-s:
+		return v, ok, nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
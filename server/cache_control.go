@@ -0,0 +1,68 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/query"
+)
+
+// withCachePolicy returns opts with an option that sets the Cache-Control header of
+// the response to the cache policy of the result of q.  Only the results of queries
+// are cacheable, so opts is returned unchanged for other operations.
+func withCachePolicy(opts []query.ExecutionOption, q *query.PreparedQuery, responseHeaders http.Header) []query.ExecutionOption {
+	if q.OperationType() != ast.OperationTypeQuery {
+		return opts
+	}
+	return append(opts[:len(opts):len(opts)], query.WithCachePolicy(func(p query.CachePolicy) {
+		responseHeaders.Set("Cache-Control", p.Header())
+	}))
+}
+
+// A batchCachePolicy combines the cache policies of the results of a batch
+type batchCachePolicy struct {
+	policy   query.CachePolicy
+	reported int
+}
+
+// options returns opts with an option that records the cache policy of each
+// result of the batch
+func (b *batchCachePolicy) options(opts []query.ExecutionOption) []query.ExecutionOption {
+	return append(opts[:len(opts):len(opts)], query.WithCachePolicy(func(p query.CachePolicy) {
+		if b.reported == 0 {
+			b.policy = p
+		} else {
+			b.policy = b.policy.Restrict(p)
+		}
+		b.reported++
+	}))
+}
+
+// cacheableBatch returns whether the response to a batch of requests can be cached:
+// every request must be a query that was executed, since the errors of requests
+// that were not are not cacheable
+func cacheableBatch(requests int, items []batchQueryItem) bool {
+	if len(items) != requests {
+		return false
+	}
+	for _, item := range items {
+		if item.query.OperationType() != ast.OperationTypeQuery {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/housecanary/gq/internal/pkg/testschema"
+	"github.com/housecanary/gq/query"
+	"github.com/housecanary/gq/schema"
+)
+
+func TestMaxCost(t *testing.T) {
+	h := NewGraphQLHandler(testschema.New(nil), &GraphQLHandlerConfig{
+		RootObject: struct{}{},
+		MaxCost:    5,
+		CostOptions: []query.CostOption{query.WithCostFunc(func(field *schema.FieldDescriptor, args map[string]schema.LiteralValue) (query.FieldCost, bool) {
+			return query.FieldCost{Weight: 3}, field.Name() == "hello"
+		})},
+	})
+
+	for _, c := range []struct {
+		body     string
+		expected string
+	}{
+		{`{"query":"{hello}"}`, `{"data":{"hello":"Hello World"}}`},
+		{`{"query":"{a: hello b: hello}"}`, `{"errors":[{"message":"Query cost 6 exceeds the maximum cost of 5","extensions":{"code":"QUERY_TOO_EXPENSIVE","cost":6,"maxCost":5}}]}`},
+		{`[{"query":"{hello}"},{"query":"{a: hello b: hello}"}]`, `[{"data":{"hello":"Hello World"}},{"errors":[{"message":"Query cost 6 exceeds the maximum cost of 5","extensions":{"code":"QUERY_TOO_EXPENSIVE","cost":6,"maxCost":5}}]}]`},
+	} {
+		w := serve(h, "POST", "/", c.body)
+		if w.Body.String() != c.expected {
+			t.Errorf("Expected response to %s\n%s\ngot\n%s", c.body, c.expected, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/internal/pkg/testschema"
+	"github.com/housecanary/gq/query"
+)
+
+func TestErrorPresenter(t *testing.T) {
+	var contexts []context.Context
+	h := NewGraphQLHandler(testschema.New(nil), &GraphQLHandlerConfig{
+		RootObject: struct{}{},
+		ErrorPresenter: func(ctx context.Context, err error, path []interface{}, field *ast.Field) error {
+			contexts = append(contexts, ctx)
+			var qe *query.QueryError
+			if errors.As(err, &qe) {
+				return nil
+			}
+			return query.NewInternalError(err)
+		},
+	})
+
+	for _, c := range []struct {
+		body     string
+		expected string
+	}{
+		{`{"query":"{fail}"}`, `{"data":{"fail":null},"errors":[{"message":"Internal server error","path":["fail"],"locations":[{"line":1,"column":2}],"extensions":{"code":"INTERNAL_SERVER_ERROR"}}]}`},
+		{`{"query":"{nope}"}`, `{"errors":[{"message":"Cannot query field \"nope\" on type \"Query\"","locations":[{"line":1,"column":2}],"extensions":{"code":"GRAPHQL_VALIDATION_FAILED","rule":"FieldsOnCorrectType"}}]}`},
+		{`{"query":"{hello}","variables":"bad"}`, `{"errors":[{"message":"Internal server error","extensions":{"code":"INTERNAL_SERVER_ERROR"}}]}`},
+	} {
+		contexts = nil
+		w := serve(h, "POST", "/", c.body)
+		if w.Body.String() != c.expected {
+			t.Errorf("Expected response to %s\n%s\ngot\n%s", c.body, c.expected, w.Body.String())
+		}
+		if len(contexts) != 1 || contexts[0] == nil {
+			t.Errorf("Expected the presenter to be called once with a context for %s, got %v", c.body, contexts)
+		}
+	}
+}
@@ -18,14 +18,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	jsoniter "github.com/json-iterator/go"
 
+	"github.com/housecanary/gq/apollotracing"
 	"github.com/housecanary/gq/query"
 	"github.com/housecanary/gq/schema"
 )
@@ -33,19 +36,41 @@ import (
 // A QueryBuilder is used to transform a query text and operation name into a PreparedQuery.
 //
 // The default implementation recompiles the query each request, a production configuration should
-// use some sort of cache to reuse previously compiled queries
+// use some sort of cache to reuse previously compiled queries, such as QueryCache
 type QueryBuilder func(schema *schema.Schema, text string, operationName string) (*query.PreparedQuery, error)
 
-// DefaultQueryBuilder is a simple QueryBuilder that recompiles the query each request.
+// DefaultPrepareOptions are the limits on the shape of queries enforced by
+// DefaultQueryBuilder.  They are generous enough for any reasonable query, including
+// the introspection queries of common tools, while keeping the time spent validating
+// any query in the order of milliseconds.
+var DefaultPrepareOptions = query.PrepareOptions{
+	MaxDepth:             32,
+	MaxFields:            1000,
+	MaxAliases:           100,
+	MaxFragmentExpansion: 5000,
+	MaxDirectives:        100,
+}
+
+// DefaultQueryBuilder is a simple QueryBuilder that recompiles the query each request,
+// enforcing DefaultPrepareOptions.
 var DefaultQueryBuilder QueryBuilder = func(schema *schema.Schema, text string, operationName string) (*query.PreparedQuery, error) {
-	return query.PrepareQuery(text, operationName, schema)
+	return query.PrepareQueryWithOptions(text, operationName, schema, DefaultPrepareOptions)
+}
+
+// NewQueryBuilder creates a QueryBuilder that recompiles the query each request,
+// enforcing the given limits on the shape of queries.
+func NewQueryBuilder(options query.PrepareOptions) QueryBuilder {
+	return func(schema *schema.Schema, text string, operationName string) (*query.PreparedQuery, error) {
+		return query.PrepareQueryWithOptions(text, operationName, schema, options)
+	}
 }
 
 // A QueryExecutor runs a prepared query. Implementations of this may add variables to the context,
 // set up callbacks, and set up tracing. This method is deprecated, use a QueryExecutionWrapper instead
 type QueryExecutor func(q *query.PreparedQuery, req *http.Request, vars query.Variables, responseHeaders http.Header) []byte
 
-// QueryInfo supplies information about the queries being executed to a QueryExecutionWrapper
+// QueryInfo supplies information about the queries being executed to a QueryExecutionWrapper.  The
+// metadata accessors of query.PreparedQuery describe each query, e.g. for logging or authorization.
 type QueryInfo interface {
 	GetNQueries() int
 	GetQuery(n int) *query.PreparedQuery
@@ -55,8 +80,15 @@ type QueryInfo interface {
 
 // A QueryExecutionWrapper wraps execution of a query or batch of queries. Implementations of this may add variables to the context,
 // set up callbacks, and set up tracing.
+//
+// Responses are written once the wrapper returns, so it may set response headers after proceed returns, except for
+// incremental delivery: its payloads are streamed to the client while proceed runs.  If proceed is passed a nil context,
+// the context of the request is used.
 type QueryExecutionWrapper func(queryInfo QueryInfo, req *http.Request, responseHeaders http.Header, proceed func(context.Context, query.ExecutionListener))
 
+// A queryStreamer runs a prepared query, writing the results to the response
+type queryStreamer func(q *query.PreparedQuery, req *http.Request, vars query.Variables, w http.ResponseWriter)
+
 // A RootObjectProvider is used to create root objects for queries
 type RootObjectProvider func(req *http.Request) interface{}
 
@@ -70,10 +102,20 @@ type GraphQLHandler struct {
 	schema             *schema.Schema
 	queryBuilder       QueryBuilder
 	queryExecutor      QueryExecutor
+	queryStreamer      queryStreamer
 	executionWrapper   QueryExecutionWrapper
 	rootObjectProvider RootObjectProvider
 	maxRequestBodySize int64
 	disableGraphiQL    bool
+	apolloTracing      bool
+	executionOptions   []query.ExecutionOption
+	maxCost            int
+	costOptions        []query.CostOption
+	executionTimeout   time.Duration
+	explain            bool
+	persistedQueries   PersistedQueryStore
+	cacheControl       bool
+	errorPresenter     query.ErrorPresenter
 }
 
 // A GraphQLHandlerConfig supplies configuration parameters to NewGraphQLHandler
@@ -81,6 +123,10 @@ type GraphQLHandlerConfig struct {
 	// Callback to build queries.  Can be used to implement query caching or additional validation.
 	QueryBuilder QueryBuilder
 
+	// Limits on the shape of queries, used when QueryBuilder is not set.  If nil,
+	// DefaultQueryBuilder is used, enforcing DefaultPrepareOptions.
+	PrepareOptions *query.PrepareOptions
+
 	// Callback to execute queries.  Can be used to inject request specific items (loggers, listeners, context variables, etc),
 	// as well as for logging
 	QueryExecutor QueryExecutor
@@ -101,13 +147,70 @@ type GraphQLHandlerConfig struct {
 	// Max size of request body.  If -1, no limit.  Server will respond with 413
 	// if the size is exceeded
 	MaxRequestBodySize int64
+
+	// Callback to convert errors before they are sent to the client.  Can be used to mask
+	// internal error messages (including those of recovered panics) or to add extensions.
+	// Errors raised before execution, such as invalid queries, are also converted; they
+	// have no path or field.
+	ErrorPresenter query.ErrorPresenter
+
+	// Maximum cost of a query, as computed by query.PreparedQuery.Cost.  Queries that
+	// cost more are rejected with a QUERY_TOO_EXPENSIVE error.  If 0, there is no limit.
+	MaxCost int
+
+	// Options used to compute the cost of queries when MaxCost is set
+	CostOptions []query.CostOption
+
+	// If positive, async values are awaited concurrently on up to this many goroutines
+	// per request.  See query.WithConcurrentAwaits.
+	MaxConcurrentAwaits int
+
+	// If set, responses to single (not batched) requests include the time spent resolving
+	// each field, in the Apollo tracing format.  See package apollotracing.
+	ApolloTracing bool
+
+	// Maximum time to spend executing a query or batch of queries.  Fields that are
+	// not resolved in time are reported with a TIMEOUT error, and the partial result
+	// is returned.  If 0, execution is only limited by the context of the request.
+	ExecutionTimeout time.Duration
+
+	// If set, single (not batched) requests with an explain URL parameter are not
+	// executed.  The response instead holds the execution plan of the query (see
+	// query.PreparedQuery.Explain) as the explain entry of its extensions.  This is
+	// meant for debugging, and should not be enabled for untrusted clients.
+	EnableExplain bool
+
+	// If set, requests may use the Apollo persistedQuery extension to send the SHA-256
+	// hash of a query in place of its text.  Queries are registered in the store when
+	// a request sends both the text and its hash.  See NewLRUPersistedQueryStore.
+	PersistedQueryStore PersistedQueryStore
+
+	// If set, responses to queries have a Cache-Control header matching the cache
+	// policy computed from the @cacheControl hints of the resolved fields (see
+	// query.WithCachePolicy and schema.Builder.EnableCacheControl).  Responses with
+	// errors are not cacheable.  A batch is only cacheable if all its requests are
+	// queries, and its policy combines theirs.  Responses to requests accepting
+	// multipart/mixed, and those produced by a custom QueryExecutor, have no header.
+	CacheControl bool
+
+	// The maxAge, in seconds, of root fields and fields returning composite types
+	// that have no @cacheControl hint.  See query.WithDefaultMaxAge.
+	DefaultMaxAge int
+
+	// If set, responses include the cache hints of the resolved fields as the
+	// cacheControl entry of their extensions.  See query.WithCacheControlExtension.
+	CacheControlExtension bool
 }
 
 // NewGraphQLHandler creates a new GraphQLHandler with the specified configuration
 func NewGraphQLHandler(s *schema.Schema, config *GraphQLHandlerConfig) *GraphQLHandler {
 	qb := config.QueryBuilder
 	if qb == nil {
-		qb = DefaultQueryBuilder
+		if config.PrepareOptions != nil {
+			qb = NewQueryBuilder(*config.PrepareOptions)
+		} else {
+			qb = DefaultQueryBuilder
+		}
 	}
 
 	rop := config.RootObjectProvider
@@ -117,21 +220,75 @@ func NewGraphQLHandler(s *schema.Schema, config *GraphQLHandlerConfig) *GraphQLH
 		}
 	}
 
+	var executionOptions []query.ExecutionOption
+	if config.ErrorPresenter != nil {
+		executionOptions = append(executionOptions, query.WithErrorPresenter(config.ErrorPresenter))
+	}
+	if config.MaxConcurrentAwaits > 0 {
+		executionOptions = append(executionOptions, query.WithConcurrentAwaits(config.MaxConcurrentAwaits))
+	}
+	if config.DefaultMaxAge > 0 {
+		executionOptions = append(executionOptions, query.WithDefaultMaxAge(config.DefaultMaxAge))
+	}
+	if config.CacheControlExtension {
+		executionOptions = append(executionOptions, query.WithCacheControlExtension())
+	}
+
+	var qs queryStreamer
 	qe := config.QueryExecutor
 	if qe == nil {
 		execWrapper := config.QueryExecutionWrapper
-		qe = func(q *query.PreparedQuery, req *http.Request, vars query.Variables, responseHeaders http.Header) []byte {
+		execute := func(q *query.PreparedQuery, req *http.Request, vars query.Variables, responseHeaders http.Header, run func(context.Context, interface{}, query.ExecutionListener)) {
+			if config.ApolloTracing {
+				traced := run
+				run = func(ctx context.Context, root interface{}, ql query.ExecutionListener) {
+					tracer := apollotracing.New(requestStart(req), ql)
+					tracer.TracePrepare(q)
+					traced(ctx, root, tracer)
+				}
+			}
 			root := rop(req)
-			var result []byte
 			if execWrapper != nil {
 				execWrapper(singleQueryInfo{q, vars, root}, req, responseHeaders, func(ctx context.Context, ql query.ExecutionListener) {
-					result = q.Execute(ctx, root, vars, ql)
+					ctx, cancel := executionContext(ctx, req, config.ExecutionTimeout)
+					defer cancel()
+					run(ctx, root, ql)
 				})
 			} else {
-				result = q.Execute(nil, root, vars, nil)
+				ctx, cancel := executionContext(nil, req, config.ExecutionTimeout)
+				defer cancel()
+				run(ctx, root, nil)
 			}
+		}
+		qe = func(q *query.PreparedQuery, req *http.Request, vars query.Variables, responseHeaders http.Header) []byte {
+			opts := executionOptions
+			if config.CacheControl {
+				opts = withCachePolicy(opts, q, responseHeaders)
+			}
+			var result []byte
+			execute(q, req, vars, responseHeaders, func(ctx context.Context, root interface{}, ql query.ExecutionListener) {
+				result = q.Execute(ctx, root, vars, ql, opts...)
+			})
 			return result
 		}
+		qs = func(q *query.PreparedQuery, req *http.Request, vars query.Variables, w http.ResponseWriter) {
+			execute(q, req, vars, w.Header(), func(ctx context.Context, root interface{}, ql query.ExecutionListener) {
+				if acceptsMultipart(req) {
+					initial, patches := q.ExecuteIncremental(ctx, root, vars, ql, executionOptions...)
+					writeIncremental(w, initial, patches)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json;charset=utf-8")
+				opts := executionOptions
+				if config.CacheControl {
+					// The policy is reported before any output is written, so
+					// the header can still be set
+					opts = withCachePolicy(opts, q, w.Header())
+				}
+				// A failed write is a network error; there is no one left to report it to
+				q.ExecuteTo(ctx, w, root, vars, ql, opts...)
+			})
+		}
 	}
 
 	maxRequestBodySize := config.MaxRequestBodySize
@@ -143,14 +300,27 @@ func NewGraphQLHandler(s *schema.Schema, config *GraphQLHandlerConfig) *GraphQLH
 		schema:             s,
 		queryBuilder:       qb,
 		queryExecutor:      qe,
+		queryStreamer:      qs,
 		executionWrapper:   config.QueryExecutionWrapper,
 		rootObjectProvider: rop,
 		maxRequestBodySize: maxRequestBodySize,
 		disableGraphiQL:    config.DisableGraphiQL,
+		apolloTracing:      config.ApolloTracing,
+		executionOptions:   executionOptions,
+		maxCost:            config.MaxCost,
+		costOptions:        config.CostOptions,
+		executionTimeout:   config.ExecutionTimeout,
+		explain:            config.EnableExplain,
+		persistedQueries:   config.PersistedQueryStore,
+		cacheControl:       config.CacheControl,
+		errorPresenter:     config.ErrorPresenter,
 	}
 }
 
 func (h *GraphQLHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h.apolloTracing {
+		req = req.WithContext(context.WithValue(req.Context(), requestStartKey{}, time.Now()))
+	}
 	qs := req.URL.Query()
 	switch req.Method {
 	case http.MethodGet:
@@ -158,6 +328,12 @@ func (h *GraphQLHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		msg.Query = qs.Get("query")
 		msg.OperationName = qs.Get("operationName")
 		msg.Variables = json.RawMessage(qs.Get("variables"))
+		if extensions := qs.Get("extensions"); extensions != "" {
+			if err := json.Unmarshal([]byte(extensions), &msg.Extensions); err != nil {
+				h.writeError(http.StatusBadRequest, fmt.Sprintf("Bad request: %v", err), w)
+				return
+			}
+		}
 		h.executeSingle(w, req, &msg)
 	case http.MethodPost:
 		body := req.Body
@@ -166,8 +342,9 @@ func (h *GraphQLHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			defer body.Close()
 			var data []byte
 			if h.maxRequestBodySize != -1 {
-				limitReader := &io.LimitedReader{R: body, N: h.maxRequestBodySize}
-				data, err = ioutil.ReadAll(body)
+				// Read one byte more than the limit to detect larger bodies
+				limitReader := &io.LimitedReader{R: body, N: h.maxRequestBodySize + 1}
+				data, err = ioutil.ReadAll(limitReader)
 				if limitReader.N <= 0 {
 					h.writeError(http.StatusRequestEntityTooLarge, "Request body too large", w)
 					return
@@ -231,17 +408,78 @@ func (h *GraphQLHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func serializeError(err error) []byte {
-	errObj := make(map[string]interface{})
-	errObj["message"] = err.Error()
+type serializedErrorLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type serializedError struct {
+	Message    string                    `json:"message"`
+	Locations  []serializedErrorLocation `json:"locations,omitempty"`
+	Path       []string                  `json:"path,omitempty"`
+	Extensions map[string]interface{}    `json:"extensions,omitempty"`
+}
+
+// serializeError renders an error preparing a query as a GraphQL response.  If the
+// error is a query.QueryErrors, each problem is reported with its locations and extensions.
+// Errors are converted by the ErrorPresenter, if any, before they are rendered.
+func (h *GraphQLHandler) serializeError(req *http.Request, err error) []byte {
+	var errs []serializedError
+	if queryErrs, ok := err.(query.QueryErrors); ok {
+		errs = make([]serializedError, len(queryErrs))
+		for i, qe := range queryErrs {
+			errs[i] = newSerializedError(h.presentError(req, qe))
+		}
+	} else {
+		errs = []serializedError{newSerializedError(h.presentError(req, err))}
+	}
+
+	b, _ := json.Marshal(struct {
+		Errors []serializedError `json:"errors"`
+	}{
+		Errors: errs,
+	})
+
+	return b
+}
+
+// presentError converts an error raised before execution began with the
+// ErrorPresenter, if any
+func (h *GraphQLHandler) presentError(req *http.Request, err error) error {
+	if h.errorPresenter == nil {
+		return err
+	}
+	if presented := h.errorPresenter(req.Context(), err, nil, nil); presented != nil {
+		return presented
+	}
+	return err
+}
+
+// newSerializedError renders a single error.  A query.QueryError is reported with
+// its locations and path.
+func newSerializedError(err error) serializedError {
+	if qe, ok := err.(*query.QueryError); ok {
+		se := serializedError{Message: qe.Message, Path: qe.Path, Extensions: qe.Extensions()}
+		for _, l := range qe.Locations {
+			se.Locations = append(se.Locations, serializedErrorLocation{l.Line, l.Column})
+		}
+		return se
+	}
+
+	se := serializedError{Message: err.Error()}
+	var ee query.ExtendedError
+	if errors.As(err, &ee) {
+		se.Extensions = ee.Extensions()
+	}
+	return se
+}
+
+// serializeExplain renders the execution plan of a query as a GraphQL response
+func serializeExplain(q *query.PreparedQuery) []byte {
 	b, _ := json.Marshal(struct {
-		Errors []interface{} `json:"errors"`
+		Extensions map[string]interface{} `json:"extensions"`
 	}{
-		Errors: []interface{}{
-			struct {
-				Message string `json:"message"`
-			}{Message: err.Error()},
-		},
+		Extensions: map[string]interface{}{"explain": q.Explain()},
 	})
 
 	return b
@@ -256,6 +494,10 @@ func (h *GraphQLHandler) writeError(statusCode int, msg string, w http.ResponseW
 }
 
 func (h *GraphQLHandler) executeSingle(w http.ResponseWriter, req *http.Request, request *graphQLRequest) {
+	if err := h.resolvePersistedQuery(req, request); err != nil {
+		h.writeSingleRequestResult(w, req, request, h.serializeError(req, err))
+		return
+	}
 	if request.Query == "" {
 		h.writeSingleRequestResult(w, req, request, []byte(""))
 		return
@@ -263,12 +505,28 @@ func (h *GraphQLHandler) executeSingle(w http.ResponseWriter, req *http.Request,
 
 	vars, err := query.NewVariablesFromJSON(request.Variables)
 	if err != nil {
-		h.writeSingleRequestResult(w, req, request, serializeError(err))
+		h.writeSingleRequestResult(w, req, request, h.serializeError(req, err))
 		return
 	}
 	q, err := h.queryBuilder(h.schema, request.Query, request.OperationName)
 	if err != nil {
-		h.writeSingleRequestResult(w, req, request, serializeError(err))
+		h.writeSingleRequestResult(w, req, request, h.serializeError(req, err))
+		return
+	}
+	h.persistQuery(req, request)
+	if h.explain && hasParam(req, "explain") {
+		h.writeSingleRequestResult(w, req, request, serializeExplain(q))
+		return
+	}
+	if err := h.checkCost(q, vars); err != nil {
+		h.writeSingleRequestResult(w, req, request, h.serializeError(req, err))
+		return
+	}
+
+	// A wrapper may set headers after proceed returns, so its results are
+	// buffered, except for incremental delivery which must stream
+	if h.queryStreamer != nil && !h.isPretty(req) && (h.executionWrapper == nil || acceptsMultipart(req)) {
+		h.queryStreamer(q, req, vars, w)
 		return
 	}
 
@@ -280,14 +538,23 @@ func (h *GraphQLHandler) executeBatch(w http.ResponseWriter, req *http.Request,
 	results := make([][]byte, len(requests))
 	toExecute := make([]batchQueryItem, 0, len(requests))
 	for i, request := range requests {
+		if err := h.resolvePersistedQuery(req, request); err != nil {
+			results[i] = h.serializeError(req, err)
+			continue
+		}
 		vars, err := query.NewVariablesFromJSON(request.Variables)
 		if err != nil {
-			results[i] = serializeError(err)
+			results[i] = h.serializeError(req, err)
 			continue
 		}
 		q, err := h.queryBuilder(h.schema, request.Query, request.OperationName)
 		if err != nil {
-			results[i] = serializeError(err)
+			results[i] = h.serializeError(req, err)
+			continue
+		}
+		h.persistQuery(req, request)
+		if err := h.checkCost(q, vars); err != nil {
+			results[i] = h.serializeError(req, err)
 			continue
 		}
 		toExecute = append(toExecute, batchQueryItem{
@@ -303,13 +570,27 @@ func (h *GraphQLHandler) executeBatch(w http.ResponseWriter, req *http.Request,
 		batch.Add(q.query, q.rootObject, q.vars)
 	}
 
+	opts := h.executionOptions
+	var cachePolicy *batchCachePolicy
+	if h.cacheControl && len(toExecute) > 0 && cacheableBatch(len(requests), toExecute) {
+		cachePolicy = &batchCachePolicy{}
+		opts = cachePolicy.options(opts)
+	}
+
 	var batchResults [][]byte
 	if h.executionWrapper != nil {
 		h.executionWrapper(batchQueryInfo(toExecute), req, w.Header(), func(ctx context.Context, ql query.ExecutionListener) {
-			batchResults = batch.Execute(ctx, ql)
+			ctx, cancel := executionContext(ctx, req, h.executionTimeout)
+			defer cancel()
+			batchResults = batch.Execute(ctx, ql, opts...)
 		})
 	} else {
-		batchResults = batch.Execute(nil, nil)
+		ctx, cancel := executionContext(nil, req, h.executionTimeout)
+		defer cancel()
+		batchResults = batch.Execute(ctx, nil, opts...)
+	}
+	if cachePolicy != nil && cachePolicy.reported == len(toExecute) {
+		w.Header().Set("Cache-Control", cachePolicy.policy.Header())
 	}
 
 	for i, qi := range toExecute {
@@ -327,16 +608,58 @@ func (h *GraphQLHandler) executeBatch(w http.ResponseWriter, req *http.Request,
 	w.Write(endArray)
 }
 
-func (h *GraphQLHandler) writeSingleRequestResult(w http.ResponseWriter, req *http.Request, gqlRequest *graphQLRequest, body []byte) {
-	isGraphiQL := !h.disableGraphiQL &&
+type requestStartKey struct{}
+
+// requestStart returns the time at which the handler received req, if recorded
+func requestStart(req *http.Request) time.Time {
+	start, _ := req.Context().Value(requestStartKey{}).(time.Time)
+	return start
+}
+
+// executionContext returns the context to execute the queries of req with.  This is
+// ctx (or the context of req if ctx is nil) limited by timeout, if positive.
+func executionContext(ctx context.Context, req *http.Request, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = req.Context()
+	}
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func() {}
+}
+
+// checkCost returns an error if the cost of running q with vars exceeds the maximum
+// cost.  Invalid variables are not reported here, they are reported by executing
+// the query.
+func (h *GraphQLHandler) checkCost(q *query.PreparedQuery, vars query.Variables) error {
+	if h.maxCost <= 0 {
+		return nil
+	}
+	cost, err := q.Cost(vars, h.costOptions...)
+	if err != nil || cost <= h.maxCost {
+		return nil
+	}
+	return query.NewCostLimitError(cost, h.maxCost)
+}
+
+// isGraphiQL returns whether the result of req should be presented in GraphiQL
+func (h *GraphQLHandler) isGraphiQL(req *http.Request) bool {
+	return !h.disableGraphiQL &&
 		req.Method == http.MethodGet &&
 		!hasParam(req, "raw") &&
 		(strings.Contains(req.Header.Get("Accept"), "text/html") ||
 			strings.Contains(req.Header.Get("Accept"), "*/*"))
+}
+
+// isPretty returns whether the result of req should be indented
+func (h *GraphQLHandler) isPretty(req *http.Request) bool {
+	return h.isGraphiQL(req) || hasParam(req, "pretty")
+}
 
-	isPretty := isGraphiQL || hasParam(req, "pretty")
+func (h *GraphQLHandler) writeSingleRequestResult(w http.ResponseWriter, req *http.Request, gqlRequest *graphQLRequest, body []byte) {
+	isGraphiQL := h.isGraphiQL(req)
 
-	if isPretty {
+	if h.isPretty(req) {
 		buf := &bytes.Buffer{}
 		err := json.Indent(buf, []byte(body), "", "  ")
 		if err == nil { // if the response cannot be prettified, just use the unprettied version
@@ -359,6 +682,39 @@ func (h *GraphQLHandler) writeSingleRequestResult(w http.ResponseWriter, req *ht
 	}
 }
 
+// acceptsMultipart returns whether the client accepts incrementally delivered results
+func acceptsMultipart(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "multipart/mixed")
+}
+
+// writeIncremental writes the payloads of an incrementally executed query.  If no
+// work was deferred, the initial payload is written as a normal response, otherwise
+// each payload is written as a part of a multipart/mixed response, flushed as soon as
+// it is available.
+func writeIncremental(w http.ResponseWriter, initial []byte, patches <-chan []byte) {
+	if patches == nil {
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		w.Write(initial)
+		return
+	}
+
+	w.Header().Set("Content-Type", `multipart/mixed; boundary="-"`)
+	flusher, _ := w.(http.Flusher)
+	writePart := func(payload []byte) {
+		w.Write(partHeader)
+		w.Write(payload)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	writePart(initial)
+	for patch := range patches {
+		writePart(patch)
+	}
+	w.Write(multipartEnd)
+}
+
 func hasParam(req *http.Request, name string) bool {
 	_, ok := req.URL.Query()[name]
 	return ok
@@ -369,8 +725,13 @@ type graphQLRequest struct {
 	Variables     json.RawMessage `json:"variables"`
 	OperationName string          `json:"operationName"`
 	Extensions    struct {
-		VariablesList []json.RawMessage `json:"variablesList"`
+		VariablesList  []json.RawMessage        `json:"variablesList"`
+		PersistedQuery *persistedQueryExtension `json:"persistedQuery"`
 	}
+
+	// persist is set if the query should be stored in the PersistedQueryStore once
+	// it has been prepared
+	persist bool
 }
 
 type graphQLBatchRequest struct {
@@ -386,6 +747,7 @@ func (r *graphQLRequest) splitVariablesList() []*graphQLRequest {
 			Variables:     v,
 			OperationName: r.OperationName,
 		}
+		result[i].Extensions.PersistedQuery = r.Extensions.PersistedQuery
 	}
 	return result
 }
@@ -393,6 +755,8 @@ func (r *graphQLRequest) splitVariablesList() []*graphQLRequest {
 var startArray = []byte("[")
 var endArray = []byte("]")
 var comma = []byte(",")
+var partHeader = []byte("\r\n---\r\nContent-Type: application/json; charset=utf-8\r\n\r\n")
+var multipartEnd = []byte("\r\n-----\r\n")
 
 type batchQueryItem struct {
 	query       *query.PreparedQuery
@@ -0,0 +1,44 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/housecanary/gq/internal/pkg/testschema"
+	"github.com/housecanary/gq/query"
+)
+
+func TestExecutionWrapperHeaders(t *testing.T) {
+	h := NewGraphQLHandler(testschema.New(nil), &GraphQLHandlerConfig{
+		RootObject: struct{}{},
+		QueryExecutionWrapper: func(queryInfo QueryInfo, req *http.Request, responseHeaders http.Header, proceed func(context.Context, query.ExecutionListener)) {
+			proceed(nil, nil)
+			responseHeaders.Set("X-Executed", "true")
+		},
+	})
+
+	for _, body := range []string{`{"query":"{hello}"}`, `[{"query":"{hello}"}]`} {
+		w := serve(h, "POST", "/", body)
+		if actual := w.Result().Header.Get("X-Executed"); actual != "true" {
+			t.Errorf("Expected header set after proceed for %s, got %q", body, actual)
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200 for %s, got %d: %s", body, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/housecanary/gq/internal/pkg/testschema"
+)
+
+// A flushCountingRecorder counts the calls to Flush
+type flushCountingRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *flushCountingRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+func TestMultipartResponse(t *testing.T) {
+	h := NewGraphQLHandler(testschema.New(nil), &GraphQLHandlerConfig{RootObject: struct{}{}})
+
+	req := newTestRequest("POST", "/", `{"query":"{list @stream(initialCount: 1)}"}`)
+	req.Header.Set("Accept", "multipart/mixed, application/json")
+	w := &flushCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != `multipart/mixed; boundary="-"` {
+		t.Errorf("Expected a multipart content type, got %s", ct)
+	}
+	part := "\r\n---\r\nContent-Type: application/json; charset=utf-8\r\n\r\n"
+	expected := part + `{"data":{"list":["a"]},"hasNext":true}` +
+		part + `{"data":"b","path":["list",1],"hasNext":false}` +
+		"\r\n-----\r\n"
+	if w.Body.String() != expected {
+		t.Errorf("Expected body %q, got %q", expected, w.Body.String())
+	}
+	if w.flushes != 2 {
+		t.Errorf("Expected each part to be flushed, got %d flushes", w.flushes)
+	}
+}
+
+func TestMultipartFallback(t *testing.T) {
+	h := NewGraphQLHandler(testschema.New(nil), &GraphQLHandlerConfig{RootObject: struct{}{}})
+
+	for _, c := range []struct {
+		accept   string
+		query    string
+		expected string
+	}{
+		// Clients that do not accept multipart responses get the complete result
+		{"application/json", `{list @stream(initialCount: 1)}`, `{"data":{"list":["a","b"]}}`},
+		// Nothing was deferred, so there is a single payload
+		{"multipart/mixed", `{list}`, `{"data":{"list":["a","b"]}}`},
+	} {
+		req := newTestRequest("POST", "/", `{"query":"`+c.query+`"}`)
+		req.Header.Set("Accept", c.accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if ct := w.Header().Get("Content-Type"); ct != "application/json;charset=utf-8" {
+			t.Errorf("Expected a JSON content type for %s, got %s", c.query, ct)
+		}
+		if w.Body.String() != c.expected {
+			t.Errorf("Expected body %s for %s, got %s", c.expected, c.query, w.Body.String())
+		}
+	}
+}
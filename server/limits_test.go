@@ -0,0 +1,50 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/housecanary/gq/internal/pkg/testschema"
+)
+
+func TestDefaultPrepareOptions(t *testing.T) {
+	h := NewGraphQLHandler(testschema.New(nil), &GraphQLHandlerConfig{
+		RootObject: struct{}{},
+	})
+
+	// Close to the default limit on the size of request bodies
+	query := "{" + strings.Repeat("hello ", 16000) + "}"
+	body, _ := json.Marshal(map[string]string{"query": query})
+	start := time.Now()
+	w := serve(h, "POST", "/", string(body))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Rejecting a large query took %v", elapsed)
+	}
+	expected := `{"errors":[{"message":"Query exceeds the maximum of 1000 fields","locations":[{"line":1,"column":6002}],"path":["hello"],"extensions":{"code":"GRAPHQL_VALIDATION_FAILED","rule":"MaxFields"}}]}`
+	if w.Body.String() != expected {
+		t.Errorf("Expected response\n%s\ngot\n%s", expected, w.Body.String())
+	}
+
+	query = "{" + strings.Repeat("hello ", 20000) + "}"
+	body, _ = json.Marshal(map[string]string{"query": query})
+	if w := serve(h, "POST", "/", string(body)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected a body over the size limit to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"container/list"
+	"sync"
+)
+
+// An lruCache is a map of bounded size.  When it is full, adding an entry evicts
+// the least recently used entries.  It is safe for concurrent use.
+//
+// The size of the cache is bounded by its number of entries, and by the sum of the
+// sizes of its entries, as estimated by the caller.
+type lruCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	entries    map[interface{}]*list.Element
+	order      *list.List
+}
+
+type lruEntry struct {
+	key   interface{}
+	value interface{}
+	size  int64
+}
+
+// newLRUCache creates an lruCache holding up to maxEntries entries, whose sizes
+// add up to at most maxBytes.  A limit that is not positive is not enforced.
+func newLRUCache(maxEntries int, maxBytes int64) *lruCache {
+	return &lruCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		entries:    make(map[interface{}]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// get returns the value stored for key, marking it as recently used
+func (c *lruCache) get(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+// add stores value for key, evicting the least recently used entries until the
+// cache is within its limits.  It returns the number of evicted entries.  An entry
+// larger than the cache is not stored.
+func (c *lruCache) add(key interface{}, value interface{}, size int64) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return 0
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key, value, size})
+	c.bytes += size
+	evicted := 0
+	for (c.maxEntries > 0 && c.order.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.remove(c.order.Back())
+		evicted++
+	}
+	return evicted
+}
+
+func (c *lruCache) remove(e *list.Element) {
+	entry := e.Value.(*lruEntry)
+	c.order.Remove(e)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+// size returns the number of entries in the cache, and the sum of their sizes
+func (c *lruCache) size() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len(), c.bytes
+}
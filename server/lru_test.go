@@ -0,0 +1,117 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestLRUCacheMaxEntries(t *testing.T) {
+	c := newLRUCache(2, 0)
+	if evicted := c.add("a", 1, 10); evicted != 0 {
+		t.Errorf("Expected no eviction, got %d", evicted)
+	}
+	c.add("b", 2, 10)
+	// Using a makes b the least recently used entry
+	if v, ok := c.get("a"); !ok || v != 1 {
+		t.Errorf("Expected a to be 1, got %v %v", v, ok)
+	}
+	if evicted := c.add("c", 3, 10); evicted != 1 {
+		t.Errorf("Expected 1 eviction, got %d", evicted)
+	}
+	if _, ok := c.get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+	if entries, bytes := c.size(); entries != 2 || bytes != 20 {
+		t.Errorf("Expected 2 entries of 20 bytes, got %d of %d", entries, bytes)
+	}
+}
+
+func TestLRUCacheMaxBytes(t *testing.T) {
+	c := newLRUCache(0, 100)
+	for i := 0; i < 4; i++ {
+		c.add(i, i, 30)
+	}
+	// Adding 3 evicted 0, so 1, 2 and 3 hold 90 bytes
+	if evicted := c.add(4, 4, 50); evicted != 2 {
+		t.Errorf("Expected 2 evictions, got %d", evicted)
+	}
+	for i := 0; i < 5; i++ {
+		_, ok := c.get(i)
+		if expected := i >= 3; ok != expected {
+			t.Errorf("Expected %d to be kept: %v, got %v", i, expected, ok)
+		}
+	}
+	if entries, bytes := c.size(); entries != 2 || bytes != 80 {
+		t.Errorf("Expected 2 entries of 80 bytes, got %d of %d", entries, bytes)
+	}
+
+	// An entry larger than the cache is not stored, and evicts nothing
+	if evicted := c.add("large", nil, 101); evicted != 0 {
+		t.Errorf("Expected no eviction, got %d", evicted)
+	}
+	if _, ok := c.get("large"); ok {
+		t.Error("Expected an entry larger than the cache not to be stored")
+	}
+}
+
+func TestLRUCacheReplace(t *testing.T) {
+	c := newLRUCache(2, 0)
+	c.add("a", 1, 10)
+	c.add("a", 2, 20)
+	if v, _ := c.get("a"); v != 2 {
+		t.Errorf("Expected a to be replaced, got %v", v)
+	}
+	if entries, bytes := c.size(); entries != 1 || bytes != 20 {
+		t.Errorf("Expected 1 entry of 20 bytes, got %d of %d", entries, bytes)
+	}
+}
+
+func TestLRUPersistedQueryStoreEviction(t *testing.T) {
+	for _, c := range []struct {
+		maxEntries int
+		maxBytes   int64
+	}{
+		{3, 0},
+		{0, 3 * int64(len("{q0}"))},
+	} {
+		store := NewLRUPersistedQueryStore(c.maxEntries, c.maxBytes)
+		for i := 0; i < 5; i++ {
+			store.Put(context.Background(), fmt.Sprint(i), fmt.Sprintf("{q%d}", i))
+		}
+		for i := 0; i < 5; i++ {
+			text, ok := store.Get(context.Background(), fmt.Sprint(i))
+			if i < 2 && ok {
+				t.Errorf("Expected query %d to be evicted from a store of %d entries and %d bytes", i, c.maxEntries, c.maxBytes)
+			} else if i >= 2 && text != fmt.Sprintf("{q%d}", i) {
+				t.Errorf("Expected query %d to be stored in a store of %d entries and %d bytes, got %q", i, c.maxEntries, c.maxBytes, text)
+			}
+		}
+	}
+}
+
+func TestLRUPersistedQueryStoreDefaults(t *testing.T) {
+	store := NewLRUPersistedQueryStore(0, 0)
+	if store.cache.maxEntries != DefaultPersistedQueryEntries || store.cache.maxBytes != DefaultPersistedQueryBytes {
+		t.Errorf("Expected default limits, got %d entries and %d bytes", store.cache.maxEntries, store.cache.maxBytes)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/housecanary/gq/query"
+)
+
+// Error codes of errors processing the persistedQuery extension of a request
+const (
+	ErrorCodePersistedQueryNotFound     = "PERSISTED_QUERY_NOT_FOUND"
+	ErrorCodePersistedQueryNotSupported = "PERSISTED_QUERY_NOT_SUPPORTED"
+)
+
+// A PersistedQueryStore stores the text of queries by the hex encoded SHA-256 hash
+// of the text, to support automatic persisted queries.
+//
+// Stores are only a cache: if a query is not found, the client sends the full
+// text of the query, which is then stored again.  Implementations backed by a
+// remote service may thus treat a failure to get or put a query as a miss.
+type PersistedQueryStore interface {
+	Get(ctx context.Context, hash string) (text string, ok bool)
+	Put(ctx context.Context, hash string, text string)
+}
+
+// An LRUPersistedQueryStore is a PersistedQueryStore that keeps the most recently
+// used queries in memory
+type LRUPersistedQueryStore struct {
+	cache *lruCache
+}
+
+var _ PersistedQueryStore = &LRUPersistedQueryStore{}
+
+// Limits of an LRUPersistedQueryStore created with a size that is not positive
+const (
+	DefaultPersistedQueryEntries       = 1000
+	DefaultPersistedQueryBytes   int64 = 10 << 20
+)
+
+// NewLRUPersistedQueryStore creates a store holding up to maxEntries queries, whose
+// texts add up to at most maxBytes.  Any client can register queries, so both sizes
+// are bounded: if either is not positive, DefaultPersistedQueryEntries or
+// DefaultPersistedQueryBytes is used.
+func NewLRUPersistedQueryStore(maxEntries int, maxBytes int64) *LRUPersistedQueryStore {
+	if maxEntries <= 0 {
+		maxEntries = DefaultPersistedQueryEntries
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultPersistedQueryBytes
+	}
+	return &LRUPersistedQueryStore{newLRUCache(maxEntries, maxBytes)}
+}
+
+// Get returns the text of the query with the given hash, if it is stored
+func (s *LRUPersistedQueryStore) Get(ctx context.Context, hash string) (string, bool) {
+	text, ok := s.cache.get(hash)
+	if !ok {
+		return "", false
+	}
+	return text.(string), true
+}
+
+// Put stores the text of a query by its hash
+func (s *LRUPersistedQueryStore) Put(ctx context.Context, hash string, text string) {
+	s.cache.add(hash, text, int64(len(text)))
+}
+
+// persistedQueryExtension is the persistedQuery extension of a request, see
+// https://github.com/apollographql/apollo-link-persisted-queries
+type persistedQueryExtension struct {
+	Version    int    `json:"version"`
+	SHA256Hash string `json:"sha256Hash"`
+}
+
+// resolvePersistedQuery processes the persistedQuery extension of request, if any.
+// If the request only has the hash of its query, the text is looked up in the store.
+// Otherwise the hash is checked against the text, and the request is marked so that
+// the query is stored once it has been successfully prepared.
+func (h *GraphQLHandler) resolvePersistedQuery(req *http.Request, request *graphQLRequest) error {
+	pq := request.Extensions.PersistedQuery
+	if pq == nil {
+		return nil
+	}
+	if h.persistedQueries == nil {
+		return query.NewCodedError(ErrorCodePersistedQueryNotSupported, "PersistedQueryNotSupported")
+	}
+	if pq.Version != 1 {
+		return query.NewBadUserInputError("Unsupported persisted query version %d", pq.Version)
+	}
+	hash := strings.ToLower(pq.SHA256Hash)
+
+	if request.Query == "" {
+		text, ok := h.persistedQueries.Get(req.Context(), hash)
+		if !ok {
+			return query.NewCodedError(ErrorCodePersistedQueryNotFound, "PersistedQueryNotFound")
+		}
+		request.Query = text
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(request.Query))
+	if hex.EncodeToString(sum[:]) != hash {
+		return query.NewBadUserInputError("Provided sha256Hash does not match query")
+	}
+	request.persist = true
+	return nil
+}
+
+// persistQuery stores the text of request if it registers a persisted query
+func (h *GraphQLHandler) persistQuery(req *http.Request, request *graphQLRequest) {
+	if request.persist {
+		h.persistedQueries.Put(req.Context(), strings.ToLower(request.Extensions.PersistedQuery.SHA256Hash), request.Query)
+	}
+}
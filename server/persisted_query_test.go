@@ -0,0 +1,103 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/housecanary/gq/internal/pkg/testschema"
+)
+
+func persistedQueryBody(text string, hash string) string {
+	return fmt.Sprintf(`{"query":%q,"extensions":{"persistedQuery":{"version":1,"sha256Hash":%q}}}`, text, hash)
+}
+
+func sha256Hex(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestPersistedQuery(t *testing.T) {
+	store := NewLRUPersistedQueryStore(10, 0)
+	h := NewGraphQLHandler(testschema.New(nil), &GraphQLHandlerConfig{
+		RootObject:          struct{}{},
+		PersistedQueryStore: store,
+	})
+	notFound := `{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`
+	hello := `{"data":{"hello":"Hello World"}}`
+	helloHash := sha256Hex("{hello}")
+	invalidHash := sha256Hex("{nope}")
+	getURL := func(hash string) string {
+		return "/?extensions=" + url.QueryEscape(fmt.Sprintf(`{"persistedQuery":{"version":1,"sha256Hash":%q}}`, hash))
+	}
+
+	for _, c := range []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		expected string
+	}{
+		{"unknown hash", "POST", "/", persistedQueryBody("", helloHash), notFound},
+		{"unknown hash by GET", "GET", getURL(helloHash), "", notFound},
+		{"mismatched hash", "POST", "/", persistedQueryBody("{hello}", invalidHash), `{"errors":[{"message":"Provided sha256Hash does not match query","extensions":{"code":"BAD_USER_INPUT"}}]}`},
+		{"hash of mismatched query", "POST", "/", persistedQueryBody("", invalidHash), notFound},
+		{"invalid query", "POST", "/", persistedQueryBody("{nope}", invalidHash), `{"errors":[{"message":"Cannot query field \"nope\" on type \"Query\"","locations":[{"line":1,"column":2}],"extensions":{"code":"GRAPHQL_VALIDATION_FAILED","rule":"FieldsOnCorrectType"}}]}`},
+		{"hash of invalid query", "POST", "/", persistedQueryBody("", invalidHash), notFound},
+		{"register", "POST", "/", persistedQueryBody("{hello}", helloHash), hello},
+		{"registered hash", "POST", "/", persistedQueryBody("", helloHash), hello},
+		{"registered hash by GET", "GET", getURL(helloHash), "", hello},
+		{"unsupported version", "POST", "/", `{"extensions":{"persistedQuery":{"version":2,"sha256Hash":"abc"}}}`, `{"errors":[{"message":"Unsupported persisted query version 2","extensions":{"code":"BAD_USER_INPUT"}}]}`},
+	} {
+		w := serve(h, c.method, c.url, c.body)
+		if w.Body.String() != c.expected {
+			t.Errorf("%s: expected response\n%s\ngot\n%s", c.name, c.expected, w.Body.String())
+		}
+	}
+
+	if _, ok := store.Get(context.Background(), invalidHash); ok {
+		t.Error("Expected a query that failed to prepare not to be stored")
+	}
+}
+
+func TestPersistedQueryBatch(t *testing.T) {
+	h := NewGraphQLHandler(testschema.New(nil), &GraphQLHandlerConfig{
+		RootObject:          struct{}{},
+		PersistedQueryStore: NewLRUPersistedQueryStore(10, 0),
+	})
+	hash := sha256Hex("{hello}")
+	body := "[" + persistedQueryBody("", hash) + "," + persistedQueryBody("{hello}", hash) + "," + persistedQueryBody("", hash) + "]"
+	expected := `[{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]},{"data":{"hello":"Hello World"}},{"data":{"hello":"Hello World"}}]`
+	w := serve(h, "POST", "/", body)
+	if w.Body.String() != expected {
+		t.Errorf("Expected response\n%s\ngot\n%s", expected, w.Body.String())
+	}
+}
+
+func TestPersistedQueryNotSupported(t *testing.T) {
+	h := NewGraphQLHandler(testschema.New(nil), &GraphQLHandlerConfig{
+		RootObject: struct{}{},
+	})
+	expected := `{"errors":[{"message":"PersistedQueryNotSupported","extensions":{"code":"PERSISTED_QUERY_NOT_SUPPORTED"}}]}`
+	w := serve(h, "POST", "/", persistedQueryBody("", sha256Hex("{hello}")))
+	if w.Body.String() != expected {
+		t.Errorf("Expected response\n%s\ngot\n%s", expected, w.Body.String())
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/housecanary/gq/query"
+	"github.com/housecanary/gq/schema"
+)
+
+// DefaultQueryCacheEntries is the number of queries kept by a QueryCache whose
+// size is not limited by its options
+const DefaultQueryCacheEntries = 1000
+
+// estimatedFieldSize is the approximate memory used by each field selected by a
+// prepared query
+const estimatedFieldSize = 512
+
+// QueryCacheOptions configures a QueryCache
+type QueryCacheOptions struct {
+	// Maximum number of queries to keep.  If not positive, the number of queries is
+	// only limited by MaxBytes.
+	MaxEntries int
+
+	// Approximate maximum memory used by the kept queries, in bytes.  The memory used
+	// by a query is estimated from the size of its text and the number of fields it
+	// selects.  If not positive, memory is not limited.
+	//
+	// If neither limit is set, DefaultQueryCacheEntries queries are kept.
+	MaxBytes int64
+
+	// Builder compiles queries that are not in the cache.  If nil, DefaultQueryBuilder
+	// is used.
+	Builder QueryBuilder
+}
+
+// QueryCacheStats reports the activity of a QueryCache
+type QueryCacheStats struct {
+	// Hits counts queries found in the cache
+	Hits uint64
+
+	// Misses counts queries that were compiled
+	Misses uint64
+
+	// Shared counts queries that were not in the cache, but were being compiled for
+	// another request, and thus were not compiled again
+	Shared uint64
+
+	// Evictions counts queries removed from the cache to make room for others
+	Evictions uint64
+
+	// Entries is the number of queries in the cache, and Bytes their estimated size
+	Entries int
+	Bytes   int64
+}
+
+// A QueryCache keeps the most recently used prepared queries, so that they are not
+// compiled for each request.  Its Build method is a QueryBuilder that is safe for
+// concurrent use:
+//
+//	cache := server.NewQueryCache(server.QueryCacheOptions{MaxEntries: 5000})
+//	config.QueryBuilder = cache.Build
+//
+// Queries are cached by schema, operation name and text.  The text must be
+// identical, as the locations of the errors reported when running a query refer
+// to the text it was compiled from.  Concurrent requests for the same query that
+// is not in the cache wait for a single compilation.  Queries that fail to compile
+// are not cached, and a panic while compiling a query is returned as a
+// *query.PanicError.
+type QueryCache struct {
+	hits      uint64
+	misses    uint64
+	shared    uint64
+	evictions uint64
+
+	builder QueryBuilder
+	cache   *lruCache
+
+	mu       sync.Mutex
+	inFlight map[queryCacheKey]*queryCacheCall
+}
+
+type queryCacheKey struct {
+	schema        *schema.Schema
+	text          string
+	operationName string
+}
+
+// A queryCacheCall is a compilation of a query that other requests may wait for
+type queryCacheCall struct {
+	done chan struct{}
+	q    *query.PreparedQuery
+	err  error
+}
+
+// NewQueryCache creates an empty QueryCache
+func NewQueryCache(options QueryCacheOptions) *QueryCache {
+	builder := options.Builder
+	if builder == nil {
+		builder = DefaultQueryBuilder
+	}
+	maxEntries := options.MaxEntries
+	if maxEntries <= 0 && options.MaxBytes <= 0 {
+		maxEntries = DefaultQueryCacheEntries
+	}
+	return &QueryCache{
+		builder:  builder,
+		cache:    newLRUCache(maxEntries, options.MaxBytes),
+		inFlight: make(map[queryCacheKey]*queryCacheCall),
+	}
+}
+
+// Build returns the prepared query for text from the cache, compiling it if it is
+// not cached
+func (c *QueryCache) Build(schema *schema.Schema, text string, operationName string) (*query.PreparedQuery, error) {
+	key := queryCacheKey{schema, text, operationName}
+	if q, ok := c.cache.get(key); ok {
+		atomic.AddUint64(&c.hits, 1)
+		return q.(*query.PreparedQuery), nil
+	}
+
+	c.mu.Lock()
+	if call, ok := c.inFlight[key]; ok {
+		c.mu.Unlock()
+		atomic.AddUint64(&c.shared, 1)
+		<-call.done
+		return call.q, call.err
+	}
+	// The query may have been cached while waiting for the lock
+	if q, ok := c.cache.get(key); ok {
+		c.mu.Unlock()
+		atomic.AddUint64(&c.hits, 1)
+		return q.(*query.PreparedQuery), nil
+	}
+	call := &queryCacheCall{done: make(chan struct{})}
+	c.inFlight[key] = call
+	c.mu.Unlock()
+
+	atomic.AddUint64(&c.misses, 1)
+	defer func() {
+		c.mu.Lock()
+		delete(c.inFlight, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	call.q, call.err = c.build(schema, text, operationName)
+	if call.err == nil {
+		evicted := c.cache.add(key, call.q, estimateQuerySize(key, call.q))
+		atomic.AddUint64(&c.evictions, uint64(evicted))
+	}
+	return call.q, call.err
+}
+
+// build compiles a query with the builder of the cache.  A panic of the builder is
+// returned as a *query.PanicError, so that requests waiting for the compilation
+// are not left without a query or an error.
+func (c *QueryCache) build(schema *schema.Schema, text string, operationName string) (q *query.PreparedQuery, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			q, err = nil, &query.PanicError{Value: r}
+		}
+	}()
+	return c.builder(schema, text, operationName)
+}
+
+// Stats returns the statistics of the cache
+func (c *QueryCache) Stats() QueryCacheStats {
+	entries, bytes := c.cache.size()
+	return QueryCacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Shared:    atomic.LoadUint64(&c.shared),
+		Evictions: atomic.LoadUint64(&c.evictions),
+		Entries:   entries,
+		Bytes:     bytes,
+	}
+}
+
+// estimateQuerySize estimates the memory used by a cached query
+func estimateQuerySize(key queryCacheKey, q *query.PreparedQuery) int64 {
+	return int64(len(key.text)+len(key.operationName)) + estimatedFieldSize*int64(q.FieldCount())
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/housecanary/gq/internal/pkg/testschema"
+	"github.com/housecanary/gq/query"
+	"github.com/housecanary/gq/schema"
+)
+
+func TestQueryCache(t *testing.T) {
+	s := testschema.New(nil)
+	cache := NewQueryCache(QueryCacheOptions{MaxEntries: 2})
+	build := func(text string) *query.PreparedQuery {
+		q, err := cache.Build(s, text, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}
+
+	q := build("{hello}")
+	if build("{hello}") != q {
+		t.Error("Expected the query to be cached")
+	}
+	build("{fail}")
+	build("{list}")
+	if build("{list}") == nil || build("{hello}") == q {
+		t.Error("Expected the least recently used query to be evicted")
+	}
+	if _, err := cache.Build(s, "{nope}", ""); err == nil {
+		t.Error("Expected an invalid query to fail")
+	}
+
+	expected := QueryCacheStats{Hits: 2, Misses: 5, Evictions: 2, Entries: 2}
+	stats := cache.Stats()
+	bytes := stats.Bytes
+	stats.Bytes = 0
+	if stats != expected {
+		t.Errorf("Expected stats %+v, got %+v", expected, stats)
+	}
+	if expectedBytes := int64(len("{list}")+len("{hello}")) + 2*estimatedFieldSize; bytes != expectedBytes {
+		t.Errorf("Expected %d bytes, got %d", expectedBytes, bytes)
+	}
+}
+
+func TestQueryCacheErrorLocations(t *testing.T) {
+	cache := NewQueryCache(QueryCacheOptions{})
+	h := NewGraphQLHandler(testschema.New(nil), &GraphQLHandlerConfig{
+		RootObject:   struct{}{},
+		QueryBuilder: cache.Build,
+	})
+	for _, c := range []struct {
+		body     string
+		expected string
+	}{
+		{`{"query":"{fail}"}`, `{"data":{"fail":null},"errors":[{"message":"Failed","path":["fail"],"locations":[{"line":1,"column":2}]}]}`},
+		{`{"query":"\n  { fail }"}`, `{"data":{"fail":null},"errors":[{"message":"Failed","path":["fail"],"locations":[{"line":2,"column":5}]}]}`},
+		{`{"query":"{fail}"}`, `{"data":{"fail":null},"errors":[{"message":"Failed","path":["fail"],"locations":[{"line":1,"column":2}]}]}`},
+	} {
+		w := serve(h, "POST", "/", c.body)
+		if w.Body.String() != c.expected {
+			t.Errorf("Expected response to %s\n%s\ngot\n%s", c.body, c.expected, w.Body.String())
+		}
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("Expected differently formatted queries to be cached separately, got %+v", stats)
+	}
+}
+
+func TestQueryCacheMaxBytes(t *testing.T) {
+	s := testschema.New(nil)
+	cache := NewQueryCache(QueryCacheOptions{MaxBytes: 3 * estimatedFieldSize})
+	for _, text := range []string{"{hello}", "{hello fail}", "{hello fail list}"} {
+		if _, err := cache.Build(s, text, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The last query is larger than the cache, the second evicted the first
+	stats := cache.Stats()
+	if stats.Entries != 1 || stats.Evictions != 1 || stats.Bytes != int64(len("{hello fail}"))+2*estimatedFieldSize {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestQueryCacheConcurrentMisses(t *testing.T) {
+	const n = 5
+	release := make(chan struct{})
+	calls := 0
+	cache := NewQueryCache(QueryCacheOptions{
+		Builder: func(s *schema.Schema, text string, operationName string) (*query.PreparedQuery, error) {
+			calls++
+			<-release
+			return DefaultQueryBuilder(s, text, operationName)
+		},
+	})
+
+	s := testschema.New(nil)
+	results := make([]*query.PreparedQuery, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			q, err := cache.Build(s, "{hello}", "")
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = q
+		}(i)
+	}
+	// Wait for all requests but the one compiling to wait for the compilation
+	for deadline := time.Now().Add(5 * time.Second); cache.Stats().Shared < n-1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Requests did not wait for the compilation: %+v", cache.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected the query to be compiled once, got %d", calls)
+	}
+	for _, q := range results {
+		if q == nil || q != results[0] {
+			t.Errorf("Expected all requests to get the same query, got %v", results)
+			break
+		}
+	}
+	if stats := cache.Stats(); stats.Misses != 1 || stats.Shared != n-1 || stats.Entries != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestQueryCacheBuilderPanic(t *testing.T) {
+	cache := NewQueryCache(QueryCacheOptions{
+		Builder: func(s *schema.Schema, text string, operationName string) (*query.PreparedQuery, error) {
+			panic("failed")
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		q, err := cache.Build(testschema.New(nil), "{hello}", "")
+		var pe *query.PanicError
+		if q != nil || !errors.As(err, &pe) || pe.Value != "failed" {
+			t.Errorf("Expected a PanicError, got %v %v", q, err)
+		}
+	}
+	if stats := cache.Stats(); stats.Misses != 2 || stats.Entries != 0 {
+		t.Errorf("Expected the failed query not to be cached, got %+v", stats)
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing traces the execution of queries as spans: one for each
+// execution, one for each operation executed by a server, one for each resolved
+// field, one for each idle round, and one for each batch load started in an idle
+// round.
+//
+// Spans are created by a Tracer, a small interface that is simple to implement
+// with a tracing system such as OpenTelemetry.  A Recorder implements Tracer in
+// memory, for tests.
+//
+// The simplest way to trace the queries served by a server.GraphQLHandler is to
+// set its QueryExecutionWrapper to ExecutionWrapper.
+package tracing
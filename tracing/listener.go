@@ -0,0 +1,208 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/housecanary/gq/ast"
+	"github.com/housecanary/gq/query"
+	"github.com/housecanary/gq/schema"
+	"github.com/housecanary/gq/server"
+)
+
+// An IdleListener is an ExecutionListener that starts batch loads at idle points,
+// and traces them.  If the listener wrapped by a Listener implements this
+// interface, NotifyIdleContext is called in place of NotifyIdle, with a context
+// holding the span of the idle round.  Batch loads should be traced with
+// StartBatchLoad(ctx, ...).
+type IdleListener interface {
+	query.ExecutionListener
+	NotifyIdleContext(ctx context.Context)
+}
+
+// A Listener is a query.ExecutionListener that traces an execution.  It starts a
+// span for the execution when it is created, and a child span for each resolved
+// field and each idle round.  End must be called once execution is complete.
+//
+// Notifications are also passed to the listener it wraps, if any.
+type Listener struct {
+	listener query.ExecutionListener
+	tracer   Tracer
+	ctx      context.Context
+	span     Span
+	idles    int
+	errors   int
+	firstErr error
+}
+
+var _ query.FieldExecutionListener = &Listener{}
+
+// NewListener starts tracing an execution with tracer, wrapping listener.  The
+// execution span is a child of the span in ctx, if any, and is described by
+// attributes.
+func NewListener(ctx context.Context, tracer Tracer, listener query.ExecutionListener, attributes ...Attribute) *Listener {
+	ctx, span := tracer.StartSpan(withTracer(ctx, tracer), SpanExecute, attributes...)
+	return &Listener{listener: listener, tracer: tracer, ctx: ctx, span: span}
+}
+
+// Context returns a context holding the span of the execution.  Queries should be
+// executed with this context, so that resolvers can trace their work as part of
+// the execution with StartSpan.
+func (l *Listener) Context() context.Context {
+	return l.ctx
+}
+
+// End ends the span of the execution.  If any errors occurred, the span is
+// marked as failed with the first.
+func (l *Listener) End() {
+	if l.errors > 0 {
+		l.span.SetAttributes(Attr(AttrErrorCount, l.errors))
+		l.span.SetError(l.firstErr)
+	}
+	l.span.End()
+}
+
+// NotifyResolve passes the notification to the wrapped listener.  Fields are
+// traced by NotifyResolveField, which is called in its place during execution.
+func (l *Listener) NotifyResolve(queryField *ast.Field, schemaField *schema.FieldDescriptor) (query.ResolveCompleteCallback, error) {
+	if l.listener == nil {
+		return nil, nil
+	}
+	return l.listener.NotifyResolve(queryField, schemaField)
+}
+
+// NotifyResolveField starts the span of a field, and returns a callback that ends
+// it
+func (l *Listener) NotifyResolveField(info *query.FieldInfo) (query.ResolveCompleteCallback, error) {
+	var cb query.ResolveCompleteCallback
+	var err error
+	if fl, ok := l.listener.(query.FieldExecutionListener); ok {
+		cb, err = fl.NotifyResolveField(info)
+	} else if l.listener != nil {
+		cb, err = l.listener.NotifyResolve(info.QueryField, info.SchemaField)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	typeName := ""
+	if info.ParentType != nil {
+		typeName = info.ParentType.Name()
+	}
+	_, span := l.tracer.StartSpan(l.ctx, SpanResolve,
+		Attr(AttrType, typeName),
+		Attr(AttrField, info.SchemaField.Name()),
+		Attr(AttrPath, formatPath(info.Path)),
+	)
+	return func(v interface{}, err error) error {
+		if cb != nil {
+			err = cb(v, err)
+		}
+		if err != nil {
+			span.SetAttributes(Attr(AttrError, err.Error()))
+			span.SetError(err)
+		}
+		span.End()
+		return err
+	}, nil
+}
+
+// NotifyIdle starts the span of an idle round, and passes the notification to the
+// wrapped listener.  The span ends once the wrapped listener returns.
+func (l *Listener) NotifyIdle() {
+	l.idles++
+	ctx, span := l.tracer.StartSpan(l.ctx, SpanIdle, Attr(AttrIdleRound, l.idles))
+	defer span.End()
+	if il, ok := l.listener.(IdleListener); ok {
+		il.NotifyIdleContext(ctx)
+	} else if l.listener != nil {
+		l.listener.NotifyIdle()
+	}
+}
+
+// NotifyError counts errors for the execution span, and passes the notification
+// to the wrapped listener
+func (l *Listener) NotifyError(err error) {
+	if l.errors == 0 {
+		l.firstErr = err
+	}
+	l.errors++
+	if l.listener != nil {
+		l.listener.NotifyError(err)
+	}
+}
+
+// ResponseExtensions returns the extensions of the wrapped listener
+func (l *Listener) ResponseExtensions() map[string]interface{} {
+	if el, ok := l.listener.(query.ExtensionsListener); ok {
+		return el.ResponseExtensions()
+	}
+	return nil
+}
+
+// formatPath formats a response path like a.0.b
+func formatPath(path []interface{}) string {
+	parts := make([]string, len(path))
+	for i, key := range path {
+		parts[i] = fmt.Sprint(key)
+	}
+	return strings.Join(parts, ".")
+}
+
+// ExecutionWrapper returns a server.QueryExecutionWrapper that traces each
+// execution with tracer.  If wrapped is not nil, it is called to set up each
+// execution, and the listener it supplies is wrapped by the tracing Listener.
+//
+// The queries of a batch share an execution span.  Each query also has a child
+// span of the execution, named by its operation, which lasts as long as the
+// execution of the batch.
+func ExecutionWrapper(tracer Tracer, wrapped server.QueryExecutionWrapper) server.QueryExecutionWrapper {
+	return func(queryInfo server.QueryInfo, req *http.Request, responseHeaders http.Header, proceed func(context.Context, query.ExecutionListener)) {
+		traced := func(ctx context.Context, ql query.ExecutionListener) {
+			if ctx == nil {
+				ctx = req.Context()
+			}
+			l := NewListener(ctx, tracer, ql, Attr(AttrQueryCount, queryInfo.GetNQueries()))
+			defer l.End()
+			operations := make([]Span, queryInfo.GetNQueries())
+			for i := range operations {
+				_, operations[i] = tracer.StartSpan(l.Context(), SpanOperation, operationAttributes(queryInfo.GetQuery(i))...)
+			}
+			defer func() {
+				for _, span := range operations {
+					span.End()
+				}
+			}()
+			proceed(l.Context(), l)
+		}
+		if wrapped == nil {
+			traced(req.Context(), nil)
+			return
+		}
+		wrapped(queryInfo, req, responseHeaders, traced)
+	}
+}
+
+// operationAttributes describes the operation of a prepared query
+func operationAttributes(q *query.PreparedQuery) []Attribute {
+	return []Attribute{
+		Attr(AttrOperationName, q.OperationName()),
+		Attr(AttrOperationType, string(q.OperationType())),
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Recorder is a Tracer that keeps the spans it starts in memory
+type Recorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// A RecordedSpan is a span started by a Recorder.  Its fields should only be read
+// once the traced work is complete.
+type RecordedSpan struct {
+	Name       string
+	Parent     *RecordedSpan
+	Attributes map[string]interface{}
+	Err        error
+	Start      time.Time
+	End        time.Time
+
+	recorder *Recorder
+}
+
+type recordedSpanKey struct{}
+
+// NewRecorder creates an empty Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// StartSpan starts a span that is kept by the recorder
+func (r *Recorder) StartSpan(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(recordedSpanKey{}).(*RecordedSpan)
+	span := &RecordedSpan{
+		Name:       name,
+		Parent:     parent,
+		Attributes: make(map[string]interface{}, len(attributes)),
+		Start:      time.Now(),
+		recorder:   r,
+	}
+	for _, a := range attributes {
+		span.Attributes[a.Key] = a.Value
+	}
+
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+	return context.WithValue(ctx, recordedSpanKey{}, span), &recordedSpan{span}
+}
+
+// Spans returns the spans started so far, in the order they were started
+func (r *Recorder) Spans() []*RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]*RecordedSpan, len(r.spans))
+	copy(spans, r.spans)
+	return spans
+}
+
+// Ended returns whether the span has ended
+func (s *RecordedSpan) Ended() bool {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	return !s.End.IsZero()
+}
+
+// recordedSpan implements Span for a RecordedSpan.  RecordedSpan cannot implement
+// it itself, as its End field would clash with the End method.
+type recordedSpan struct {
+	*RecordedSpan
+}
+
+func (s *recordedSpan) SetAttributes(attributes ...Attribute) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	for _, a := range attributes {
+		s.Attributes[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) SetError(err error) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.Err = err
+}
+
+func (s *recordedSpan) End() {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	if s.RecordedSpan.End.IsZero() {
+		s.RecordedSpan.End = time.Now()
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+)
+
+// A Tracer starts spans.  The span is a child of the span in ctx, if any, and the
+// returned context holds the new span.
+type Tracer interface {
+	StartSpan(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span)
+}
+
+// A Span is a traced operation
+type Span interface {
+	SetAttributes(attributes ...Attribute)
+
+	// SetError marks the span as failed
+	SetError(err error)
+
+	End()
+}
+
+// An Attribute describes a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr creates an Attribute
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{key, value}
+}
+
+// Names of spans, and keys of attributes, created by this package
+const (
+	SpanExecute   = "graphql.execute"
+	SpanOperation = "graphql.operation"
+	SpanResolve   = "graphql.resolve"
+	SpanIdle      = "graphql.idle"
+	SpanBatchLoad = "graphql.batch_load"
+
+	AttrType          = "graphql.type"
+	AttrField         = "graphql.field"
+	AttrPath          = "graphql.path"
+	AttrError         = "graphql.error"
+	AttrErrorCount    = "graphql.error_count"
+	AttrQueryCount    = "graphql.query_count"
+	AttrOperationName = "graphql.operation.name"
+	AttrOperationType = "graphql.operation.type"
+	AttrIdleRound     = "graphql.idle_round"
+	AttrLoader        = "graphql.loader"
+	AttrBatchSize     = "graphql.batch_size"
+)
+
+type tracerKey struct{}
+
+// withTracer returns a context that starts spans with tracer in StartSpan
+func withTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// StartSpan starts a span with the Tracer of the execution traced in ctx.  If ctx
+// is not traced, the span does nothing.  This can be used by resolvers to trace
+// their work within the span of the execution.
+func StartSpan(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	tracer, _ := ctx.Value(tracerKey{}).(Tracer)
+	if tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return tracer.StartSpan(ctx, name, attributes...)
+}
+
+// StartBatchLoad starts a span for a batch load of size keys by the named loader.
+// ctx should be the context passed to an IdleListener, so that the batch load is
+// a child of the span of the idle round that started it.
+func StartBatchLoad(ctx context.Context, loader string, size int) (context.Context, Span) {
+	return StartSpan(ctx, SpanBatchLoad, Attr(AttrLoader, loader), Attr(AttrBatchSize, size))
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attributes ...Attribute) {}
+func (noopSpan) SetError(err error)                    {}
+func (noopSpan) End()                                  {}
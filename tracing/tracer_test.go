@@ -0,0 +1,192 @@
+// Copyright 2018 HouseCanary, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/housecanary/gq/internal/pkg/testschema"
+	"github.com/housecanary/gq/query"
+	"github.com/housecanary/gq/schema"
+	"github.com/housecanary/gq/server"
+	"github.com/housecanary/gq/types"
+)
+
+type loader struct {
+	query.BaseExecutionListener
+	pending []string
+	loaded  map[string]string
+}
+
+func (l *loader) load(key string) schema.AsyncValue {
+	l.pending = append(l.pending, key)
+	return schema.AsyncValueFunc(func(ctx context.Context) (interface{}, error) {
+		return types.NewString(l.loaded[key]), nil
+	})
+}
+
+func (l *loader) NotifyIdleContext(ctx context.Context) {
+	if len(l.pending) == 0 {
+		return
+	}
+	_, span := StartBatchLoad(ctx, "names", len(l.pending))
+	for _, key := range l.pending {
+		l.loaded[key] = strings.ToUpper(key)
+	}
+	l.pending = nil
+	span.End()
+}
+
+// name resolves the name of an item by loading it
+func (l *loader) name() schema.Resolver {
+	return schema.SimpleResolver(func(v interface{}) (interface{}, error) {
+		return l.load(v.(string)), nil
+	})
+}
+
+func TestListener(t *testing.T) {
+	l := &loader{loaded: make(map[string]string)}
+	q, err := query.PrepareQuery(`{items {name} fail}`, "", testschema.New(l.name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := NewRecorder()
+	listener := NewListener(context.Background(), recorder, l, Attr("test", true))
+	result := string(q.Execute(listener.Context(), struct{}{}, nil, listener))
+	listener.End()
+	if !strings.Contains(result, `"items":[{"name":"A"},{"name":"B"}]`) {
+		t.Fatalf("Unexpected result %s", result)
+	}
+
+	spans := recorder.Spans()
+	var root *RecordedSpan
+	var resolved []string
+	var batches []*RecordedSpan
+	var idles []*RecordedSpan
+	for _, span := range spans {
+		if !span.Ended() {
+			t.Errorf("Span %s was not ended", span.Name)
+		}
+		switch span.Name {
+		case SpanExecute:
+			root = span
+		case SpanResolve:
+			resolved = append(resolved, span.Attributes[AttrType].(string)+"."+span.Attributes[AttrField].(string)+"@"+span.Attributes[AttrPath].(string))
+			if span.Attributes[AttrField] == "fail" {
+				if span.Err == nil || span.Attributes[AttrError] != "Failed" {
+					t.Errorf("Expected error status on fail, got %v %v", span.Err, span.Attributes)
+				}
+			} else if span.Err != nil {
+				t.Errorf("Unexpected error status on %v: %v", span.Attributes, span.Err)
+			}
+		case SpanIdle:
+			idles = append(idles, span)
+		case SpanBatchLoad:
+			batches = append(batches, span)
+		}
+	}
+	if root == nil || root.Parent != nil {
+		t.Fatalf("Expected a root execution span, got %v", spans)
+	}
+	if root.Attributes["test"] != true || root.Attributes[AttrErrorCount] != 1 || root.Err == nil {
+		t.Errorf("Unexpected execution span attributes %v, error %v", root.Attributes, root.Err)
+	}
+	for _, span := range spans {
+		if span != root && span.Name != SpanBatchLoad && span.Parent != root {
+			t.Errorf("Expected span %s to be a child of the execution span", span.Name)
+		}
+	}
+
+	sort.Strings(resolved)
+	expected := "Item.name@items.0.name,Item.name@items.1.name,Query.fail@fail,Query.items@items"
+	if strings.Join(resolved, ",") != expected {
+		t.Errorf("Expected resolved fields %s, got %s", expected, strings.Join(resolved, ","))
+	}
+
+	if len(idles) != 1 || idles[0].Attributes[AttrIdleRound] != 1 {
+		t.Fatalf("Expected one idle round, got %v", idles)
+	}
+	if len(batches) != 1 || batches[0].Attributes[AttrLoader] != "names" || batches[0].Attributes[AttrBatchSize] != 2 {
+		t.Errorf("Expected one batch load of 2 names, got %v", batches)
+	} else if batches[0].Parent != idles[0] {
+		t.Errorf("Expected the batch load to be a child of the idle round span")
+	}
+}
+
+func TestExecutionWrapper(t *testing.T) {
+	l := &loader{loaded: make(map[string]string)}
+	recorder := NewRecorder()
+	h := server.NewGraphQLHandler(testschema.New(l.name()), &server.GraphQLHandlerConfig{
+		RootObject: struct{}{},
+		QueryExecutionWrapper: ExecutionWrapper(recorder, func(queryInfo server.QueryInfo, req *http.Request, responseHeaders http.Header, proceed func(context.Context, query.ExecutionListener)) {
+			proceed(nil, l)
+		}),
+	})
+	body := `[{"query": "query Names {items {name}}"}, {"query": "{fail}"}]`
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"items":[{"name":"A"},{"name":"B"}]`) {
+		t.Fatalf("Unexpected result %s", w.Body.String())
+	}
+
+	var root *RecordedSpan
+	var operations []string
+	var batches []*RecordedSpan
+	for _, span := range recorder.Spans() {
+		if !span.Ended() {
+			t.Errorf("Span %s was not ended", span.Name)
+		}
+		switch span.Name {
+		case SpanExecute:
+			root = span
+		case SpanOperation:
+			if span.Parent == nil || span.Parent.Name != SpanExecute {
+				t.Errorf("Expected operation span to be a child of the execution span")
+			}
+			operations = append(operations, span.Attributes[AttrOperationType].(string)+" "+span.Attributes[AttrOperationName].(string))
+		case SpanBatchLoad:
+			batches = append(batches, span)
+		}
+	}
+	if root == nil || root.Attributes[AttrQueryCount] != 2 {
+		t.Fatalf("Expected an execution span for 2 queries, got %v", root)
+	}
+	if expected := "query Names,query "; strings.Join(operations, ",") != expected {
+		t.Errorf("Expected operation spans %q, got %q", expected, strings.Join(operations, ","))
+	}
+	if len(batches) != 1 || batches[0].Parent == nil || batches[0].Parent.Name != SpanIdle {
+		t.Errorf("Expected one batch load in an idle round span, got %v", batches)
+	}
+}
+
+func TestStartSpanUntraced(t *testing.T) {
+	ctx := context.Background()
+	spanCtx, span := StartSpan(ctx, "test")
+	if spanCtx != ctx {
+		t.Error("Expected an untraced span to keep the context")
+	}
+	span.SetAttributes(Attr("a", 1))
+	span.SetError(errors.New("failed"))
+	span.End()
+}